@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// cipherAESGCM is the only encryption the server knows: AES-256-GCM with a
+// 12-byte nonce, sent as base64 of nonce and ciphertext, and the key
+// base64url-encoded in the URL fragment
+const cipherAESGCM = "aes-256-gcm"
+
+// client calls the API of one server
+type client struct {
+	server   string
+	token    string
+	password string // for password-protected pastes
+	http     *http.Client
+}
+
+func newClient(cfg *config) *client {
+	return &client{
+		server: cfg.Server,
+		token:  cfg.Token,
+		http:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// apiError is the error body of the API
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// do sends a request with body encoded as JSON and decodes the JSON reply
+// into out, returning the response with its body consumed
+func (c *client) do(method, path string, body, out any) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(data)
+	}
+
+	resp, data, err := c.send(method, path, r)
+	if err != nil {
+		return nil, err
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return nil, fmt.Errorf("unexpected reply from %s: %w", c.server, err)
+		}
+	}
+	return resp, nil
+}
+
+// send makes a request and returns the response and its body, turning
+// error statuses into errors
+func (c *client) send(method, path string, body io.Reader) (*http.Response, []byte, error) {
+	req, err := http.NewRequest(method, c.server+path, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", "patbin-cli")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.password != "" {
+		req.Header.Set("X-Paste-Password", c.password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if resp.StatusCode >= 400 {
+		var e apiError
+		if json.Unmarshal(data, &e) == nil && e.Error != "" {
+			return nil, nil, errors.New(e.Error)
+		}
+		if msg := strings.TrimSpace(string(data)); msg != "" && len(msg) < 200 {
+			return nil, nil, errors.New(msg)
+		}
+		return nil, nil, errors.New(resp.Status)
+	}
+	return resp, data, nil
+}
+
+// pasteRef is a paste named on the command line
+type pasteRef struct {
+	ID  string
+	Key string // key of an encrypted paste, from the URL fragment
+}
+
+// parseRef reads a paste ID or URL. A URL also points cfg at its server.
+func parseRef(cfg *config, s string) (pasteRef, error) {
+	if !strings.Contains(s, "://") {
+		id, _, _ := strings.Cut(s, ".")
+		if id == "" {
+			return pasteRef{}, fmt.Errorf("invalid paste %q", s)
+		}
+		return pasteRef{ID: id}, nil
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return pasteRef{}, err
+	}
+	segment, _, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	id, _, _ := strings.Cut(segment, ".")
+	if id == "" {
+		return pasteRef{}, fmt.Errorf("no paste in %q", s)
+	}
+	cfg.Server = u.Scheme + "://" + u.Host
+	return pasteRef{ID: id, Key: u.Fragment}, nil
+}
+
+// pasteURL is the link to a paste, with the key of an encrypted one
+func pasteURL(server, id, key string) string {
+	if key != "" {
+		return server + "/" + id + "#" + key
+	}
+	return server + "/" + id
+}
+
+// encrypt seals content under a new key and returns the ciphertext and the
+// key for the URL fragment
+func encrypt(content string) (string, string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", "", err
+	}
+	ciphertext, err := encryptWith(key, content)
+	if err != nil {
+		return "", "", err
+	}
+	return ciphertext, base64.RawURLEncoding.EncodeToString(key), nil
+}
+
+func encryptWith(key []byte, content string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(content), nil)), nil
+}
+
+// decrypt opens ciphertext with the key from a URL fragment
+func decrypt(ciphertext, fragment string) (string, error) {
+	if fragment == "" {
+		return "", errors.New("this paste is encrypted; use its full URL, which holds the key")
+	}
+	key, err := decodeKey(fragment)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return "", errors.New("malformed ciphertext")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("could not decrypt this paste: the key in the URL is wrong")
+	}
+	return string(plain), nil
+}
+
+// decodeKey accepts the key in base64url or standard base64, padded or not
+func decodeKey(fragment string) ([]byte, error) {
+	s := strings.NewReplacer("-", "+", "_", "/").Replace(strings.TrimRight(fragment, "="))
+	key, err := base64.RawStdEncoding.DecodeString(s)
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("invalid key in the URL")
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
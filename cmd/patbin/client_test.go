@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseRef(t *testing.T) {
+	tests := []struct {
+		in, id, key, server string
+	}{
+		{"abc123", "abc123", "", "http://default"},
+		{"abc123.go", "abc123", "", "http://default"},
+		{"https://paste.example.com/abc123", "abc123", "", "https://paste.example.com"},
+		{"https://paste.example.com/abc123/raw#k3y", "abc123", "k3y", "https://paste.example.com"},
+	}
+	for _, tt := range tests {
+		cfg := &config{Server: "http://default"}
+		ref, err := parseRef(cfg, tt.in)
+		if err != nil {
+			t.Errorf("parseRef(%q): %v", tt.in, err)
+			continue
+		}
+		if ref.ID != tt.id || ref.Key != tt.key || cfg.Server != tt.server {
+			t.Errorf("parseRef(%q) = %+v on %s, want %s#%s on %s", tt.in, ref, cfg.Server, tt.id, tt.key, tt.server)
+		}
+	}
+	for _, in := range []string{"", ".go", "https://paste.example.com/"} {
+		if _, err := parseRef(&config{}, in); err == nil {
+			t.Errorf("parseRef(%q) should fail", in)
+		}
+	}
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	ciphertext, key, err := encrypt("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := base64.StdEncoding.DecodeString(ciphertext); len(data) < 12+16 {
+		t.Errorf("ciphertext of %d bytes is missing the nonce or tag", len(data))
+	}
+	if plain, err := decrypt(ciphertext, key); err != nil || plain != "secret" {
+		t.Errorf("decrypt = %q, %v", plain, err)
+	}
+
+	// The key is accepted padded and in standard base64 too
+	std := strings.NewReplacer("-", "+", "_", "/").Replace(key) + "="
+	if plain, err := decrypt(ciphertext, std); err != nil || plain != "secret" {
+		t.Errorf("decrypt with standard base64 key = %q, %v", plain, err)
+	}
+
+	_, other, _ := encrypt("")
+	if _, err := decrypt(ciphertext, other); err == nil {
+		t.Error("decrypting with another key should fail")
+	}
+	if _, err := decrypt(ciphertext, ""); err == nil {
+		t.Error("decrypting without a key should fail")
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	var got *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		switch r.URL.Path {
+		case "/api/json":
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error":"Insufficient scope"}`))
+		case "/api/text":
+			http.Error(w, "Paste not found", http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	c := newClient(&config{Server: srv.URL, Token: "pb_x"})
+	c.password = "hunter2"
+	for path, want := range map[string]string{
+		"/api/json":  "Insufficient scope",
+		"/api/text":  "Paste not found",
+		"/api/empty": "502 Bad Gateway",
+	} {
+		if _, err := c.do(http.MethodGet, path, nil, nil); err == nil || err.Error() != want {
+			t.Errorf("%s: error %v, want %q", path, err, want)
+		}
+	}
+	if got.Header.Get("Authorization") != "Bearer pb_x" || got.Header.Get("X-Paste-Password") != "hunter2" {
+		t.Errorf("request headers %v", got.Header)
+	}
+}
@@ -0,0 +1,621 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"patbin/models"
+)
+
+var stdin = bufio.NewReader(os.Stdin)
+
+type fileRequest struct {
+	Filename string `json:"filename"`
+	Content  string `json:"content"`
+	Language string `json:"language,omitempty"`
+}
+
+type createRequest struct {
+	Title         string        `json:"title,omitempty"`
+	Content       string        `json:"content,omitempty"`
+	Language      string        `json:"language,omitempty"`
+	Filename      string        `json:"filename,omitempty"`
+	Visibility    string        `json:"visibility,omitempty"`
+	ExpiresIn     string        `json:"expires_in,omitempty"`
+	BurnAfterRead bool          `json:"burn_after_read,omitempty"`
+	Encryption    string        `json:"encryption,omitempty"`
+	Password      string        `json:"password,omitempty"`
+	Files         []fileRequest `json:"files,omitempty"`
+	Tags          []string      `json:"tags,omitempty"`
+	Org           string        `json:"org,omitempty"`
+}
+
+type updateRequest struct {
+	Content string        `json:"content,omitempty"`
+	Files   []fileRequest `json:"files,omitempty"`
+}
+
+// languageFor picks the language of a file from its extension, leaving
+// unknown ones for the server to detect
+func languageFor(filename string) string {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+	if ext == "" {
+		return ""
+	}
+	if lang := models.GetLanguageFromExtension(ext); lang != "plaintext" {
+		return lang
+	}
+	return ""
+}
+
+// oneRef parses the single paste argument of a command
+func oneRef(cfg *config, fs *flag.FlagSet, max int) (pasteRef, error) {
+	if fs.NArg() < 1 || fs.NArg() > max {
+		fs.Usage()
+		os.Exit(2)
+	}
+	return parseRef(cfg, fs.Arg(0))
+}
+
+func tagList(tags []models.Tag) string {
+	names := make([]string, len(tags))
+	for i, t := range tags {
+		names[i] = t.Name
+	}
+	return strings.Join(names, ",")
+}
+
+func requireLogin(c *client) error {
+	if c.token == "" {
+		return errors.New(`not logged in, run "patbin login" first`)
+	}
+	return nil
+}
+
+func cmdCreate(cfg *config, args []string) error {
+	fs := flag.NewFlagSet("create", flag.ExitOnError)
+	title := fs.String("title", "", "title of the paste (default the file name)")
+	lang := fs.String("lang", "", "language (default from the file extension, or detected)")
+	expires := fs.String("expires", "never", "expire after 1h, 1d, 1w, 1m or never")
+	burn := fs.Bool("burn", false, "delete the paste once it has been read")
+	visibility := fs.String("visibility", "public", "public, unlisted (only reachable by its URL) or private (only you)")
+	password := fs.String("password", "", "password readers must give")
+	encryptFlag := fs.Bool("encrypt", false, "encrypt the paste; the key is only in the printed URL")
+	tags := fs.String("tags", "", "comma-separated tags")
+	org := fs.String("org", "", "organization to own the paste, instead of you")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: patbin create [flags] [file...]\n\nReads stdin when no file, or -, is given.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	req := createRequest{
+		Title:         *title,
+		Language:      *lang,
+		Visibility:    *visibility,
+		ExpiresIn:     *expires,
+		BurnAfterRead: *burn,
+		Password:      *password,
+		Tags:          strings.FieldsFunc(*tags, func(r rune) bool { return r == ',' || r == ' ' }),
+		Org:           *org,
+	}
+
+	paths := fs.Args()
+	switch {
+	case len(paths) == 0 || (len(paths) == 1 && paths[0] == "-"):
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return err
+		}
+		req.Content = string(data)
+	case len(paths) == 1:
+		data, err := os.ReadFile(paths[0])
+		if err != nil {
+			return err
+		}
+		name := filepath.Base(paths[0])
+		req.Content, req.Filename = string(data), name
+		if req.Title == "" {
+			req.Title = name
+		}
+		if req.Language == "" {
+			req.Language = languageFor(name)
+		}
+	default:
+		for _, path := range paths {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			name := filepath.Base(path)
+			req.Files = append(req.Files, fileRequest{Filename: name, Content: string(data), Language: languageFor(name)})
+		}
+	}
+	if req.Content == "" && len(req.Files) == 0 {
+		return errors.New("nothing to paste")
+	}
+
+	key := ""
+	if *encryptFlag {
+		if len(req.Files) > 0 {
+			return errors.New("encrypted pastes can't have multiple files")
+		}
+		var err error
+		if req.Content, key, err = encrypt(req.Content); err != nil {
+			return err
+		}
+		req.Encryption, req.Filename = cipherAESGCM, ""
+	}
+
+	c := newClient(cfg)
+	var paste models.Paste
+	if _, err := c.do("POST", "/api/paste", req, &paste); err != nil {
+		return err
+	}
+	fmt.Println(pasteURL(c.server, paste.ID, key))
+	return nil
+}
+
+func cmdGet(cfg *config, args []string) error {
+	fs := flag.NewFlagSet("get", flag.ExitOnError)
+	password := fs.String("password", "", "password of a protected paste")
+	asJSON := fs.Bool("json", false, "print the paste as JSON, as the API returns it")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: patbin get [flags] <paste>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	ref, err := oneRef(cfg, fs, 1)
+	if err != nil {
+		return err
+	}
+
+	c := newClient(cfg)
+	c.password = *password
+	if *asJSON {
+		_, data, err := c.send("GET", "/api/paste/"+ref.ID, nil)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(append(data, '\n'))
+		return err
+	}
+
+	var paste models.Paste
+	if _, err := c.do("GET", "/api/paste/"+ref.ID, nil, &paste); err != nil {
+		return err
+	}
+	if paste.Encryption != "" {
+		if paste.Content, err = decrypt(paste.Content, ref.Key); err != nil {
+			return err
+		}
+	}
+
+	title := paste.Title
+	if title == "" {
+		title = "Untitled"
+	}
+	details := []string{paste.Language, fmt.Sprintf("%d views", paste.Views), fmt.Sprintf("%d stars", paste.Stars), "created " + paste.CreatedAt.Local().Format("2006-01-02 15:04")}
+	if paste.ExpiresAt != nil {
+		details = append(details, "expires "+paste.ExpiresAt.Local().Format("2006-01-02 15:04"))
+	}
+	if paste.BurnAfterRead {
+		details = append(details, "burned after this read")
+	}
+	if paste.Encryption != "" {
+		details = append(details, "encrypted")
+	}
+	if paste.Org != nil {
+		details = append(details, "owned by "+paste.Org.Name)
+	}
+	if len(paste.Tags) > 0 {
+		details = append(details, "tagged "+tagList(paste.Tags))
+	}
+	fmt.Printf("%s\n%s\n\n", title, strings.Join(details, " · "))
+
+	if len(paste.Files) < 2 {
+		fmt.Print(withNewline(paste.Content))
+		return nil
+	}
+	for i, f := range paste.Files {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("==> %s <==\n%s", f.Filename, withNewline(f.Content))
+	}
+	return nil
+}
+
+func withNewline(s string) string {
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		return s + "\n"
+	}
+	return s
+}
+
+func cmdRaw(cfg *config, args []string) error {
+	fs := flag.NewFlagSet("raw", flag.ExitOnError)
+	password := fs.String("password", "", "password of a protected paste")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: patbin raw [flags] <paste> [file]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	ref, err := oneRef(cfg, fs, 2)
+	if err != nil {
+		return err
+	}
+
+	path := "/" + ref.ID + "/raw"
+	if fs.NArg() == 2 {
+		path += "/" + url.PathEscape(fs.Arg(1))
+	}
+
+	c := newClient(cfg)
+	c.password = *password
+	resp, data, err := c.send("GET", path, nil)
+	if err != nil {
+		return err
+	}
+	if resp.Header.Get("X-Paste-Encryption") != "" {
+		plain, err := decrypt(string(data), ref.Key)
+		if err != nil {
+			return err
+		}
+		data = []byte(plain)
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+func cmdEdit(cfg *config, args []string) error {
+	fs := flag.NewFlagSet("edit", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: patbin edit <paste> [file]\n\nOpens the paste, or one file of it, in $VISUAL or $EDITOR and saves it when changed.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	ref, err := oneRef(cfg, fs, 2)
+	if err != nil {
+		return err
+	}
+
+	c := newClient(cfg)
+	if err := requireLogin(c); err != nil {
+		return err
+	}
+	// Loaded for editing, so that a burn-after-read paste survives
+	var paste models.Paste
+	if _, err := c.do("GET", "/api/paste/"+ref.ID+"/edit", nil, &paste); err != nil {
+		return err
+	}
+
+	// The file to edit: the one named, or the paste itself
+	content, filename, index := paste.Content, "", -1
+	if fs.NArg() == 2 {
+		for i, f := range paste.Files {
+			if f.Filename == fs.Arg(1) {
+				content, filename, index = f.Content, f.Filename, i
+			}
+		}
+		if index < 0 {
+			return fmt.Errorf("paste %s has no file %q", ref.ID, fs.Arg(1))
+		}
+	} else if len(paste.Files) > 0 {
+		filename = paste.Files[0].Filename
+	}
+
+	var key []byte
+	if paste.Encryption != "" {
+		if content, err = decrypt(content, ref.Key); err != nil {
+			return err
+		}
+		if key, err = decodeKey(ref.Key); err != nil {
+			return err
+		}
+	}
+
+	ext := filepath.Ext(filename)
+	if ext == "" {
+		ext = "." + models.GetExtensionFromLanguage(paste.Language)
+	}
+	edited, err := editText(content, ext)
+	if err != nil {
+		return err
+	}
+	if edited == content {
+		fmt.Fprintln(os.Stderr, "No changes")
+		return nil
+	}
+	if edited == "" {
+		return errors.New("not saving an empty paste")
+	}
+
+	if key != nil {
+		if edited, err = encryptWith(key, edited); err != nil {
+			return err
+		}
+	}
+
+	req := updateRequest{Content: edited}
+	if index >= 0 {
+		req.Content = ""
+		for i, f := range paste.Files {
+			if i == index {
+				f.Content = edited
+			}
+			req.Files = append(req.Files, fileRequest{Filename: f.Filename, Content: f.Content, Language: f.Language})
+		}
+	}
+	if _, err := c.do("PUT", "/api/paste/"+ref.ID, req, nil); err != nil {
+		return err
+	}
+	fmt.Println(pasteURL(c.server, ref.ID, ref.Key))
+	return nil
+}
+
+// editText lets the user edit text in their editor, in a temporary file
+// named with ext so the editor can highlight it
+func editText(text, ext string) (string, error) {
+	f, err := os.CreateTemp("", "patbin-*"+ext)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(text)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	parts := strings.Fields(editor)
+	cmd := exec.Command(parts[0], append(parts[1:], f.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor: %w", err)
+	}
+
+	data, err := os.ReadFile(f.Name())
+	return string(data), err
+}
+
+func cmdDelete(cfg *config, args []string) error {
+	fs := flag.NewFlagSet("delete", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintln(os.Stderr, "Usage: patbin delete <paste>") }
+	fs.Parse(args)
+	ref, err := oneRef(cfg, fs, 1)
+	if err != nil {
+		return err
+	}
+
+	c := newClient(cfg)
+	if err := requireLogin(c); err != nil {
+		return err
+	}
+	if _, err := c.do("DELETE", "/api/paste/"+ref.ID, nil, nil); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "Deleted", ref.ID)
+	return nil
+}
+
+func cmdFork(cfg *config, args []string) error {
+	fs := flag.NewFlagSet("fork", flag.ExitOnError)
+	password := fs.String("password", "", "password of a protected paste")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: patbin fork [flags] <paste>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	ref, err := oneRef(cfg, fs, 1)
+	if err != nil {
+		return err
+	}
+
+	c := newClient(cfg)
+	c.password = *password
+	var fork models.Paste
+	if _, err := c.do("POST", "/api/paste/"+ref.ID+"/fork", nil, &fork); err != nil {
+		return err
+	}
+	// A fork of an encrypted paste holds the same ciphertext, so the key
+	// carries over
+	fmt.Println(pasteURL(c.server, fork.ID, ref.Key))
+	return nil
+}
+
+func cmdList(cfg *config, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	sort := fs.String("sort", "created", "sort by created, updated, views, stars or title")
+	order := fs.String("order", "", "asc or desc (default desc, or asc for title)")
+	limit := fs.Int("limit", 20, "pastes per page, up to 100")
+	cursor := fs.String("cursor", "", "page to show, as printed after the previous one")
+	tag := fs.String("tag", "", "only list pastes with this tag")
+	org := fs.String("org", "", "list the pastes of this organization instead")
+	starred := fs.Bool("starred", false, "list the pastes you starred instead")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: patbin list [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	c := newClient(cfg)
+	if err := requireLogin(c); err != nil {
+		return err
+	}
+	query := url.Values{"sort": {*sort}, "limit": {strconv.Itoa(*limit)}}
+	if *order != "" {
+		query.Set("order", *order)
+	}
+	if *cursor != "" {
+		query.Set("cursor", *cursor)
+	}
+	if *tag != "" {
+		query.Set("tag", *tag)
+	}
+	path := "/api/dashboard"
+	if *org != "" {
+		if *tag != "" {
+			return errors.New("-tag and -org can't be combined")
+		}
+		path = "/api/org/" + url.PathEscape(*org)
+	}
+	if *starred {
+		if *org != "" {
+			return errors.New("-starred and -org can't be combined")
+		}
+		query.Set("tab", "starred")
+	}
+	var dashboard struct {
+		Pastes     []models.Paste `json:"pastes"`
+		NextCursor string         `json:"next_cursor"`
+	}
+	if _, err := c.do("GET", path+"?"+query.Encode(), nil, &dashboard); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTITLE\tLANGUAGE\tVISIBILITY\tVIEWS\tSTARS\tCREATED\tTAGS")
+	for _, p := range dashboard.Pastes {
+		title := p.Title
+		if title == "" {
+			title = "Untitled"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\n", p.ID, title, p.Language, p.Visibility, p.Views, p.Stars, p.CreatedAt.Local().Format("2006-01-02 15:04"), tagList(p.Tags))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	// On stderr, so the listing itself stays easy to pipe
+	if dashboard.NextCursor != "" {
+		fmt.Fprintf(os.Stderr, "\nMore pastes: repeat with -cursor %s\n", dashboard.NextCursor)
+	}
+	return nil
+}
+
+func cmdLogin(cfg *config, args []string) error {
+	fs := flag.NewFlagSet("login", flag.ExitOnError)
+	username := fs.String("username", "", "account to log in as (prompted for when empty)")
+	token := fs.String("token", "", "store this API token, made on the dashboard, instead of logging in")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: patbin login [flags]\n\nLogs in and stores a new API token for this machine.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	c := newClient(cfg)
+	var user models.User
+	if *token != "" {
+		c.token = *token
+		if _, err := c.do("GET", "/api/auth/me", nil, &user); err != nil {
+			return err
+		}
+	} else {
+		var err error
+		if *username == "" {
+			if *username, err = prompt("Username: "); err != nil {
+				return err
+			}
+		}
+		password, err := readPassword("Password: ")
+		if err != nil {
+			return err
+		}
+
+		var login struct {
+			Token string      `json:"token"`
+			User  models.User `json:"user"`
+		}
+		c.token = ""
+		body := map[string]string{"username": *username, "password": password}
+		if _, err := c.do("POST", "/api/auth/login", body, &login); err != nil {
+			return err
+		}
+		user = login.User
+
+		// Trade the short-lived login for a token of our own, then end the
+		// login session
+		c.token = login.Token
+		hostname, _ := os.Hostname()
+		var created struct {
+			Token string `json:"token"`
+		}
+		req := map[string]any{
+			"name":       strings.TrimSpace("patbin CLI " + hostname),
+			"scopes":     models.TokenScopes,
+			"expires_in": "1y",
+		}
+		if _, err := c.do("POST", "/api/tokens", req, &created); err != nil {
+			return err
+		}
+		c.do("POST", "/api/auth/logout", nil, nil)
+		c.token = created.Token
+	}
+
+	cfg.Token = c.token
+	path, err := saveConfig(cfg)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Logged in to %s as %s; token saved to %s\n", cfg.Server, user.Username, path)
+	return nil
+}
+
+func cmdLogout(cfg *config, args []string) error {
+	fs := flag.NewFlagSet("logout", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintln(os.Stderr, "Usage: patbin logout") }
+	fs.Parse(args)
+
+	cfg.Token = ""
+	if _, err := saveConfig(cfg); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "Token forgotten; revoke it from the dashboard to disable it")
+	return nil
+}
+
+func prompt(label string) (string, error) {
+	fmt.Fprint(os.Stderr, label)
+	line, err := stdin.ReadString('\n')
+	if err != nil && (line == "" || !errors.Is(err, io.EOF)) {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readPassword prompts for a password, keeping it off the screen where
+// stty is available
+func readPassword(label string) (string, error) {
+	stty := func(arg string) error {
+		cmd := exec.Command("stty", arg)
+		cmd.Stdin = os.Stdin
+		cmd.Stderr = io.Discard
+		return cmd.Run()
+	}
+	if stty("-echo") == nil {
+		defer func() {
+			stty("echo")
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+	return prompt(label)
+}
@@ -0,0 +1,145 @@
+// Command patbin is a command-line client for a Patbin server:
+//
+//	ls -la | patbin create
+//	patbin create -lang go main.go
+//	patbin raw abc123
+//	patbin login
+//
+// Run patbin without arguments for the list of commands.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const defaultServer = "http://localhost:8080"
+
+const usage = `Usage: patbin [-server URL] <command> [flags] [args]
+
+Commands:
+  create [file...]      Create a paste from files, or from stdin
+  get <paste>           Show a paste and its details
+  raw <paste> [file]    Print the raw content of a paste or one of its files
+  edit <paste> [file]   Edit a paste in $EDITOR
+  delete <paste>        Delete a paste
+  fork <paste>          Fork a paste
+  list                  List your pastes, the ones you starred, or an organization's
+  login                 Log in and store an API token
+  logout                Forget the stored API token
+
+A paste is given by its ID or URL; the URL of an encrypted paste carries
+the key needed to read it. Run "patbin <command> -h" for its flags.
+
+The server and token can also be set with PATBIN_SERVER and PATBIN_TOKEN.
+`
+
+// config is what the CLI remembers between runs
+type config struct {
+	Server string `json:"server,omitempty"`
+	Token  string `json:"token,omitempty"`
+}
+
+func configPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "patbin", "config.json"), nil
+}
+
+func loadConfig() (*config, error) {
+	cfg := &config{}
+	path, err := configPath()
+	if err != nil {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// saveConfig writes cfg where only the user can read it, since it holds
+// the token
+func saveConfig(cfg *config) (string, error) {
+	path, err := configPath()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return path, os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	server := flag.String("server", "", "Patbin server URL (default "+defaultServer+")")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fatal(err)
+	}
+	if token := os.Getenv("PATBIN_TOKEN"); token != "" {
+		cfg.Token = token
+	}
+	switch {
+	case *server != "":
+		cfg.Server = *server
+	case os.Getenv("PATBIN_SERVER") != "":
+		cfg.Server = os.Getenv("PATBIN_SERVER")
+	case cfg.Server == "":
+		cfg.Server = defaultServer
+	}
+	cfg.Server = strings.TrimRight(cfg.Server, "/")
+
+	commands := map[string]func(*config, []string) error{
+		"create": cmdCreate,
+		"get":    cmdGet,
+		"raw":    cmdRaw,
+		"edit":   cmdEdit,
+		"delete": cmdDelete,
+		"fork":   cmdFork,
+		"list":   cmdList,
+		"login":  cmdLogin,
+		"logout": cmdLogout,
+	}
+	name, args := flag.Arg(0), flag.Args()[1:]
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "patbin: unknown command %q\n\n", name)
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := cmd(cfg, args); err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "patbin:", err)
+	os.Exit(1)
+}
@@ -2,13 +2,81 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// Rate is a token-bucket budget: bursts of up to Requests, refilled at
+// Requests per Per. A zero Rate doesn't limit.
+type Rate struct {
+	Requests int
+	Per      time.Duration
+}
+
+// parseRate reads a rate written as "requests/period", e.g. "30/1m", with
+// "0" turning the limit off
+func parseRate(s string, def Rate) Rate {
+	if s == "" {
+		return def
+	}
+	if s == "0" || s == "off" {
+		return Rate{}
+	}
+	n, per, ok := strings.Cut(s, "/")
+	requests, err := strconv.Atoi(n)
+	if !ok || err != nil || requests <= 0 {
+		return def
+	}
+	period, err := time.ParseDuration(per)
+	if err != nil || period <= 0 {
+		return def
+	}
+	return Rate{Requests: requests, Per: period}
+}
+
 type Config struct {
 	Port       string
 	JWTSecret  string
 	DBPath     string
 	CookieName string
+
+	// Logins hand out access tokens valid for AccessTokenTTL and a refresh
+	// token, replaced on every use, that keeps the session alive for
+	// SessionTTL after its last refresh
+	RefreshCookieName string
+	AccessTokenTTL    time.Duration
+	SessionTTL        time.Duration
+
+	// Rate limits, counted per IP for anonymous requests and per user for
+	// logged-in ones: creating pastes, logging in and registering, raw and
+	// ZIP downloads, and diffs
+	RateCreateAnon Rate
+	RateCreateUser Rate
+	RateLogin      Rate
+	RateRaw        Rate
+	RateDiff       Rate
+
+	// TrustedProxies are the addresses or CIDRs of the reverse proxies whose
+	// X-Forwarded-For header names the client. Without any, the client is
+	// whoever connected, and forwarded headers are ignored.
+	TrustedProxies []string
+
+	// Expired and burned pastes are purged every SweepInterval,
+	// SweepBatchSize rows at a time
+	SweepInterval  time.Duration
+	SweepBatchSize int
+
+	// StorageBackend is where new paste content goes: "inline" (the pastes
+	// table), "db", "fs" or "s3"
+	StorageBackend string
+	StorageDir     string
+	S3Endpoint     string
+	S3Region       string
+	S3Bucket       string
+	S3AccessKey    string
+	S3SecretKey    string
+	S3PathStyle    bool
 }
 
 func Load() *Config {
@@ -27,10 +95,71 @@ func Load() *Config {
 		dbPath = "patbin.db"
 	}
 
+	accessTokenTTL, err := time.ParseDuration(os.Getenv("ACCESS_TOKEN_TTL"))
+	if err != nil || accessTokenTTL <= 0 {
+		accessTokenTTL = 15 * time.Minute
+	}
+
+	sessionTTL, err := time.ParseDuration(os.Getenv("SESSION_TTL"))
+	if err != nil || sessionTTL <= 0 {
+		sessionTTL = 7 * 24 * time.Hour
+	}
+
+	sweepInterval, err := time.ParseDuration(os.Getenv("SWEEP_INTERVAL"))
+	if err != nil || sweepInterval <= 0 {
+		sweepInterval = 5 * time.Minute
+	}
+
+	sweepBatchSize, err := strconv.Atoi(os.Getenv("SWEEP_BATCH_SIZE"))
+	if err != nil || sweepBatchSize <= 0 {
+		sweepBatchSize = 100
+	}
+
+	storageBackend := os.Getenv("STORAGE_BACKEND")
+	if storageBackend == "" {
+		storageBackend = "inline"
+	}
+
+	storageDir := os.Getenv("STORAGE_DIR")
+	if storageDir == "" {
+		storageDir = "data/objects"
+	}
+
+	var trustedProxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
+
+	s3PathStyle, err := strconv.ParseBool(os.Getenv("S3_PATH_STYLE"))
+	if err != nil {
+		s3PathStyle = true
+	}
+
 	return &Config{
-		Port:       port,
-		JWTSecret:  jwtSecret,
-		DBPath:     dbPath,
-		CookieName: "patbin_token",
+		Port:              port,
+		JWTSecret:         jwtSecret,
+		DBPath:            dbPath,
+		CookieName:        "patbin_token",
+		RefreshCookieName: "patbin_refresh",
+		AccessTokenTTL:    accessTokenTTL,
+		SessionTTL:        sessionTTL,
+		RateCreateAnon:    parseRate(os.Getenv("RATE_LIMIT_CREATE_ANON"), Rate{10, time.Minute}),
+		RateCreateUser:    parseRate(os.Getenv("RATE_LIMIT_CREATE_USER"), Rate{60, time.Minute}),
+		RateLogin:         parseRate(os.Getenv("RATE_LIMIT_LOGIN"), Rate{10, 5 * time.Minute}),
+		RateRaw:           parseRate(os.Getenv("RATE_LIMIT_RAW"), Rate{120, time.Minute}),
+		RateDiff:          parseRate(os.Getenv("RATE_LIMIT_DIFF"), Rate{30, time.Minute}),
+		TrustedProxies:    trustedProxies,
+		SweepInterval:     sweepInterval,
+		SweepBatchSize:    sweepBatchSize,
+		StorageBackend:    storageBackend,
+		StorageDir:        storageDir,
+		S3Endpoint:        os.Getenv("S3_ENDPOINT"),
+		S3Region:          os.Getenv("S3_REGION"),
+		S3Bucket:          os.Getenv("S3_BUCKET"),
+		S3AccessKey:       os.Getenv("S3_ACCESS_KEY"),
+		S3SecretKey:       os.Getenv("S3_SECRET_KEY"),
+		S3PathStyle:       s3PathStyle,
 	}
 }
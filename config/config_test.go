@@ -0,0 +1,41 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	def := Rate{10, time.Minute}
+	tests := []struct {
+		in   string
+		want Rate
+	}{
+		{"", def},
+		{"30/1m", Rate{30, time.Minute}},
+		{"5/10s", Rate{5, 10 * time.Second}},
+		{"0", Rate{}},
+		{"off", Rate{}},
+		{"30", def},
+		{"-1/1m", def},
+		{"30/soon", def},
+		{"30/0s", def},
+	}
+	for _, tt := range tests {
+		if got := parseRate(tt.in, def); got != tt.want {
+			t.Errorf("parseRate(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "")
+	if got := Load().TrustedProxies; got != nil {
+		t.Errorf("unset: %v, want none", got)
+	}
+	t.Setenv("TRUSTED_PROXIES", " 10.0.0.1, 192.168.0.0/16,,")
+	got := Load().TrustedProxies
+	if len(got) != 2 || got[0] != "10.0.0.1" || got[1] != "192.168.0.0/16" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,259 @@
+package database
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+
+	"patbin/models"
+	"patbin/storage"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Paste, revision and file bodies are stored as blobs keyed by the SHA-256
+// of their content, so a fork or an unchanged file costs a reference rather
+// than a copy. Rows pointing at a blob keep an empty content column.
+
+const compressionGzip = "gzip"
+
+// blobLocks serialize work on a blob between the writers taking references
+// and the purge deleting it, so a blob is never deleted from its backend
+// while a new reference to it is being taken
+var blobLocks [64]sync.Mutex
+
+func lockBlob(hash string) func() {
+	n, _ := strconv.ParseUint(hash[:4], 16, 16)
+	mu := &blobLocks[n%uint64(len(blobLocks))]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// blobKey names the object of a blob in a storage backend
+func blobKey(hash string) string {
+	return "blobs/" + hash[:2] + "/" + hash
+}
+
+func hashContent(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// compress gzips content, keeping it as is when that doesn't make it smaller
+func compress(content string) ([]byte, string) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(content))
+	zw.Close()
+	if buf.Len() >= len(content) {
+		return []byte(content), ""
+	}
+	return buf.Bytes(), compressionGzip
+}
+
+func decompress(data []byte, compression string) (string, error) {
+	if compression == "" {
+		return string(data), nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	out, err := io.ReadAll(zr)
+	return string(out), err
+}
+
+// defaultBackend is the backend new blobs are written to
+func defaultBackend() string {
+	if storageCfg == nil {
+		return storage.Inline
+	}
+	return storageCfg.StorageBackend
+}
+
+// acquireBlob takes a reference to the blob holding content, creating it
+// for backend if no such blob exists yet, and returns its hash. New blobs
+// are kept in their row until FlushBlobs copies them out after tx commits,
+// so a transaction that rolls back leaves no stray object in a backend.
+func acquireBlob(tx *gorm.DB, backend, content string) (string, error) {
+	hash := hashContent(content)
+	defer lockBlob(hash)()
+
+	var count int64
+	if err := tx.Model(&models.Blob{}).Where("hash = ?", hash).Count(&count).Error; err != nil {
+		return "", err
+	}
+	if count > 0 {
+		return hash, tx.Model(&models.Blob{}).Where("hash = ?", hash).
+			UpdateColumn("ref_count", gorm.Expr("ref_count + 1")).Error
+	}
+
+	data, compression := compress(content)
+	blob := models.Blob{
+		Hash:        hash,
+		Backend:     storage.Inline,
+		Data:        data,
+		Compression: compression,
+		Size:        len(content),
+		StoredSize:  len(data),
+		RefCount:    1,
+	}
+	if backend != storage.Inline {
+		blob.Pending = backend
+	}
+
+	// Another transaction may have created the blob since we looked
+	return hash, tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "hash"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"ref_count": gorm.Expr("blobs.ref_count + 1")}),
+	}).Create(&blob).Error
+}
+
+// FlushBlobs copies blobs created by committed transactions out to their
+// backends, batchSize at a time, and returns how many it copied. A blob
+// that fails to copy stays readable in its row until the next attempt.
+func FlushBlobs(ctx context.Context, batchSize int) (int, error) {
+	flushed := 0
+	for {
+		var batch []models.Blob
+		err := DB.WithContext(ctx).
+			Select("hash", "pending").
+			Where("pending <> ''").
+			Order("hash").
+			Limit(batchSize).
+			Find(&batch).Error
+		if err != nil || len(batch) == 0 {
+			return flushed, err
+		}
+
+		for _, blob := range batch {
+			err := moveBlob(ctx, blob.Hash, storage.Inline, blob.Pending)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				// Purged or moved since the batch was read
+				continue
+			}
+			if err != nil {
+				return flushed, fmt.Errorf("blob %s: %w", blob.Hash, err)
+			}
+			flushed++
+		}
+		if len(batch) < batchSize {
+			return flushed, nil
+		}
+	}
+}
+
+// releaseBlobs drops one reference per occurrence of a hash in hashes.
+// Blobs left without references are removed later by PurgeBlobs.
+func releaseBlobs(tx *gorm.DB, hashes ...string) error {
+	counts := make(map[string]int)
+	for _, hash := range hashes {
+		if hash != "" {
+			counts[hash]++
+		}
+	}
+	for hash, n := range counts {
+		err := tx.Model(&models.Blob{}).Where("hash = ?", hash).
+			UpdateColumn("ref_count", gorm.Expr("ref_count - ?", n)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readBlob returns the content of a blob
+func readBlob(ctx context.Context, hash string) (string, error) {
+	var blob models.Blob
+	if err := DB.WithContext(ctx).Take(&blob, "hash = ?", hash).Error; err != nil {
+		return "", err
+	}
+	data, err := blobData(ctx, &blob)
+	if err != nil {
+		return "", err
+	}
+	return decompress(data, blob.Compression)
+}
+
+// blobData returns the stored, possibly compressed, bytes of a blob
+func blobData(ctx context.Context, blob *models.Blob) ([]byte, error) {
+	if blob.Backend == storage.Inline {
+		return blob.Data, nil
+	}
+	s, err := openStore(blob.Backend)
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, blobKey(blob.Hash))
+}
+
+// PurgeBlobs deletes blobs that nothing refers to any more, batchSize at a
+// time, and returns how many went
+func PurgeBlobs(db *gorm.DB, batchSize int) (int, error) {
+	total := 0
+	for {
+		var hashes []string
+		err := db.Model(&models.Blob{}).
+			Where("ref_count <= 0").
+			Order("hash").
+			Limit(batchSize).
+			Pluck("hash", &hashes).Error
+		if err != nil {
+			return total, err
+		}
+
+		n, err := purgeBlobs(db, hashes...)
+		total += n
+		if err != nil || len(hashes) < batchSize {
+			return total, err
+		}
+	}
+}
+
+// purgeBlobs deletes those of hashes that have no references left
+func purgeBlobs(db *gorm.DB, hashes ...string) (int, error) {
+	purged := 0
+	for _, hash := range hashes {
+		if hash == "" {
+			continue
+		}
+		ok, err := purgeBlob(db, hash)
+		if err != nil {
+			return purged, err
+		}
+		if ok {
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func purgeBlob(db *gorm.DB, hash string) (bool, error) {
+	defer lockBlob(hash)()
+
+	var blob models.Blob
+	err := db.Select("hash", "backend").Take(&blob, "hash = ? AND ref_count <= 0", hash).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	result := db.Where("hash = ? AND ref_count <= 0", hash).Delete(&models.Blob{})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	if blob.Backend != storage.Inline {
+		DeleteContent(db.Statement.Context, blob.Backend, blobKey(hash))
+	}
+	return true, nil
+}
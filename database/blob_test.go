@@ -0,0 +1,192 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"patbin/config"
+	"patbin/models"
+	"patbin/storage"
+
+	"gorm.io/gorm"
+)
+
+// setup opens a fresh database with new content going to backend
+func setup(t *testing.T, backend string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := Init(filepath.Join(dir, "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	storesMu.Lock()
+	stores = map[string]storage.Store{}
+	storesMu.Unlock()
+
+	objects := filepath.Join(dir, "objects")
+	if err := InitStorage(&config.Config{StorageBackend: backend, StorageDir: objects}); err != nil {
+		t.Fatal(err)
+	}
+	return objects
+}
+
+func countObjects(t *testing.T, root string) int {
+	t.Helper()
+	n := 0
+	filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			n++
+		}
+		return nil
+	})
+	var rows int64
+	DB.Model(&models.StorageObject{}).Count(&rows)
+	return n + int(rows)
+}
+
+func TestAcquireBlobRollback(t *testing.T) {
+	for _, backend := range []string{storage.FS, storage.DB} {
+		t.Run(backend, func(t *testing.T) {
+			objects := setup(t, backend)
+			rollback := errors.New("rollback")
+
+			err := DB.Transaction(func(tx *gorm.DB) error {
+				if _, err := acquireBlob(tx, defaultBackend(), "never committed"); err != nil {
+					return err
+				}
+				return rollback
+			})
+			if !errors.Is(err, rollback) {
+				t.Fatalf("transaction: %v", err)
+			}
+			if _, err := FlushBlobs(context.Background(), 10); err != nil {
+				t.Fatal(err)
+			}
+
+			var blobs int64
+			DB.Model(&models.Blob{}).Count(&blobs)
+			if n := countObjects(t, objects); blobs != 0 || n != 0 {
+				t.Errorf("%d blobs and %d objects left behind", blobs, n)
+			}
+		})
+	}
+}
+
+func TestFlushBlobs(t *testing.T) {
+	for _, backend := range []string{storage.FS, storage.DB} {
+		t.Run(backend, func(t *testing.T) {
+			objects := setup(t, backend)
+			ctx := context.Background()
+
+			var hash string
+			err := DB.Transaction(func(tx *gorm.DB) error {
+				var err error
+				hash, err = acquireBlob(tx, defaultBackend(), "hello")
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Readable from its row before it is flushed
+			if content, err := readBlob(ctx, hash); err != nil || content != "hello" {
+				t.Fatalf("readBlob before flush = %q, %v", content, err)
+			}
+			if n := countObjects(t, objects); n != 0 {
+				t.Fatalf("%d objects written before the flush", n)
+			}
+
+			if n, err := FlushBlobs(ctx, 10); err != nil || n != 1 {
+				t.Fatalf("FlushBlobs = %d, %v; want 1", n, err)
+			}
+			var blob models.Blob
+			if err := DB.Take(&blob, "hash = ?", hash).Error; err != nil {
+				t.Fatal(err)
+			}
+			if blob.Backend != backend || blob.Pending != "" || blob.Data != nil {
+				t.Errorf("flushed blob: backend %q, pending %q, %d bytes inline", blob.Backend, blob.Pending, len(blob.Data))
+			}
+			if n := countObjects(t, objects); n != 1 {
+				t.Errorf("%d objects after the flush, want 1", n)
+			}
+			if content, err := readBlob(ctx, hash); err != nil || content != "hello" {
+				t.Errorf("readBlob after flush = %q, %v", content, err)
+			}
+
+			if n, err := FlushBlobs(ctx, 10); err != nil || n != 0 {
+				t.Errorf("second FlushBlobs = %d, %v; want 0", n, err)
+			}
+		})
+	}
+}
+
+func refCount(t *testing.T, content string) int {
+	t.Helper()
+	var blob models.Blob
+	err := DB.Take(&blob, "hash = ?", hashContent(content)).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return -1
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blob.RefCount
+}
+
+func TestBlobDeduplication(t *testing.T) {
+	setup(t, storage.Inline)
+	shared := strings.Repeat("the same log line\n", 100)
+
+	createPaste(t, models.Paste{ID: "one", Content: shared})
+	createPaste(t, models.Paste{ID: "two", Content: "other"}, models.PasteFile{Filename: "log.txt", Content: shared})
+	if n := refCount(t, shared); n != 2 {
+		t.Fatalf("ref count %d, want 2", n)
+	}
+
+	var blob models.Blob
+	DB.Take(&blob, "hash = ?", hashContent(shared))
+	if blob.Compression != compressionGzip || blob.StoredSize >= blob.Size {
+		t.Errorf("repetitive content stored as %q, %d of %d bytes", blob.Compression, blob.StoredSize, blob.Size)
+	}
+
+	var one models.Paste
+	DB.First(&one, "id = ?", "one")
+	if one.Content != "" {
+		t.Error("the pastes row should not hold the content")
+	}
+	if err := LoadContent(context.Background(), &one); err != nil || one.Content != shared {
+		t.Fatalf("LoadContent = %v", err)
+	}
+
+	if err := DeletePaste(DB, &one); err != nil {
+		t.Fatal(err)
+	}
+	if n := refCount(t, shared); n != 1 {
+		t.Fatalf("ref count after one delete %d, want 1", n)
+	}
+
+	var two models.Paste
+	DB.Preload("Files").First(&two, "id = ?", "two")
+	if err := DeletePaste(DB, &two); err != nil {
+		t.Fatal(err)
+	}
+	if n := refCount(t, shared); n != -1 {
+		t.Errorf("blob still there with ref count %d", n)
+	}
+}
+
+func TestCompress(t *testing.T) {
+	for _, content := range []string{"", "x", strings.Repeat("abc", 1000)} {
+		data, compression := compress(content)
+		if content == "x" && compression != "" {
+			t.Error("content that doesn't shrink should be kept as is")
+		}
+		got, err := decompress(data, compression)
+		if err != nil || got != content {
+			t.Errorf("round trip of %d bytes: %v", len(content), err)
+		}
+	}
+}
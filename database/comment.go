@@ -0,0 +1,47 @@
+package database
+
+import (
+	"patbin/models"
+
+	"gorm.io/gorm"
+)
+
+// PasteThreads lists the comment threads of a paste with their replies, in
+// the order of the lines they are on. A revision of 0 lists those of every
+// revision.
+func PasteThreads(pasteID string, revision int) ([]models.Comment, error) {
+	query := DB.Preload("User").
+		Preload("Replies", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("Replies.User").
+		Where("paste_id = ? AND parent_id IS NULL", pasteID)
+	if revision > 0 {
+		query = query.Where("revision = ?", revision)
+	}
+
+	threads := []models.Comment{}
+	err := query.Order("revision, start_line, end_line, id").Find(&threads).Error
+	return threads, err
+}
+
+// ThreadCount is how many comment threads a revision of a paste has
+type ThreadCount struct {
+	Revision int
+	Count    int64
+}
+
+// ThreadCounts counts the comment threads of a paste per revision
+func ThreadCounts(pasteID string) ([]ThreadCount, error) {
+	var counts []ThreadCount
+	err := DB.Model(&models.Comment{}).
+		Select("revision, COUNT(*) AS count").
+		Where("paste_id = ? AND parent_id IS NULL", pasteID).
+		Group("revision").
+		Order("revision").
+		Scan(&counts).Error
+	return counts, err
+}
+
+// DeleteComment removes a comment, and with a thread all its replies
+func DeleteComment(tx *gorm.DB, comment *models.Comment) error {
+	return tx.Where("id = ? OR parent_id = ?", comment.ID, comment.ID).Delete(&models.Comment{}).Error
+}
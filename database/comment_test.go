@@ -0,0 +1,58 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+
+	"patbin/models"
+	"patbin/storage"
+)
+
+func TestCommentThreads(t *testing.T) {
+	setup(t, storage.Inline)
+	user := models.User{Username: "alice", Password: "x"}
+	DB.Create(&user)
+
+	comment := func(parent *uint, revision, line int, body string) models.Comment {
+		t.Helper()
+		c := models.Comment{PasteID: "p", ParentID: parent, Revision: revision, StartLine: line, EndLine: line, UserID: user.ID, Body: body}
+		if err := DB.Create(&c).Error; err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	late := comment(nil, 1, 9, "line 9")
+	early := comment(nil, 1, 2, "line 2")
+	comment(&early.ID, 1, 2, "first reply")
+	comment(&early.ID, 1, 2, "second reply")
+	comment(nil, 2, 1, "on rev 2")
+
+	threads, err := PasteThreads("p", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(threads) != 2 || threads[0].ID != early.ID || threads[1].ID != late.ID {
+		t.Fatalf("threads of rev 1 = %+v, want line 2 then line 9", threads)
+	}
+	if r := threads[0].Replies; len(r) != 2 || r[0].Body != "first reply" || r[1].Body != "second reply" || r[0].User == nil {
+		t.Errorf("replies = %+v", r)
+	}
+	if all, _ := PasteThreads("p", 0); len(all) != 3 {
+		t.Errorf("%d threads over every revision, want 3", len(all))
+	}
+
+	counts, err := ThreadCounts("p")
+	if err != nil || fmt.Sprint(counts) != "[{1 2} {2 1}]" {
+		t.Errorf("ThreadCounts = %v, %v", counts, err)
+	}
+
+	// Deleting a thread takes its replies along
+	if err := DeleteComment(DB, &early); err != nil {
+		t.Fatal(err)
+	}
+	var left int64
+	DB.Model(&models.Comment{}).Count(&left)
+	if left != 2 {
+		t.Errorf("%d comments left, want 2", left)
+	}
+}
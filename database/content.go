@@ -0,0 +1,344 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"patbin/config"
+	"patbin/models"
+	"patbin/storage"
+
+	"gorm.io/gorm"
+)
+
+// Paste content lives in blobs (see blob.go). Pastes written before blobs
+// existed keep their content inline in pastes.content, or in a storage
+// backend under a per-paste key recorded on the row; both stay readable.
+
+var (
+	storageCfg *config.Config
+	storesMu   sync.Mutex
+	stores     = map[string]storage.Store{}
+)
+
+// InitStorage selects the backend that new content is written to. Content
+// already stored elsewhere stays readable from its own backend.
+func InitStorage(cfg *config.Config) error {
+	storageCfg = cfg
+	if cfg.StorageBackend == storage.Inline {
+		return nil
+	}
+	_, err := openStore(cfg.StorageBackend)
+	return err
+}
+
+// openStore returns the store for a backend, opening it on first use
+func openStore(name string) (storage.Store, error) {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+
+	if s, ok := stores[name]; ok {
+		return s, nil
+	}
+	if storageCfg == nil {
+		return nil, fmt.Errorf("storage: backend %q used before InitStorage", name)
+	}
+	s, err := storage.Open(name, storageCfg, DB)
+	if err != nil {
+		return nil, err
+	}
+	stores[name] = s
+	return s, nil
+}
+
+// CreatePaste inserts a paste, storing its content as a blob.
+// paste.Content keeps the content.
+func CreatePaste(tx *gorm.DB, paste *models.Paste) error {
+	hash, err := acquireBlob(tx, defaultBackend(), paste.Content)
+	if err != nil {
+		return err
+	}
+
+	content := paste.Content
+	paste.Content = ""
+	paste.ContentHash = hash
+	paste.ContentBackend = ""
+	paste.ContentKey = ""
+	err = tx.Create(paste).Error
+	paste.Content = content
+	return err
+}
+
+// SetContent stores the new content of a paste as a blob, giving up the
+// reference to the old one, and adds the matching columns to updates.
+// Content still in a legacy object is removed by the caller with
+// DeleteContent once the update is committed.
+func SetContent(tx *gorm.DB, paste *models.Paste, content string, updates map[string]interface{}) error {
+	hash, err := acquireBlob(tx, defaultBackend(), content)
+	if err != nil {
+		return err
+	}
+	if err := releaseBlobs(tx, paste.ContentHash); err != nil {
+		return err
+	}
+	updates["content"] = ""
+	updates["content_hash"] = hash
+	updates["content_backend"] = ""
+	updates["content_key"] = ""
+	return nil
+}
+
+// LoadContent fills in the content of a paste and of its loaded files
+func LoadContent(ctx context.Context, paste *models.Paste) error {
+	switch {
+	case paste.ContentHash != "":
+		content, err := readBlob(ctx, paste.ContentHash)
+		if err != nil {
+			return err
+		}
+		paste.Content = content
+	case paste.ContentKey != "":
+		s, err := openStore(paste.ContentBackend)
+		if err != nil {
+			return err
+		}
+		data, err := s.Get(ctx, paste.ContentKey)
+		if err != nil {
+			return err
+		}
+		paste.Content = string(data)
+	}
+
+	for i := range paste.Files {
+		if err := LoadFileContent(ctx, &paste.Files[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadFileContent fills in the content of one file of a paste
+func LoadFileContent(ctx context.Context, file *models.PasteFile) error {
+	if file.ContentHash == "" {
+		return nil
+	}
+	content, err := readBlob(ctx, file.ContentHash)
+	if err != nil {
+		return err
+	}
+	file.Content = content
+	return nil
+}
+
+// LoadRevisionContent fills in the content of a revision and of its loaded
+// files
+func LoadRevisionContent(ctx context.Context, rev *models.PasteRevision) error {
+	if rev.ContentHash != "" {
+		content, err := readBlob(ctx, rev.ContentHash)
+		if err != nil {
+			return err
+		}
+		rev.Content = content
+	}
+	for i := range rev.Files {
+		content, err := readBlob(ctx, rev.Files[i].ContentHash)
+		if err != nil {
+			return err
+		}
+		rev.Files[i].Content = content
+	}
+	return nil
+}
+
+// DeleteContent removes the stored content of a paste whose row is gone.
+// Failures only leave an orphaned object behind, so they are logged.
+func DeleteContent(ctx context.Context, backend, key string) {
+	if key == "" {
+		return
+	}
+	s, err := openStore(backend)
+	if err == nil {
+		err = s.Delete(ctx, key)
+	}
+	if err != nil {
+		log.Printf("storage: failed to delete %s from %s: %v", key, backend, err)
+	}
+}
+
+// MigrateContent moves the blobs stored in backend from to backend to,
+// batchSize at a time, converting legacy content in from to blobs in to on
+// the way, and returns how many blobs and legacy rows it moved. With from
+// and to both inline only the conversion happens.
+func MigrateContent(ctx context.Context, from, to string, batchSize int) (int, error) {
+	if to != storage.Inline {
+		if _, err := openStore(to); err != nil {
+			return 0, err
+		}
+	}
+
+	moved, err := convertPastes(ctx, from, to, batchSize)
+	if err != nil {
+		return moved, err
+	}
+	if from == storage.Inline {
+		for _, table := range []string{"paste_revisions", "paste_files"} {
+			n, err := convertRows(ctx, table, to, batchSize)
+			moved += n
+			if err != nil {
+				return moved, fmt.Errorf("%s: %w", table, err)
+			}
+		}
+	}
+	// Blobs created by the conversion wait in their rows until flushed
+	if _, err := FlushBlobs(ctx, batchSize); err != nil {
+		return moved, err
+	}
+	if from == to {
+		return moved, nil
+	}
+
+	n, err := moveBlobs(ctx, from, to, batchSize)
+	return moved + n, err
+}
+
+// convertPastes turns the legacy content of pastes stored in from into blobs
+func convertPastes(ctx context.Context, from, to string, batchSize int) (int, error) {
+	fromColumn := from
+	if from == storage.Inline {
+		fromColumn = ""
+	}
+
+	moved := 0
+	for {
+		var batch []models.Paste
+		err := DB.WithContext(ctx).
+			Select("id", "content", "content_hash", "content_backend", "content_key").
+			Where("content_hash = '' AND content_backend = ?", fromColumn).
+			Order("id").
+			Limit(batchSize).
+			Find(&batch).Error
+		if err != nil || len(batch) == 0 {
+			return moved, err
+		}
+
+		for i := range batch {
+			paste := &batch[i]
+			if err := LoadContent(ctx, paste); err != nil {
+				return moved, fmt.Errorf("paste %s: %w", paste.ID, err)
+			}
+			err := DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				hash, err := acquireBlob(tx, to, paste.Content)
+				if err != nil {
+					return err
+				}
+				return tx.Model(&models.Paste{}).Where("id = ?", paste.ID).UpdateColumns(map[string]interface{}{
+					"content":         "",
+					"content_hash":    hash,
+					"content_backend": "",
+					"content_key":     "",
+				}).Error
+			})
+			if err != nil {
+				return moved, fmt.Errorf("paste %s: %w", paste.ID, err)
+			}
+			DeleteContent(ctx, paste.ContentBackend, paste.ContentKey)
+			moved++
+		}
+	}
+}
+
+// convertRows turns the inline content of a revisions or files table into
+// blobs
+func convertRows(ctx context.Context, table, to string, batchSize int) (int, error) {
+	moved := 0
+	for {
+		var batch []struct {
+			ID      uint
+			Content string
+		}
+		err := DB.WithContext(ctx).Table(table).
+			Select("id", "content").
+			Where("content_hash = ''").
+			Order("id").
+			Limit(batchSize).
+			Scan(&batch).Error
+		if err != nil || len(batch) == 0 {
+			return moved, err
+		}
+
+		for _, row := range batch {
+			err := DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				hash, err := acquireBlob(tx, to, row.Content)
+				if err != nil {
+					return err
+				}
+				return tx.Table(table).Where("id = ?", row.ID).UpdateColumns(map[string]interface{}{
+					"content":      "",
+					"content_hash": hash,
+				}).Error
+			})
+			if err != nil {
+				return moved, fmt.Errorf("row %d: %w", row.ID, err)
+			}
+			moved++
+		}
+	}
+}
+
+// moveBlobs copies the blobs stored in from over to to
+func moveBlobs(ctx context.Context, from, to string, batchSize int) (int, error) {
+	moved := 0
+	for {
+		var hashes []string
+		err := DB.WithContext(ctx).Model(&models.Blob{}).
+			Where("backend = ?", from).
+			Order("hash").
+			Limit(batchSize).
+			Pluck("hash", &hashes).Error
+		if err != nil || len(hashes) == 0 {
+			return moved, err
+		}
+
+		for _, hash := range hashes {
+			if err := moveBlob(ctx, hash, from, to); err != nil {
+				return moved, fmt.Errorf("blob %s: %w", hash, err)
+			}
+			moved++
+		}
+	}
+}
+
+func moveBlob(ctx context.Context, hash, from, to string) error {
+	defer lockBlob(hash)()
+
+	var blob models.Blob
+	if err := DB.WithContext(ctx).Take(&blob, "hash = ? AND backend = ?", hash, from).Error; err != nil {
+		return err
+	}
+	data, err := blobData(ctx, &blob)
+	if err != nil {
+		return err
+	}
+
+	columns := map[string]interface{}{"backend": to, "data": nil, "pending": ""}
+	if to == storage.Inline {
+		columns["data"] = data
+	} else {
+		s, err := openStore(to)
+		if err != nil {
+			return err
+		}
+		if err := s.Put(ctx, blobKey(hash), data); err != nil {
+			return err
+		}
+	}
+	if err := DB.WithContext(ctx).Model(&models.Blob{}).Where("hash = ?", hash).UpdateColumns(columns).Error; err != nil {
+		return err
+	}
+	if from != storage.Inline {
+		DeleteContent(ctx, from, blobKey(hash))
+	}
+	return nil
+}
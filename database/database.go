@@ -20,12 +20,33 @@ func Init(dbPath string) error {
 	}
 
 	// Auto migrate models
-	err = DB.AutoMigrate(&models.User{}, &models.Paste{})
+	err = DB.AutoMigrate(&models.User{}, &models.Paste{}, &models.PasteRevision{}, &models.RevisionFile{}, &models.PasteFile{}, &models.StorageObject{}, &models.Blob{}, &models.APIToken{}, &models.Session{}, &models.Tag{}, &models.Collection{}, &models.Org{}, &models.OrgMember{}, &models.Comment{}, &models.Star{})
 	if err != nil {
 		return err
 	}
+	if err := migrateVisibility(DB); err != nil {
+		return err
+	}
+
+	return initSearch(DB)
+}
 
-	return nil
+// migrateVisibility carries the is_public flag of databases made before
+// Visibility over to it, then drops the flag
+func migrateVisibility(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&models.Paste{}, "is_public") {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Private pastes without an owner could never be read by anyone;
+		// whoever made them meant to keep them off the listings
+		err := tx.Exec("UPDATE pastes SET visibility = CASE WHEN user_id IS NULL THEN ? ELSE ? END WHERE is_public = ?",
+			models.VisibilityUnlisted, models.VisibilityPrivate, false).Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec("ALTER TABLE pastes DROP COLUMN is_public").Error
+	})
 }
 
 func GetDB() *gorm.DB {
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"patbin/models"
+
+	"gorm.io/gorm"
+)
+
+// CreateOrg adds an organization with the user creating it as its owner
+func CreateOrg(tx *gorm.DB, org *models.Org, ownerID uint) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.OrgMember{OrgID: org.ID, UserID: ownerID, Role: models.RoleOwner}).Error
+	})
+}
+
+// MemberRole returns the role of a user in an organization, "" when they
+// aren't a member
+func MemberRole(orgID, userID uint) string {
+	var member models.OrgMember
+	if err := DB.Where("org_id = ? AND user_id = ?", orgID, userID).First(&member).Error; err != nil {
+		return ""
+	}
+	return member.Role
+}
+
+// UserOrgs lists the organizations a user is a member of by name, with
+// their role in each
+func UserOrgs(userID uint) ([]models.Org, error) {
+	var rows []struct {
+		models.Org
+		MemberRole string
+	}
+	err := DB.Model(&models.Org{}).
+		Select("orgs.*, org_members.role AS member_role").
+		Joins("JOIN org_members ON org_members.org_id = orgs.id").
+		Where("org_members.user_id = ?", userID).
+		Order("orgs.name").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	orgs := make([]models.Org, len(rows))
+	for i, r := range rows {
+		orgs[i] = r.Org
+		orgs[i].Role = r.MemberRole
+	}
+	return orgs, nil
+}
+
+// OrgMembers lists the members of an organization by username
+func OrgMembers(orgID uint) ([]models.OrgMember, error) {
+	var members []models.OrgMember
+	err := DB.Joins("User").
+		Where("org_members.org_id = ?", orgID).
+		Order("User.username").
+		Find(&members).Error
+	return members, err
+}
+
+// OwnerCount counts the owners of an organization, which must keep one
+func OwnerCount(orgID uint) int64 {
+	var count int64
+	DB.Model(&models.OrgMember{}).Where("org_id = ? AND role = ?", orgID, models.RoleOwner).Count(&count)
+	return count
+}
+
+// MemberOrgs is the subquery of the organizations a user is a member of
+func MemberOrgs(userID uint) *gorm.DB {
+	return DB.Model(&models.OrgMember{}).Select("org_id").Where("user_id = ?", userID)
+}
+
+// EditorOrgs is the subquery of the organizations in which a user may edit
+// pastes, as an owner or an editor
+func EditorOrgs(userID uint) *gorm.DB {
+	return MemberOrgs(userID).Where("role IN ?", []string{models.RoleOwner, models.RoleEditor})
+}
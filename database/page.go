@@ -0,0 +1,149 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"patbin/models"
+
+	"gorm.io/gorm"
+)
+
+// Orders paste listings can be sorted in
+const (
+	SortCreated = "created"
+	SortUpdated = "updated"
+	SortViews   = "views"
+	SortStars   = "stars"
+	SortTitle   = "title"
+)
+
+var sortColumns = map[string]string{
+	SortCreated: "pastes.created_at",
+	SortUpdated: "pastes.updated_at",
+	SortViews:   "pastes.views",
+	SortStars:   "pastes.stars",
+	SortTitle:   "pastes.title",
+}
+
+// ErrInvalidCursor is returned by PastePage for a cursor it didn't issue
+// for the same sort and order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// PageOptions selects one page of a paste listing
+type PageOptions struct {
+	Sort   string // one of the Sort* orders
+	Desc   bool
+	Cursor string // NextCursor of the previous page, empty for the first
+	Limit  int
+}
+
+// ValidSort reports whether sort is an order listings can be sorted in
+func ValidSort(sort string) bool {
+	_, ok := sortColumns[sort]
+	return ok
+}
+
+// pageCursor marks where a page ended: the sort value and ID of its last
+// paste, along with the order it was sorted in
+type pageCursor struct {
+	Sort  string          `json:"s"`
+	Desc  bool            `json:"d"`
+	Value json.RawMessage `json:"v"`
+	ID    string          `json:"id"`
+}
+
+// sortValue is the value of the sort column of a paste
+func sortValue(sort string, paste *models.Paste) any {
+	switch sort {
+	case SortUpdated:
+		return paste.UpdatedAt
+	case SortViews:
+		return paste.Views
+	case SortStars:
+		return paste.Stars
+	case SortTitle:
+		return paste.Title
+	}
+	return paste.CreatedAt
+}
+
+func encodeCursor(opts PageOptions, last *models.Paste) string {
+	value, _ := json.Marshal(sortValue(opts.Sort, last))
+	data, _ := json.Marshal(pageCursor{Sort: opts.Sort, Desc: opts.Desc, Value: value, ID: last.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor returns the sort value and paste ID a cursor for opts
+// points after
+func decodeCursor(opts PageOptions) (any, string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(opts.Cursor)
+	if err != nil {
+		return nil, "", ErrInvalidCursor
+	}
+	var cur pageCursor
+	if err := json.Unmarshal(data, &cur); err != nil || cur.Sort != opts.Sort || cur.Desc != opts.Desc || cur.ID == "" {
+		return nil, "", ErrInvalidCursor
+	}
+
+	var value any
+	switch opts.Sort {
+	case SortCreated, SortUpdated:
+		var t time.Time
+		err = json.Unmarshal(cur.Value, &t)
+		value = t
+	case SortViews, SortStars:
+		var n int
+		err = json.Unmarshal(cur.Value, &n)
+		value = n
+	default:
+		var s string
+		err = json.Unmarshal(cur.Value, &s)
+		value = s
+	}
+	if err != nil {
+		return nil, "", ErrInvalidCursor
+	}
+	return value, cur.ID, nil
+}
+
+// PastePage loads one page of the pastes selected by query, returning the
+// cursor of the next page, or "" on the last one. Pages are cut by the
+// sort value and ID of the last paste rather than an offset, so pastes
+// added meanwhile don't shift them.
+func PastePage(query *gorm.DB, opts PageOptions) ([]models.Paste, string, error) {
+	column, ok := sortColumns[opts.Sort]
+	if !ok {
+		return nil, "", ErrInvalidCursor
+	}
+	dir, cmp := "ASC", ">"
+	if opts.Desc {
+		dir, cmp = "DESC", "<"
+	}
+
+	if opts.Cursor != "" {
+		value, id, err := decodeCursor(opts)
+		if err != nil {
+			return nil, "", err
+		}
+		query = query.Where("("+column+" "+cmp+" ? OR ("+column+" = ? AND pastes.id "+cmp+" ?))", value, value, id)
+	}
+
+	var pastes []models.Paste
+	err := query.Order(column + " " + dir).
+		Order("pastes.id " + dir).
+		Limit(opts.Limit + 1).
+		Find(&pastes).Error
+	if err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if len(pastes) > opts.Limit {
+		pastes = pastes[:opts.Limit]
+		next = encodeCursor(opts, &pastes[len(pastes)-1])
+	}
+	return pastes, next, nil
+}
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"patbin/models"
+	"patbin/storage"
+)
+
+func TestPastePage(t *testing.T) {
+	setup(t, storage.Inline)
+
+	// Ties on every sort but created, so pages have to break them by ID
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var all []models.Paste
+	for i := 0; i < 7; i++ {
+		p := models.Paste{
+			ID:         fmt.Sprintf("p%d", i),
+			Title:      []string{"b", "a"}[i%2],
+			Views:      i % 3,
+			Stars:      i % 2,
+			Visibility: models.VisibilityPublic,
+			CreatedAt:  base.Add(time.Duration(i) * time.Hour),
+			UpdatedAt:  base.Add(time.Duration(i%3) * time.Minute),
+		}
+		if err := DB.Create(&p).Error; err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, p)
+	}
+
+	for sortBy := range sortColumns {
+		for _, desc := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s desc=%v", sortBy, desc), func(t *testing.T) {
+				want := append([]models.Paste(nil), all...)
+				sort.SliceStable(want, func(i, j int) bool {
+					a, b := want[i], want[j]
+					if desc {
+						a, b = b, a
+					}
+					if c := compareSort(sortBy, &a, &b); c != 0 {
+						return c < 0
+					}
+					return a.ID < b.ID
+				})
+
+				var got []string
+				opts := PageOptions{Sort: sortBy, Desc: desc, Limit: 3}
+				for pages := 0; ; pages++ {
+					if pages > len(all) {
+						t.Fatal("pagination doesn't end")
+					}
+					page, next, err := PastePage(DB.Model(&models.Paste{}), opts)
+					if err != nil {
+						t.Fatal(err)
+					}
+					for _, p := range page {
+						got = append(got, p.ID)
+					}
+					if next == "" {
+						break
+					}
+					opts.Cursor = next
+				}
+
+				if fmt.Sprint(got) != fmt.Sprint(ids(want)) {
+					t.Errorf("pages list %v, want %v", got, ids(want))
+				}
+			})
+		}
+	}
+}
+
+func compareSort(sortBy string, a, b *models.Paste) int {
+	switch sortBy {
+	case SortUpdated:
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	case SortViews:
+		return a.Views - b.Views
+	case SortStars:
+		return a.Stars - b.Stars
+	case SortTitle:
+		switch {
+		case a.Title < b.Title:
+			return -1
+		case a.Title > b.Title:
+			return 1
+		}
+		return 0
+	}
+	return a.CreatedAt.Compare(b.CreatedAt)
+}
+
+func ids(pastes []models.Paste) []string {
+	out := make([]string, len(pastes))
+	for i, p := range pastes {
+		out[i] = p.ID
+	}
+	return out
+}
+
+func TestPastePageInvalidCursor(t *testing.T) {
+	setup(t, storage.Inline)
+	cursor := encodeCursor(PageOptions{Sort: SortViews}, &models.Paste{ID: "p1", Views: 3})
+
+	tests := []PageOptions{
+		{Sort: SortViews, Desc: true, Cursor: cursor},
+		{Sort: SortCreated, Cursor: cursor},
+		{Sort: SortViews, Cursor: "not base64!"},
+		{Sort: SortViews, Cursor: "e30"}, // {}
+		{Sort: "nope"},
+	}
+	for _, opts := range tests {
+		if _, _, err := PastePage(DB.Model(&models.Paste{}), opts); err != ErrInvalidCursor {
+			t.Errorf("PastePage(%+v) = %v, want ErrInvalidCursor", opts, err)
+		}
+	}
+	if _, _, err := PastePage(DB.Model(&models.Paste{}), PageOptions{Sort: SortViews, Cursor: cursor, Limit: 5}); err != nil {
+		t.Errorf("matching cursor: %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"patbin/models"
+
+	"gorm.io/gorm"
+)
+
+// NotExpired is a query scope that leaves out pastes past their expiry
+func NotExpired(db *gorm.DB) *gorm.DB {
+	return db.Where("expires_at IS NULL OR expires_at > ?", time.Now())
+}
+
+// SnapshotRevision stores the current state of a paste, every file of it
+// included, as its revision paste.Revision, unless that revision was
+// already recorded
+func SnapshotRevision(tx *gorm.DB, paste *models.Paste) error {
+	var count int64
+	tx.Model(&models.PasteRevision{}).
+		Where("paste_id = ? AND number = ?", paste.ID, paste.Revision).
+		Count(&count)
+	if count > 0 {
+		return nil
+	}
+
+	hash, err := acquireBlob(tx, defaultBackend(), paste.Content)
+	if err != nil {
+		return err
+	}
+	rev := models.PasteRevision{
+		PasteID:     paste.ID,
+		Number:      paste.Revision,
+		Title:       paste.Title,
+		ContentHash: hash,
+		Language:    paste.Language,
+		UserID:      paste.UserID,
+		CreatedAt:   paste.UpdatedAt,
+	}
+	if err := tx.Create(&rev).Error; err != nil {
+		return err
+	}
+
+	files := make([]models.RevisionFile, len(paste.Files))
+	for i, f := range paste.Files {
+		hash, err := acquireBlob(tx, defaultBackend(), f.Content)
+		if err != nil {
+			return err
+		}
+		files[i] = models.RevisionFile{
+			RevisionID:  rev.ID,
+			Filename:    f.Filename,
+			Language:    f.Language,
+			ContentHash: hash,
+			Position:    i,
+		}
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	return tx.Create(&files).Error
+}
+
+// ReplaceFiles swaps the files of a multi-file paste for files, numbering
+// them in order
+func ReplaceFiles(tx *gorm.DB, paste *models.Paste, files []models.PasteFile) error {
+	var old []string
+	if err := tx.Model(&models.PasteFile{}).Where("paste_id = ?", paste.ID).Pluck("content_hash", &old).Error; err != nil {
+		return err
+	}
+	if err := releaseBlobs(tx, old...); err != nil {
+		return err
+	}
+	if err := tx.Where("paste_id = ?", paste.ID).Delete(&models.PasteFile{}).Error; err != nil {
+		return err
+	}
+
+	rows := make([]models.PasteFile, len(files))
+	for i := range files {
+		hash, err := acquireBlob(tx, defaultBackend(), files[i].Content)
+		if err != nil {
+			return err
+		}
+		files[i].ID = 0
+		files[i].PasteID = paste.ID
+		files[i].ContentHash = hash
+		files[i].Position = i
+		rows[i] = files[i]
+		rows[i].Content = ""
+	}
+	if len(rows) > 0 {
+		if err := tx.Create(&rows).Error; err != nil {
+			return err
+		}
+	}
+	for i := range files {
+		files[i].ID = rows[i].ID
+	}
+	paste.Files = files
+	return nil
+}
+
+// ErrAlreadyBurned is returned by BurnPaste to every reader but the first
+var ErrAlreadyBurned = errors.New("paste already burned")
+
+// DeletePaste removes a paste together with everything that hangs off it
+func DeletePaste(tx *gorm.DB, paste *models.Paste) error {
+	var blobs []string
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if blobs, err = deleteDependents(tx, paste); err != nil {
+			return err
+		}
+		return tx.Delete(paste).Error
+	})
+	if err == nil {
+		DeleteContent(tx.Statement.Context, paste.ContentBackend, paste.ContentKey)
+		purgeReleased(tx, blobs)
+	}
+	return err
+}
+
+// BurnPaste destroys a burn-after-read paste on behalf of the reader about
+// to see it. The row is removed with a conditional delete, so of several
+// concurrent readers exactly one succeeds; the rest get ErrAlreadyBurned.
+func BurnPaste(tx *gorm.DB, paste *models.Paste) error {
+	var blobs []string
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND burn_after_read = ?", paste.ID, true).Delete(&models.Paste{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrAlreadyBurned
+		}
+		var err error
+		blobs, err = deleteDependents(tx, paste)
+		return err
+	})
+	if err == nil {
+		DeleteContent(tx.Statement.Context, paste.ContentBackend, paste.ContentKey)
+		purgeReleased(tx, blobs)
+	}
+	return err
+}
+
+// deleteDependents clears out the rows that refer to a paste being deleted
+// and releases every blob the paste held, returning their hashes
+func deleteDependents(tx *gorm.DB, paste *models.Paste) ([]string, error) {
+	var blobs []string
+	revisions := tx.Model(&models.PasteRevision{}).Select("id").Where("paste_id = ?", paste.ID)
+	err := tx.Raw(`SELECT content_hash FROM paste_revisions WHERE paste_id = ?
+		UNION ALL SELECT content_hash FROM paste_files WHERE paste_id = ?
+		UNION ALL SELECT content_hash FROM revision_files WHERE revision_id IN (?)`, paste.ID, paste.ID, revisions).
+		Scan(&blobs).Error
+	if err != nil {
+		return nil, err
+	}
+	blobs = append(blobs, paste.ContentHash)
+	if err := releaseBlobs(tx, blobs...); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Where("revision_id IN (?)", revisions).Delete(&models.RevisionFile{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("paste_id = ?", paste.ID).Delete(&models.PasteRevision{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("paste_id = ?", paste.ID).Delete(&models.PasteFile{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Exec("DELETE FROM paste_tags WHERE paste_id = ?", paste.ID).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("paste_id = ?", paste.ID).Delete(&models.Comment{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("paste_id = ?", paste.ID).Delete(&models.Star{}).Error; err != nil {
+		return nil, err
+	}
+	if err := UnindexPaste(tx, paste.ID); err != nil {
+		return nil, err
+	}
+	// Hand forks over to our own parent so the lineage stays connected
+	return blobs, tx.Model(&models.Paste{}).Where("forked_from_id = ?", paste.ID).Updates(map[string]interface{}{
+		"forked_from_id":  paste.ForkedFromID,
+		"forked_from_rev": paste.ForkedFromRev,
+	}).Error
+}
+
+// purgeReleased deletes the blobs a deleted paste was the last user of right
+// away, so burned content doesn't linger until the next janitor sweep
+func purgeReleased(db *gorm.DB, blobs []string) {
+	if _, err := purgeBlobs(db, blobs...); err != nil {
+		log.Printf("storage: failed to purge blobs: %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"patbin/models"
+	"patbin/storage"
+)
+
+func TestBurnPasteOnce(t *testing.T) {
+	setup(t, storage.Inline)
+	createPaste(t, models.Paste{ID: "burn", Content: "read me once", BurnAfterRead: true})
+
+	var paste models.Paste
+	if err := DB.First(&paste, "id = ?", "burn").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	const readers = 8
+	errs := make([]error, readers)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p := paste
+			errs[i] = BurnPaste(DB, &p)
+		}(i)
+	}
+	wg.Wait()
+
+	won := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			won++
+		case !errors.Is(err, ErrAlreadyBurned):
+			t.Errorf("BurnPaste: %v", err)
+		}
+	}
+	if won != 1 {
+		t.Errorf("%d readers got the paste, want 1", won)
+	}
+
+	var blobs int64
+	DB.Model(&models.Blob{}).Count(&blobs)
+	if blobs != 0 {
+		t.Errorf("%d blobs left after the burn", blobs)
+	}
+}
+
+func TestBurnPasteOnlyBurnAfterRead(t *testing.T) {
+	setup(t, storage.Inline)
+	createPaste(t, models.Paste{ID: "keep", Content: "ordinary"})
+
+	if err := BurnPaste(DB, &models.Paste{ID: "keep"}); !errors.Is(err, ErrAlreadyBurned) {
+		t.Errorf("BurnPaste = %v, want ErrAlreadyBurned", err)
+	}
+	var count int64
+	DB.Model(&models.Paste{}).Where("id = ?", "keep").Count(&count)
+	if count != 1 {
+		t.Error("an ordinary paste was deleted")
+	}
+}
+
+func TestDeletePasteKeepsLineage(t *testing.T) {
+	setup(t, storage.Inline)
+	root := "root"
+	createPaste(t, models.Paste{ID: "root", Content: "x"})
+	createPaste(t, models.Paste{ID: "middle", Content: "x", ForkedFromID: &root, ForkedFromRev: 1})
+	middle := "middle"
+	createPaste(t, models.Paste{ID: "leaf", Content: "x", ForkedFromID: &middle})
+
+	var paste models.Paste
+	DB.First(&paste, "id = ?", "middle")
+	if err := DeletePaste(DB, &paste); err != nil {
+		t.Fatal(err)
+	}
+
+	var leaf models.Paste
+	DB.First(&leaf, "id = ?", "leaf")
+	from := ""
+	if leaf.ForkedFromID != nil {
+		from = *leaf.ForkedFromID
+	}
+	if from != "root" || leaf.ForkedFromRev != 1 {
+		t.Errorf("leaf forked from %q rev %d, want root rev 1", from, leaf.ForkedFromRev)
+	}
+}
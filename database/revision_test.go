@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"patbin/models"
+	"patbin/storage"
+
+	"gorm.io/gorm"
+)
+
+func snapshot(t *testing.T, paste *models.Paste) {
+	t.Helper()
+	if err := SnapshotRevision(DB, paste); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSnapshotRevision(t *testing.T) {
+	setup(t, storage.Inline)
+	paste := models.Paste{ID: "rev", Title: "v1", Content: "first", Revision: 1}
+	createPaste(t, paste)
+
+	snapshot(t, &paste)
+	// Recording the same revision again is a no-op
+	snapshot(t, &paste)
+
+	paste.Title, paste.Content, paste.Revision = "v2", "second", 2
+	snapshot(t, &paste)
+
+	var revs []models.PasteRevision
+	DB.Order("number").Find(&revs, "paste_id = ?", "rev")
+	if len(revs) != 2 {
+		t.Fatalf("%d revisions, want 2", len(revs))
+	}
+	for i, want := range []string{"first", "second"} {
+		if err := LoadRevisionContent(context.Background(), &revs[i]); err != nil {
+			t.Fatal(err)
+		}
+		if revs[i].Number != i+1 || revs[i].Content != want {
+			t.Errorf("revision %d holds %q, want %q", revs[i].Number, revs[i].Content, want)
+		}
+	}
+	if n := refCount(t, "first"); n != 2 {
+		t.Errorf("blob of the first content referenced %d times, want 2", n)
+	}
+}
+
+func TestSnapshotRevisionFiles(t *testing.T) {
+	setup(t, storage.Inline)
+	files := []models.PasteFile{
+		{Filename: "a.go", Language: "go", Content: "package a"},
+		{Filename: "b.md", Language: "markdown", Content: "# b"},
+	}
+	createPaste(t, models.Paste{ID: "files", Revision: 1}, files...)
+
+	var paste models.Paste
+	DB.Preload("Files").First(&paste, "id = ?", "files")
+	if err := LoadContent(context.Background(), &paste); err != nil {
+		t.Fatal(err)
+	}
+	snapshot(t, &paste)
+
+	var rev models.PasteRevision
+	DB.Preload("Files", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).
+		First(&rev, "paste_id = ? AND number = 1", "files")
+	if err := LoadRevisionContent(context.Background(), &rev); err != nil {
+		t.Fatal(err)
+	}
+	if len(rev.Files) != len(files) {
+		t.Fatalf("revision holds %d files, want %d", len(rev.Files), len(files))
+	}
+	for i, f := range rev.Files {
+		if f.Filename != files[i].Filename || f.Language != files[i].Language || f.Content != files[i].Content || f.Position != i {
+			t.Errorf("file %d = %+v, want %+v", i, f, files[i])
+		}
+	}
+
+	// Deleting the paste takes its revision files and their blobs along
+	if err := DeletePaste(DB, &paste); err != nil {
+		t.Fatal(err)
+	}
+	var rows, blobs int64
+	DB.Model(&models.RevisionFile{}).Count(&rows)
+	DB.Model(&models.Blob{}).Count(&blobs)
+	if rows != 0 || blobs != 0 {
+		t.Errorf("%d revision files and %d blobs left", rows, blobs)
+	}
+}
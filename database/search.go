@@ -0,0 +1,171 @@
+package database
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"patbin/models"
+
+	"gorm.io/gorm"
+)
+
+// Snippet markers wrap matched terms in SearchResult.Snippet. They are
+// control characters so callers can escape the text before marking it up.
+const (
+	SnippetStart = "\x02"
+	SnippetEnd   = "\x03"
+)
+
+// SearchResult is a paste matching a search, without its full content
+type SearchResult struct {
+	ID         string    `json:"id"`
+	Title      string    `json:"title"`
+	Language   string    `json:"language"`
+	Visibility string    `json:"visibility"`
+	Views      int       `json:"views"`
+	UserID     *uint     `json:"user_id,omitempty"`
+	Username   string    `json:"username,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	Snippet    string    `json:"snippet"`
+}
+
+// SearchOptions narrows a full-text search
+type SearchOptions struct {
+	Query    string
+	Language string
+	AuthorID *uint // only pastes by this user
+	ViewerID *uint // private pastes of this user and their organizations are included
+	Limit    int
+}
+
+// initSearch creates the full-text index
+func initSearch(db *gorm.DB) error {
+	return db.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS pastes_fts
+		USING fts5(id UNINDEXED, title, content, tokenize = 'unicode61')`).Error
+}
+
+// BackfillSearch indexes the pastes that aren't indexed yet, such as those
+// written before the index existed, batchSize at a time, and returns how
+// many it indexed. Content is read from wherever it is stored, so it needs
+// InitStorage first. Pastes whose content can't be read are logged and
+// skipped. Encrypted pastes are never indexed.
+func BackfillSearch(ctx context.Context, batchSize int) (int, error) {
+	indexed := 0
+	last := ""
+	for {
+		var batch []models.Paste
+		err := DB.WithContext(ctx).
+			Preload("Files", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).
+			Where("id > ? AND encryption = '' AND id NOT IN (SELECT id FROM pastes_fts)", last).
+			Order("id").
+			Limit(batchSize).
+			Find(&batch).Error
+		if err != nil || len(batch) == 0 {
+			return indexed, err
+		}
+		last = batch[len(batch)-1].ID
+
+		loaded := batch[:0]
+		for _, paste := range batch {
+			if err := LoadContent(ctx, &paste); err != nil {
+				log.Printf("search: can't index paste %s: %v", paste.ID, err)
+				continue
+			}
+			loaded = append(loaded, paste)
+		}
+
+		err = DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			for i := range loaded {
+				if err := IndexPaste(tx, &loaded[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return indexed, err
+		}
+		indexed += len(loaded)
+	}
+}
+
+// IndexPaste adds a paste to the search index, replacing any older entry.
+// Every file of a multi-file paste is indexed, filenames alongside the title.
+// Encrypted pastes stay out of the index.
+func IndexPaste(tx *gorm.DB, paste *models.Paste) error {
+	if err := UnindexPaste(tx, paste.ID); err != nil || paste.Encryption != "" {
+		return err
+	}
+
+	title, content := paste.Title, paste.Content
+	if len(paste.Files) > 0 {
+		names := []string{paste.Title}
+		contents := make([]string, 0, len(paste.Files))
+		for _, f := range paste.Files {
+			names = append(names, f.Filename)
+			contents = append(contents, f.Content)
+		}
+		title, content = strings.Join(names, " "), strings.Join(contents, "\n")
+	}
+
+	return tx.Exec("INSERT INTO pastes_fts (id, title, content) VALUES (?, ?, ?)",
+		paste.ID, title, content).Error
+}
+
+// UnindexPaste removes a paste from the search index
+func UnindexPaste(tx *gorm.DB, id string) error {
+	return tx.Exec("DELETE FROM pastes_fts WHERE id = ?", id).Error
+}
+
+// matchQuery turns free text into an FTS5 query: every word must appear,
+// as a prefix, and FTS5 operators in the input are taken literally
+func matchQuery(q string) string {
+	terms := strings.Fields(q)
+	for i, t := range terms {
+		terms[i] = `"` + strings.ReplaceAll(t, `"`, `""`) + `"*`
+	}
+	return strings.Join(terms, " ")
+}
+
+// SearchPastes runs a full-text search over titles and content, best
+// matches first. Expired and burn-after-read pastes are never returned, and
+// password-protected ones only to those who may edit them: their author, or
+// the owners and editors of their organization.
+func SearchPastes(opts SearchOptions) ([]SearchResult, error) {
+	results := []SearchResult{}
+	match := matchQuery(opts.Query)
+	if match == "" {
+		return results, nil
+	}
+
+	query := DB.Table("pastes_fts").
+		Select(`pastes.id, pastes.title, pastes.language, pastes.visibility, pastes.views,
+			pastes.user_id, users.username, pastes.created_at,
+			snippet(pastes_fts, 2, ?, ?, '…', 16) AS snippet`, SnippetStart, SnippetEnd).
+		Joins("JOIN pastes ON pastes.id = pastes_fts.id").
+		Joins("LEFT JOIN users ON users.id = pastes.user_id").
+		Where("pastes_fts MATCH ?", match).
+		Where("pastes.burn_after_read = ?", false).
+		Where("pastes.expires_at IS NULL OR pastes.expires_at > ?", time.Now())
+
+	if opts.ViewerID != nil {
+		query = query.Where("(pastes.visibility = ? AND pastes.password = '') OR (pastes.org_id IS NULL AND pastes.user_id = ?) OR (pastes.org_id IN (?) AND pastes.password = '') OR pastes.org_id IN (?)",
+			models.VisibilityPublic, *opts.ViewerID, MemberOrgs(*opts.ViewerID), EditorOrgs(*opts.ViewerID))
+	} else {
+		query = query.Where("pastes.visibility = ? AND pastes.password = ''", models.VisibilityPublic)
+	}
+	if opts.AuthorID != nil {
+		query = query.Where("pastes.user_id = ?", *opts.AuthorID)
+	}
+	if opts.Language != "" {
+		query = query.Where("pastes.language = ?", opts.Language)
+	}
+
+	// Title hits count for more than content hits
+	err := query.Order("bm25(pastes_fts, 0.0, 5.0, 1.0)").
+		Limit(opts.Limit).
+		Scan(&results).Error
+	return results, err
+}
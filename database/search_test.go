@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"patbin/models"
+	"patbin/storage"
+
+	"gorm.io/gorm"
+)
+
+func createPaste(t *testing.T, paste models.Paste, files ...models.PasteFile) {
+	t.Helper()
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := CreatePaste(tx, &paste); err != nil {
+			return err
+		}
+		return ReplaceFiles(tx, &paste, files)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func search(t *testing.T, q string) []string {
+	t.Helper()
+	results, err := SearchPastes(SearchOptions{Query: q, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, len(results))
+	for i, r := range results {
+		ids[i] = r.ID
+	}
+	return ids
+}
+
+func TestBackfillSearch(t *testing.T) {
+	objects := setup(t, storage.FS)
+	ctx := context.Background()
+
+	createPaste(t, models.Paste{ID: "single", Content: "the quick brown fox", Visibility: models.VisibilityPublic})
+	createPaste(t, models.Paste{ID: "multi", Title: "notes", Visibility: models.VisibilityPublic},
+		models.PasteFile{Filename: "a.txt", Content: "lazy dog"},
+		models.PasteFile{Filename: "b.txt", Content: "jumps over"})
+	createPaste(t, models.Paste{ID: "secret", Content: "quick ciphertext", Encryption: "aes-gcm", Visibility: models.VisibilityPublic})
+	createPaste(t, models.Paste{ID: "lost", Content: "quick but unreadable", Visibility: models.VisibilityPublic})
+	if _, err := FlushBlobs(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	// Lose the object of one paste and start over with an empty index
+	if err := os.Remove(filepath.Join(objects, blobKey(hashContent("quick but unreadable")))); err != nil {
+		t.Fatal(err)
+	}
+	if err := DB.Exec("DELETE FROM pastes_fts").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := BackfillSearch(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("indexed %d pastes, want 2", n)
+	}
+	if got := search(t, "quick"); len(got) != 1 || got[0] != "single" {
+		t.Errorf("search quick = %v, want [single]", got)
+	}
+	if got := search(t, "jumps b.txt"); len(got) != 1 || got[0] != "multi" {
+		t.Errorf("search jumps b.txt = %v, want [multi]", got)
+	}
+
+	// Nothing left to do, and the unreadable paste is tried again next time
+	if n, err := BackfillSearch(ctx, 2); err != nil || n != 0 {
+		t.Errorf("second backfill = %d, %v; want 0", n, err)
+	}
+}
+
+func TestSearchPasswordProtectedOrgPastes(t *testing.T) {
+	setup(t, storage.Inline)
+	org := models.Org{Name: "acme"}
+	DB.Create(&org)
+	viewer, editor, owner := uint(1), uint(2), uint(3)
+	DB.Create(&[]models.OrgMember{
+		{OrgID: org.ID, UserID: viewer, Role: models.RoleViewer},
+		{OrgID: org.ID, UserID: editor, Role: models.RoleEditor},
+		{OrgID: org.ID, UserID: owner, Role: models.RoleOwner},
+	})
+	for _, p := range []models.Paste{
+		{ID: "open", Content: "quarterly numbers", Visibility: models.VisibilityPrivate, OrgID: &org.ID, UserID: &editor},
+		{ID: "locked", Content: "quarterly secrets", Visibility: models.VisibilityPrivate, OrgID: &org.ID, UserID: &editor, Password: "hash"},
+	} {
+		createPaste(t, p)
+		if err := IndexPaste(DB, &p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for user, want := range map[uint]string{viewer: "[open]", editor: "[locked open]", owner: "[locked open]", 4: "[]"} {
+		results, err := SearchPastes(SearchOptions{Query: "quarterly", ViewerID: &user, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := make([]string, len(results))
+		for i, r := range results {
+			ids[i] = r.ID
+		}
+		sort.Strings(ids)
+		if fmt.Sprint(ids) != want {
+			t.Errorf("user %d finds %v, want %s", user, ids, want)
+		}
+	}
+}
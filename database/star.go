@@ -0,0 +1,50 @@
+package database
+
+import (
+	"patbin/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StarPaste stars a paste for a user, unless they already did
+func StarPaste(tx *gorm.DB, paste *models.Paste, userID uint) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.Star{UserID: userID, PasteID: paste.ID})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		paste.Stars++
+		return tx.Model(paste).UpdateColumn("stars", gorm.Expr("stars + 1")).Error
+	})
+}
+
+// UnstarPaste takes the star of a user off a paste, if it has one
+func UnstarPaste(tx *gorm.DB, paste *models.Paste, userID uint) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("user_id = ? AND paste_id = ?", userID, paste.ID).Delete(&models.Star{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		paste.Stars--
+		return tx.Model(paste).UpdateColumn("stars", gorm.Expr("stars - 1")).Error
+	})
+}
+
+// HasStarred reports whether a user starred a paste
+func HasStarred(pasteID string, userID uint) bool {
+	var count int64
+	DB.Model(&models.Star{}).Where("user_id = ? AND paste_id = ?", userID, pasteID).Count(&count)
+	return count > 0
+}
+
+// StarredBy scopes a paste query to the pastes a user starred that they
+// can still see: those that weren't made private since, unless they are
+// theirs or their organization's
+func StarredBy(userID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("pastes.id IN (?)", DB.Model(&models.Star{}).Select("paste_id").Where("user_id = ?", userID)).
+			Where("(pastes.visibility <> ? OR (pastes.org_id IS NULL AND pastes.user_id = ?) OR pastes.org_id IN (?))",
+				models.VisibilityPrivate, userID, MemberOrgs(userID))
+	}
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"testing"
+
+	"patbin/models"
+	"patbin/storage"
+)
+
+func TestStarPaste(t *testing.T) {
+	setup(t, storage.Inline)
+	createPaste(t, models.Paste{ID: "p", Content: "x", Visibility: models.VisibilityPublic})
+
+	var paste models.Paste
+	DB.First(&paste, "id = ?", "p")
+	for i := 0; i < 2; i++ {
+		if err := StarPaste(DB, &paste, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	StarPaste(DB, &paste, 2)
+	DB.First(&paste, "id = ?", "p")
+	if paste.Stars != 2 || !HasStarred("p", 1) {
+		t.Fatalf("stars = %d after starring twice, want 2", paste.Stars)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := UnstarPaste(DB, &paste, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	DB.First(&paste, "id = ?", "p")
+	if paste.Stars != 1 || HasStarred("p", 1) {
+		t.Errorf("stars = %d after unstarring twice, want 1", paste.Stars)
+	}
+}
+
+func TestStarredByHidesPrivatePastes(t *testing.T) {
+	setup(t, storage.Inline)
+	owner, other := uint(1), uint(2)
+	createPaste(t, models.Paste{ID: "public", Content: "a", Visibility: models.VisibilityPublic, UserID: &other})
+	createPaste(t, models.Paste{ID: "mine", Content: "b", Visibility: models.VisibilityPrivate, UserID: &owner})
+	createPaste(t, models.Paste{ID: "theirs", Content: "c", Visibility: models.VisibilityPrivate, UserID: &other})
+	for _, id := range []string{"public", "mine", "theirs"} {
+		if err := StarPaste(DB, &models.Paste{ID: id}, owner); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var ids []string
+	DB.Model(&models.Paste{}).Scopes(StarredBy(owner)).Order("id").Pluck("id", &ids)
+	if len(ids) != 2 || ids[0] != "mine" || ids[1] != "public" {
+		t.Errorf("starred = %v, want [mine public]", ids)
+	}
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"patbin/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SetTags replaces the tags of a paste with the tags named, creating the
+// ones nobody used before
+func SetTags(tx *gorm.DB, paste *models.Paste, names []string) error {
+	tags := []models.Tag{}
+	if len(names) > 0 {
+		rows := make([]models.Tag, len(names))
+		for i, name := range names {
+			rows[i].Name = name
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("name IN ?", names).Order("name").Find(&tags).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Model(paste).Association("Tags").Replace(tags)
+}
+
+// TaggedWith is a query scope that keeps the pastes tagged name
+func TaggedWith(name string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(`pastes.id IN (SELECT paste_tags.paste_id FROM paste_tags
+			JOIN tags ON tags.id = paste_tags.tag_id WHERE tags.name = ?)`, name)
+	}
+}
+
+// InCollection is a query scope that keeps the pastes filed in a collection
+func InCollection(id uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("pastes.collection_id = ?", id)
+	}
+}
+
+// OrderTags preloads the tags of a paste by name
+func OrderTags(db *gorm.DB) *gorm.DB {
+	return db.Order("tags.name")
+}
+
+// TagCount is a tag and how many pastes of a listing carry it
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// UserTags counts the tags on a user's current pastes, leaving out those
+// of their organizations and, unless all is set, the ones that aren't
+// public, most used first
+func UserTags(userID uint, all bool) ([]TagCount, error) {
+	query := DB.Table("tags").
+		Select("tags.name, COUNT(*) AS count").
+		Joins("JOIN paste_tags ON paste_tags.tag_id = tags.id").
+		Joins("JOIN pastes ON pastes.id = paste_tags.paste_id").
+		Where("pastes.user_id = ? AND pastes.org_id IS NULL", userID).
+		Scopes(NotExpired)
+	if !all {
+		query = query.Where("pastes.visibility = ?", models.VisibilityPublic)
+	}
+
+	var counts []TagCount
+	err := query.Group("tags.name").Order("count DESC, tags.name").Scan(&counts).Error
+	return counts, err
+}
+
+// UserCollections lists the collections of a user by name, counting their
+// current pastes, only the public ones unless all is set
+func UserCollections(userID uint, all bool) ([]models.Collection, error) {
+	var collections []models.Collection
+	if err := DB.Where("user_id = ?", userID).Order("name").Find(&collections).Error; err != nil {
+		return nil, err
+	}
+
+	query := DB.Model(&models.Paste{}).
+		Select("collection_id, COUNT(*) AS count").
+		Where("user_id = ? AND collection_id IS NOT NULL", userID).
+		Scopes(NotExpired)
+	if !all {
+		query = query.Where("visibility = ?", models.VisibilityPublic)
+	}
+	var counts []struct {
+		CollectionID uint
+		Count        int64
+	}
+	if err := query.Group("collection_id").Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]int64, len(counts))
+	for _, c := range counts {
+		byID[c.CollectionID] = c.Count
+	}
+	for i := range collections {
+		collections[i].PasteCount = byID[collections[i].ID]
+	}
+	return collections, nil
+}
+
+// DeleteCollection removes a collection, leaving its pastes unfiled
+func DeleteCollection(tx *gorm.DB, collection *models.Collection) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Paste{}).Where("collection_id = ?", collection.ID).UpdateColumn("collection_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(collection).Error
+	})
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+
+	"patbin/models"
+	"patbin/storage"
+)
+
+func TestSetTags(t *testing.T) {
+	setup(t, storage.Inline)
+	createPaste(t, models.Paste{ID: "a", Content: "x"})
+	createPaste(t, models.Paste{ID: "b", Content: "y"})
+
+	tag := func(id string, names ...string) {
+		t.Helper()
+		if err := SetTags(DB, &models.Paste{ID: id}, names); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tagged := func(name string) string {
+		t.Helper()
+		var ids []string
+		DB.Model(&models.Paste{}).Scopes(TaggedWith(name)).Order("id").Pluck("id", &ids)
+		return fmt.Sprint(ids)
+	}
+
+	tag("a", "go", "cli")
+	tag("b", "go")
+	if got := tagged("go"); got != "[a b]" {
+		t.Errorf("tagged go: %s", got)
+	}
+
+	// Replacing drops the old tags but keeps the shared rows
+	tag("a", "rust")
+	if got := tagged("go"); got != "[b]" {
+		t.Errorf("tagged go after retagging: %s", got)
+	}
+	if got := tagged("cli"); got != "[]" {
+		t.Errorf("tagged cli after retagging: %s", got)
+	}
+	var tags int64
+	DB.Model(&models.Tag{}).Count(&tags)
+	if tags != 3 {
+		t.Errorf("%d tag rows, want 3", tags)
+	}
+
+	var paste models.Paste
+	DB.Preload("Tags", OrderTags).First(&paste, "id = ?", "a")
+	if len(paste.Tags) != 1 || paste.Tags[0].Name != "rust" {
+		t.Errorf("tags of a: %+v", paste.Tags)
+	}
+
+	tag("a")
+	if got := tagged("rust"); got != "[]" {
+		t.Errorf("tagged rust after clearing: %s", got)
+	}
+}
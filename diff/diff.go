@@ -0,0 +1,389 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Op int
+
+const (
+	Equal Op = iota
+	Insert
+	Delete
+)
+
+// maxEditDistance bounds the middle-snake search of each region, keeping
+// the time spent on huge, unrelated inputs in check; past it the region is
+// reported as replaced
+const maxEditDistance = 1000
+
+// Line is one line of an edit script. OldNum and NewNum are 1-based and
+// zero when the line doesn't exist on that side.
+type Line struct {
+	Op     Op     `json:"-"`
+	Kind   string `json:"kind"`
+	Text   string `json:"text"`
+	OldNum int    `json:"old,omitempty"`
+	NewNum int    `json:"new,omitempty"`
+}
+
+// Hunk is a group of changes with surrounding context
+type Hunk struct {
+	OldStart int    `json:"old_start"`
+	OldLines int    `json:"old_lines"`
+	NewStart int    `json:"new_start"`
+	NewLines int    `json:"new_lines"`
+	Lines    []Line `json:"lines"`
+}
+
+// Row pairs lines for side-by-side rendering; either side may be nil
+type Row struct {
+	Left  *Line
+	Right *Line
+}
+
+type Stats struct {
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+}
+
+func (o Op) String() string {
+	switch o {
+	case Insert:
+		return "insert"
+	case Delete:
+		return "delete"
+	default:
+		return "equal"
+	}
+}
+
+// SplitLines splits text into lines, ignoring a single trailing newline
+func SplitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.TrimSuffix(s, "\n")
+	return strings.Split(s, "\n")
+}
+
+// Compute returns the line-level edit script turning a into b
+func Compute(a, b string) []Line {
+	oldLines, newLines := SplitLines(a), SplitLines(b)
+
+	// Intern lines so the search compares ints instead of strings
+	ids := make(map[string]int)
+	intern := func(lines []string) []int {
+		out := make([]int, len(lines))
+		for i, l := range lines {
+			id, ok := ids[l]
+			if !ok {
+				id = len(ids)
+				ids[l] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+	x, y := intern(oldLines), intern(newLines)
+
+	ops := myers(x, y)
+
+	result := make([]Line, 0, len(ops))
+	oi, ni := 0, 0
+	for _, op := range ops {
+		switch op {
+		case Equal:
+			result = append(result, Line{Op: Equal, Kind: "equal", Text: oldLines[oi], OldNum: oi + 1, NewNum: ni + 1})
+			oi++
+			ni++
+		case Delete:
+			result = append(result, Line{Op: Delete, Kind: "delete", Text: oldLines[oi], OldNum: oi + 1})
+			oi++
+		case Insert:
+			result = append(result, Line{Op: Insert, Kind: "insert", Text: newLines[ni], NewNum: ni + 1})
+			ni++
+		}
+	}
+	return result
+}
+
+// myers implements the linear-space variant of the O(ND) shortest edit
+// script search from "An O(ND) Difference Algorithm and Its Variations": it
+// finds the middle snake of an optimal path and recurses on either side of it
+func myers(a, b []int) []Op {
+	ops := make([]Op, 0, len(a)+len(b))
+	return bisect(a, b, ops)
+}
+
+func bisect(a, b []int, ops []Op) []Op {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, Equal)
+	}
+	a, b = a[prefix:], b[prefix:]
+
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	x, y, ok := middleSnake(a, b)
+	// A split at either corner would recurse forever
+	if !ok || (x == 0 && y == 0) || (x == len(a) && y == len(b)) {
+		ops = append(ops, replaceAll(len(a), len(b))...)
+	} else {
+		ops = bisect(a[:x], b[:y], ops)
+		ops = bisect(a[x:], b[y:], ops)
+	}
+
+	for i := 0; i < suffix; i++ {
+		ops = append(ops, Equal)
+	}
+	return ops
+}
+
+// middleSnake runs the search from both ends at once and returns a point on
+// an optimal path where the two meet. It gives up once either end has spent
+// maxEditDistance edits.
+func middleSnake(a, b []int) (int, int, bool) {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return 0, 0, false
+	}
+
+	max := (n + m + 1) / 2
+	if max > maxEditDistance {
+		max = maxEditDistance
+	}
+	offset := max + 1
+	// fwd holds the furthest x reached on each diagonal k = x - y from the
+	// start, rev the furthest distance back from the end on diagonal
+	// k = (n - x) - (m - y)
+	fwd := make([]int, 2*max+3)
+	rev := make([]int, 2*max+3)
+	delta := n - m
+	odd := delta%2 != 0
+
+	for d := 0; d <= max; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && fwd[offset+k-1] < fwd[offset+k+1]) {
+				x = fwd[offset+k+1]
+			} else {
+				x = fwd[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			fwd[offset+k] = x
+
+			if r := delta - k; odd && r >= -(d-1) && r <= d-1 && x+rev[offset+r] >= n {
+				return x, y, true
+			}
+		}
+
+		for k := -d; k <= d; k += 2 {
+			var u int
+			if k == -d || (k != d && rev[offset+k-1] < rev[offset+k+1]) {
+				u = rev[offset+k+1]
+			} else {
+				u = rev[offset+k-1] + 1
+			}
+			v := u - k
+			for u < n && v < m && a[n-1-u] == b[m-1-v] {
+				u++
+				v++
+			}
+			rev[offset+k] = u
+
+			if f := delta - k; !odd && f >= -d && f <= d && fwd[offset+f]+u >= n {
+				return n - u, m - v, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+func replaceAll(n, m int) []Op {
+	ops := make([]Op, 0, n+m)
+	for i := 0; i < n; i++ {
+		ops = append(ops, Delete)
+	}
+	for i := 0; i < m; i++ {
+		ops = append(ops, Insert)
+	}
+	return ops
+}
+
+// Count returns the number of added and removed lines
+func Count(lines []Line) Stats {
+	var s Stats
+	for _, l := range lines {
+		switch l.Op {
+		case Insert:
+			s.Added++
+		case Delete:
+			s.Removed++
+		}
+	}
+	return s
+}
+
+// Hunks groups an edit script into hunks with the given lines of context
+func Hunks(lines []Line, context int) []Hunk {
+	var hunks []Hunk
+	i := 0
+	for i < len(lines) {
+		// Find the next change
+		for i < len(lines) && lines[i].Op == Equal {
+			i++
+		}
+		if i == len(lines) {
+			break
+		}
+
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+
+		i = extendHunk(lines, i, context)
+		hunks = append(hunks, buildHunk(lines, start, i))
+	}
+	return hunks
+}
+
+// extendHunk returns the end index (exclusive) of the hunk whose first change
+// is at i, merging changes separated by at most 2*context equal lines
+func extendHunk(lines []Line, i, context int) int {
+	for {
+		for i < len(lines) && lines[i].Op != Equal {
+			i++
+		}
+		run := 0
+		for i+run < len(lines) && lines[i+run].Op == Equal {
+			run++
+		}
+		if i+run == len(lines) || run > 2*context {
+			if run > context {
+				run = context
+			}
+			return i + run
+		}
+		i += run
+	}
+}
+
+func buildHunk(lines []Line, start, end int) Hunk {
+	h := Hunk{Lines: append([]Line(nil), lines[start:end]...)}
+	for _, l := range h.Lines {
+		if l.Op != Insert {
+			if h.OldStart == 0 {
+				h.OldStart = l.OldNum
+			}
+			h.OldLines++
+		}
+		if l.Op != Delete {
+			if h.NewStart == 0 {
+				h.NewStart = l.NewNum
+			}
+			h.NewLines++
+		}
+	}
+
+	// Empty ranges point at the line before, as diff(1) does
+	if h.OldStart == 0 {
+		h.OldStart = precedingNum(lines, start, true)
+	}
+	if h.NewStart == 0 {
+		h.NewStart = precedingNum(lines, start, false)
+	}
+	return h
+}
+
+func precedingNum(lines []Line, i int, old bool) int {
+	for j := i - 1; j >= 0; j-- {
+		if old && lines[j].OldNum > 0 {
+			return lines[j].OldNum
+		}
+		if !old && lines[j].NewNum > 0 {
+			return lines[j].NewNum
+		}
+	}
+	return 0
+}
+
+// Unified renders hunks in unified diff format
+func Unified(fromName, toName string, hunks []Hunk) string {
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+	for _, h := range hunks {
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+		for _, l := range h.Lines {
+			switch l.Op {
+			case Equal:
+				sb.WriteByte(' ')
+			case Insert:
+				sb.WriteByte('+')
+			case Delete:
+				sb.WriteByte('-')
+			}
+			sb.WriteString(l.Text)
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// SideBySide pairs runs of deletions with the insertions that follow them
+func SideBySide(lines []Line) []Row {
+	var rows []Row
+	for i := 0; i < len(lines); {
+		if lines[i].Op == Equal {
+			rows = append(rows, Row{Left: &lines[i], Right: &lines[i]})
+			i++
+			continue
+		}
+
+		var dels, ins []*Line
+		for i < len(lines) && lines[i].Op == Delete {
+			dels = append(dels, &lines[i])
+			i++
+		}
+		for i < len(lines) && lines[i].Op == Insert {
+			ins = append(ins, &lines[i])
+			i++
+		}
+		for j := 0; j < len(dels) || j < len(ins); j++ {
+			var row Row
+			if j < len(dels) {
+				row.Left = dels[j]
+			}
+			if j < len(ins) {
+				row.Right = ins[j]
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
@@ -0,0 +1,200 @@
+package diff
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// apply replays an edit script, returning the two sides it was built from
+func apply(lines []Line) (string, string) {
+	var a, b []string
+	for _, l := range lines {
+		if l.Op != Insert {
+			a = append(a, l.Text)
+		}
+		if l.Op != Delete {
+			b = append(b, l.Text)
+		}
+	}
+	return strings.Join(a, "\n"), strings.Join(b, "\n")
+}
+
+// lcs is the textbook quadratic longest common subsequence length
+func lcs(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		cur := make([]int, len(b)+1)
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] > cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func TestCompute(t *testing.T) {
+	lines := Compute("a\nb\nc\nd\n", "a\nc\nd\ne\n")
+	var got []string
+	for _, l := range lines {
+		got = append(got, fmt.Sprintf("%s %s %d %d", l.Kind, l.Text, l.OldNum, l.NewNum))
+	}
+	want := []string{
+		"equal a 1 1",
+		"delete b 2 0",
+		"equal c 3 2",
+		"equal d 4 3",
+		"insert e 0 4",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if s := Count(lines); s != (Stats{Added: 1, Removed: 1}) {
+		t.Errorf("Count = %+v", s)
+	}
+}
+
+func TestComputeShortest(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := func() []string {
+		lines := make([]string, rng.Intn(30))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.Intn(4)))
+		}
+		return lines
+	}
+
+	for i := 0; i < 2000; i++ {
+		a, b := random(), random()
+		lines := Compute(strings.Join(a, "\n"), strings.Join(b, "\n"))
+
+		gotA, gotB := apply(lines)
+		if gotA != strings.Join(a, "\n") || gotB != strings.Join(b, "\n") {
+			t.Fatalf("script for %q -> %q doesn't replay", a, b)
+		}
+		s := Count(lines)
+		if want := len(a) + len(b) - 2*lcs(a, b); s.Added+s.Removed != want {
+			t.Fatalf("%q -> %q: %d edits, want %d", a, b, s.Added+s.Removed, want)
+		}
+	}
+}
+
+func TestComputeUnrelated(t *testing.T) {
+	// Far more edits than the search allows: replaced outright
+	var a, b strings.Builder
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&a, "old %d\n", i)
+		fmt.Fprintf(&b, "new %d\n", i)
+	}
+	if s := Count(Compute(a.String(), b.String())); s != (Stats{Added: 20000, Removed: 20000}) {
+		t.Errorf("Count = %+v", s)
+	}
+}
+
+func TestComputeLarge(t *testing.T) {
+	// A few edits scattered over a large file are still found exactly
+	old := make([]string, 50000)
+	for i := range old {
+		old[i] = fmt.Sprintf("line %d", i)
+	}
+	changed := append([]string(nil), old...)
+	for i := 1000; i < len(changed); i += 5000 {
+		changed[i] = "changed"
+	}
+	s := Count(Compute(strings.Join(old, "\n"), strings.Join(changed, "\n")))
+	if s != (Stats{Added: 10, Removed: 10}) {
+		t.Errorf("Count = %+v", s)
+	}
+}
+
+func TestSplitLines(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"a\n", 1},
+		{"a\r\nb\r\n", 2},
+		{"a\n\n", 2},
+	}
+	for _, tt := range tests {
+		if got := SplitLines(tt.in); len(got) != tt.want {
+			t.Errorf("SplitLines(%q) = %q, want %d lines", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestUnified(t *testing.T) {
+	var a, b []string
+	for i := 1; i <= 20; i++ {
+		a = append(a, fmt.Sprint(i))
+		if i != 3 && i != 17 {
+			b = append(b, fmt.Sprint(i))
+		}
+	}
+	b = append(b, "21")
+
+	got := Unified("a.txt", "b.txt", Hunks(Compute(strings.Join(a, "\n"), strings.Join(b, "\n")), 2))
+	want := `--- a.txt
++++ b.txt
+@@ -1,5 +1,4 @@
+ 1
+ 2
+-3
+ 4
+ 5
+@@ -15,6 +14,6 @@
+ 15
+ 16
+-17
+ 18
+ 19
+ 20
++21
+`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if Unified("a", "b", nil) != "" {
+		t.Error("identical inputs should render nothing")
+	}
+}
+
+func TestHunksEmptyRange(t *testing.T) {
+	hunks := Hunks(Compute("a\nb\n", "a\nx\nb\n"), 0)
+	if len(hunks) != 1 {
+		t.Fatalf("%d hunks, want 1", len(hunks))
+	}
+	// Nothing removed: the old range points at the line before
+	if h := hunks[0]; h.OldStart != 1 || h.OldLines != 0 || h.NewStart != 2 || h.NewLines != 1 {
+		t.Errorf("hunk = %+v", h)
+	}
+}
+
+func TestSideBySide(t *testing.T) {
+	rows := SideBySide(Compute("a\nb\nc\nd\n", "a\nB\nd\ne\n"))
+	var got []string
+	for _, r := range rows {
+		left, right := "-", "-"
+		if r.Left != nil {
+			left = r.Left.Text
+		}
+		if r.Right != nil {
+			right = r.Right.Text
+		}
+		got = append(got, left+"|"+right)
+	}
+	want := "a|a b|B c|- d|d -|e"
+	if strings.Join(got, " ") != want {
+		t.Errorf("rows %q, want %q", strings.Join(got, " "), want)
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"patbin/config"
 	"patbin/database"
@@ -9,7 +10,6 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -31,6 +31,10 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 // Register creates a new user account
 func (h *AuthHandler) Register(c *gin.Context) {
 	var req RegisterRequest
@@ -65,20 +69,20 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	// Generate token
-	token, err := h.generateToken(user.ID, user.Username)
+	// Start a session
+	tokens, err := middleware.StartSession(c, h.cfg, &user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
-
-	// Set cookie
-	c.SetCookie(h.cfg.CookieName, token, 60*60*24*7, "/", "", false, true)
+	middleware.SetSessionCookies(c, h.cfg, tokens)
 
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "Registration successful",
-		"user":    user,
-		"token":   token,
+		"message":       "Registration successful",
+		"user":          user,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
 	})
 }
 
@@ -103,26 +107,57 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// Generate token
-	token, err := h.generateToken(user.ID, user.Username)
+	// Start a session
+	tokens, err := middleware.StartSession(c, h.cfg, &user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
-
-	// Set cookie
-	c.SetCookie(h.cfg.CookieName, token, 60*60*24*7, "/", "", false, true)
+	middleware.SetSessionCookies(c, h.cfg, tokens)
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Login successful",
-		"user":    user,
-		"token":   token,
+		"message":       "Login successful",
+		"user":          user,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
 	})
 }
 
-// Logout clears the auth cookie
+// Refresh exchanges a refresh token, from the body or the refresh cookie,
+// for a new access token and refresh token
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	c.ShouldBindJSON(&req)
+	if req.RefreshToken == "" {
+		req.RefreshToken, _ = c.Cookie(h.cfg.RefreshCookieName)
+	}
+	if req.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Refresh token required"})
+		return
+	}
+
+	tokens, err := middleware.RefreshSession(c, h.cfg, req.RefreshToken)
+	if err != nil {
+		middleware.ClearSessionCookies(c, h.cfg)
+		if errors.Is(err, middleware.ErrInvalidRefresh) || errors.Is(err, middleware.ErrRefreshReused) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		}
+		return
+	}
+	middleware.SetSessionCookies(c, h.cfg, tokens)
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout ends the current session and clears the auth cookies
 func (h *AuthHandler) Logout(c *gin.Context) {
-	c.SetCookie(h.cfg.CookieName, "", -1, "/", "", false, true)
+	if id, ok := middleware.GetSessionID(c); ok {
+		database.DB.Delete(&models.Session{}, "id = ?", id)
+	}
+	middleware.ClearSessionCookies(c, h.cfg)
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
 
@@ -143,20 +178,6 @@ func (h *AuthHandler) GetCurrentUser(c *gin.Context) {
 	c.JSON(http.StatusOK, user)
 }
 
-func (h *AuthHandler) generateToken(userID uint, username string) (string, error) {
-	claims := &middleware.Claims{
-		UserID:   userID,
-		Username: username,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(h.cfg.JWTSecret))
-}
-
 // LoginPage renders the login page
 func (h *AuthHandler) LoginPage(c *gin.Context) {
 	c.HTML(http.StatusOK, "login.html", gin.H{
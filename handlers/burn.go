@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"patbin/database"
+	"patbin/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errBurned = &accessError{http.StatusNotFound, "Burned - Patbin", "This paste has been burned after reading"}
+
+// burnPaste destroys a burn-after-read paste for the current reader. Only
+// the reader that gets a nil result may be shown the content.
+func burnPaste(paste *models.Paste) *accessError {
+	err := database.BurnPaste(database.DB, paste)
+	if errors.Is(err, database.ErrAlreadyBurned) {
+		return errBurned
+	}
+	if err != nil {
+		return &accessError{http.StatusInternalServerError, "Error - Patbin", "Failed to read paste"}
+	}
+	return nil
+}
+
+// confirmBurn guards the raw downloads of a burn-after-read paste. Chat
+// clients unfurl raw links too, so reading one has to be asked for with
+// ?confirm=1, which burns the paste.
+func confirmBurn(c *gin.Context, paste *models.Paste) *accessError {
+	if !paste.BurnAfterRead {
+		return nil
+	}
+	if c.Query("confirm") != "1" {
+		return &accessError{http.StatusPreconditionRequired, "Confirm - Patbin", "This paste will be destroyed once read. Add ?confirm=1 to the URL to read it."}
+	}
+	return burnPaste(paste)
+}
+
+// RevealPaste shows a burn-after-read paste once the reader has confirmed
+// the interstitial, destroying it in the same step
+func (h *PasteHandler) RevealPaste(c *gin.Context) {
+	id, ext := splitExt(c.Param("id"))
+
+	paste, aerr := h.loadPaste(c, id)
+	if aerr == nil && paste.BurnAfterRead {
+		aerr = burnPaste(paste)
+	}
+	if aerr != nil {
+		renderLocked(c, id, aerr)
+		return
+	}
+
+	// Nothing to confirm for ordinary pastes
+	if !paste.BurnAfterRead {
+		c.Redirect(http.StatusSeeOther, c.Request.URL.Path)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	paste.Views++
+	h.renderPaste(c, paste, ext, true)
+}
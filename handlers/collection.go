@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"net/http"
+	"patbin/database"
+	"patbin/middleware"
+	"patbin/models"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CollectionHandler struct{}
+
+func NewCollectionHandler() *CollectionHandler {
+	return &CollectionHandler{}
+}
+
+type CollectionRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// validate trims the request, returning a message when it isn't valid
+func (req *CollectionRequest) validate() string {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Description = strings.TrimSpace(req.Description)
+	if req.Name == "" || len(req.Name) > 100 {
+		return "A collection needs a name (max 100 characters)"
+	}
+	if len(req.Description) > 500 {
+		return "Description too long (max 500 characters)"
+	}
+	return ""
+}
+
+// nameTaken reports whether the user has another collection called name
+func nameTaken(userID uint, name string, except uint) bool {
+	var count int64
+	database.DB.Model(&models.Collection{}).
+		Where("user_id = ? AND name = ? AND id <> ?", userID, name, except).
+		Count(&count)
+	return count > 0
+}
+
+// ListCollections returns the current user's collections with the number
+// of pastes in each
+func (h *CollectionHandler) ListCollections(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	collections, err := database.UserCollections(userID, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list collections"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"collections": collections})
+}
+
+// ListTags returns the tags on the current user's pastes with their counts
+func (h *CollectionHandler) ListTags(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	tags, err := database.UserTags(userID, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list tags"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+// CreateCollection adds a collection for the current user
+func (h *CollectionHandler) CreateCollection(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	var req CollectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if nameTaken(userID, req.Name, 0) {
+		c.JSON(http.StatusConflict, gin.H{"error": "You already have a collection with that name"})
+		return
+	}
+
+	collection := models.Collection{
+		UserID:      userID,
+		Name:        req.Name,
+		Description: req.Description,
+	}
+	if err := database.DB.Create(&collection).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create collection"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, collection)
+}
+
+// UpdateCollection renames or redescribes a collection of the current user
+func (h *CollectionHandler) UpdateCollection(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	var collection models.Collection
+	if result := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&collection); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+		return
+	}
+
+	var req CollectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if nameTaken(userID, req.Name, collection.ID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "You already have a collection with that name"})
+		return
+	}
+
+	err := database.DB.Model(&collection).Updates(map[string]interface{}{
+		"name":        req.Name,
+		"description": req.Description,
+	}).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update collection"})
+		return
+	}
+
+	c.JSON(http.StatusOK, collection)
+}
+
+// DeleteCollection removes a collection of the current user. Its pastes
+// are kept, just no longer filed.
+func (h *CollectionHandler) DeleteCollection(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	var collection models.Collection
+	if result := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&collection); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+		return
+	}
+
+	if err := database.DeleteCollection(database.DB, &collection); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete collection"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Collection deleted"})
+}
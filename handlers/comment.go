@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"patbin/database"
+	"patbin/middleware"
+	"patbin/models"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxCommentLength = 5000
+
+type CreateCommentRequest struct {
+	Body      string `json:"body"`
+	Revision  int    `json:"revision"` // defaults to the current revision
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"` // defaults to StartLine
+	// ParentID makes the comment a reply, which takes the anchor of its thread
+	ParentID *uint `json:"parent_id"`
+}
+
+type ResolveCommentRequest struct {
+	Resolved bool `json:"resolved"`
+}
+
+// commentView is what the view page shows of the comments on a revision
+type commentView struct {
+	Revision  int
+	Threads   []models.Comment
+	Elsewhere []database.ThreadCount // threads on the other revisions
+	UserID    uint                   // 0 when logged out
+	Moderator bool                   // may manage every comment
+}
+
+// CanManage reports whether the viewer may delete a comment, or resolve it
+// when it starts a thread
+func (v *commentView) CanManage(comment models.Comment) bool {
+	return v.Moderator || (v.UserID != 0 && comment.UserID == v.UserID)
+}
+
+// loadComments gathers the comments on revision of a paste for the view
+// page, marking the lines they cover in view, the first file
+func loadComments(c *gin.Context, paste *models.Paste, revision int, view *fileView) *commentView {
+	v := &commentView{Revision: revision, Moderator: canEditPaste(c, paste)}
+	v.UserID, _ = middleware.GetUserID(c)
+	v.Threads, _ = database.PasteThreads(paste.ID, revision)
+
+	counts, _ := database.ThreadCounts(paste.ID)
+	for _, tc := range counts {
+		if tc.Revision != revision {
+			v.Elsewhere = append(v.Elsewhere, tc)
+		}
+	}
+
+	view.Comments = make(map[int]uint)
+	for _, t := range v.Threads {
+		for line := t.StartLine; line <= t.EndLine && line <= view.Lines; line++ {
+			if _, ok := view.Comments[line]; !ok {
+				view.Comments[line] = t.ID
+			}
+		}
+	}
+	return v
+}
+
+// ListComments returns the comment threads of a paste with their replies,
+// of every revision or only of ?revision=
+func (h *PasteHandler) ListComments(c *gin.Context) {
+	paste, aerr := h.loadPaste(c, c.Param("id"))
+	if aerr != nil {
+		c.JSON(aerr.status, gin.H{"error": aerr.message})
+		return
+	}
+
+	revision := 0
+	if s := c.Query("revision"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid revision number"})
+			return
+		}
+		revision = n
+	}
+
+	threads, err := database.PasteThreads(paste.ID, revision)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load comments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"paste_id": paste.ID,
+		"comments": threads,
+	})
+}
+
+// CreateComment comments on lines of a paste revision, or replies to a
+// thread
+func (h *PasteHandler) CreateComment(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	paste, aerr := h.loadPaste(c, c.Param("id"))
+	if aerr != nil {
+		c.JSON(aerr.status, gin.H{"error": aerr.message})
+		return
+	}
+	// They have no revisions to point at, and would be gone once read
+	if paste.BurnAfterRead {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Comments are not available for burn-after-read pastes"})
+		return
+	}
+
+	var req CreateCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	req.Body = strings.TrimSpace(req.Body)
+	if req.Body == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Comment is required"})
+		return
+	}
+	if len(req.Body) > maxCommentLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Comment too long (max 5000 characters)"})
+		return
+	}
+
+	comment := models.Comment{PasteID: paste.ID, UserID: userID, Body: req.Body}
+	if req.ParentID != nil {
+		var parent models.Comment
+		if result := database.DB.Where("id = ? AND paste_id = ?", *req.ParentID, paste.ID).First(&parent); result.Error != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+			return
+		}
+		// A reply to a reply joins the same thread
+		comment.ParentID = &parent.ID
+		if parent.ParentID != nil {
+			comment.ParentID = parent.ParentID
+		}
+		comment.Revision, comment.StartLine, comment.EndLine = parent.Revision, parent.StartLine, parent.EndLine
+	} else {
+		if req.Revision == 0 {
+			req.Revision = paste.Revision
+		}
+		if req.Revision < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid revision number"})
+			return
+		}
+		rev, aerr := revisionOf(c, paste, req.Revision)
+		if aerr != nil {
+			c.JSON(aerr.status, gin.H{"error": aerr.message})
+			return
+		}
+		if req.EndLine == 0 {
+			req.EndLine = req.StartLine
+		}
+		// The lines of encrypted pastes are only known to their readers
+		lines := strings.Count(rev.Content, "\n") + 1
+		if req.StartLine < 1 || req.EndLine < req.StartLine || (paste.Encryption == "" && req.EndLine > lines) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid line range: revision %d has lines 1 to %d", rev.Number, lines)})
+			return
+		}
+		comment.Revision, comment.StartLine, comment.EndLine = rev.Number, req.StartLine, req.EndLine
+	}
+
+	if err := database.DB.Create(&comment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add comment"})
+		return
+	}
+	database.DB.Preload("User").First(&comment, comment.ID)
+
+	c.JSON(http.StatusCreated, comment)
+}
+
+// managedComment looks up comment :cid of paste :id for a request that
+// moderates it. Authors manage their own comments, and whoever may edit the
+// paste manages them all.
+func (h *PasteHandler) managedComment(c *gin.Context) (*models.Comment, int, string) {
+	paste, aerr := h.loadPaste(c, c.Param("id"))
+	if aerr != nil {
+		return nil, aerr.status, aerr.message
+	}
+
+	var comment models.Comment
+	if result := database.DB.Where("id = ? AND paste_id = ?", c.Param("cid"), paste.ID).First(&comment); result.Error != nil {
+		return nil, http.StatusNotFound, "Comment not found"
+	}
+
+	userID, _ := middleware.GetUserID(c)
+	if comment.UserID != userID && !canEditPaste(c, paste) {
+		return nil, http.StatusForbidden, "Only the author or the owners of the paste can do that"
+	}
+	return &comment, 0, ""
+}
+
+// ResolveComment resolves a thread, or reopens it
+func (h *PasteHandler) ResolveComment(c *gin.Context) {
+	comment, status, msg := h.managedComment(c)
+	if msg != "" {
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+	if comment.ParentID != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only threads can be resolved"})
+		return
+	}
+
+	var req ResolveCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if err := database.DB.Model(comment).Update("resolved", req.Resolved).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, comment)
+}
+
+// DeleteComment removes a comment; deleting the start of a thread removes
+// its replies too
+func (h *PasteHandler) DeleteComment(c *gin.Context) {
+	comment, status, msg := h.managedComment(c)
+	if msg != "" {
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+
+	if err := database.DeleteComment(database.DB, comment); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Comment deleted"})
+}
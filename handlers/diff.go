@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"patbin/diff"
+	"patbin/models"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultDiffContext = 3
+
+// diffSide is one end of a comparison
+type diffSide struct {
+	PasteID  string `json:"paste_id"`
+	Revision int    `json:"revision"`
+	Title    string `json:"title"`
+	Label    string `json:"label"`
+	files    []models.RevisionFile
+}
+
+// fileDiff compares one file across the two ends of a diff
+type fileDiff struct {
+	Filename string      `json:"filename"`
+	Status   string      `json:"status"` // added, removed or modified
+	Stats    diff.Stats  `json:"stats"`
+	Hunks    []diff.Hunk `json:"hunks"`
+	lines    []diff.Line
+}
+
+// diffHunk is a hunk prepared for rendering
+type diffHunk struct {
+	Header string
+	Lines  []diff.Line
+	Rows   []diff.Row
+}
+
+// diffFile is a changed file prepared for rendering
+type diffFile struct {
+	Filename string
+	Status   string
+	Stats    diff.Stats
+	Hunks    []diffHunk
+}
+
+// diffResult holds everything the diff endpoints render
+type diffResult struct {
+	paste *models.Paste
+	from  *diffSide
+	to    *diffSide
+	files []fileDiff // only those that changed
+	stats diff.Stats
+}
+
+// resolveDiffRef parses a diff endpoint reference. A bare number is a
+// revision of the paste being viewed; anything else names another paste,
+// optionally pinned to a revision with "@n" ("id@latest" for its newest).
+func (h *PasteHandler) resolveDiffRef(c *gin.Context, paste *models.Paste, ref string) (*diffSide, *accessError) {
+	target := paste
+	number := ref
+
+	if id, rev, ok := strings.Cut(ref, "@"); ok || !isDigits(ref) {
+		if !ok {
+			rev = "latest"
+		}
+		if id != paste.ID {
+			// The password header is meant for the paste in the URL, so
+			// the other paste has to be unlocked already
+			other, aerr := h.fetchPaste(c, id, h.checkUnlocked)
+			if aerr != nil {
+				return nil, aerr
+			}
+			target = other
+		}
+		number = rev
+		if rev == "" || rev == "latest" {
+			number = strconv.Itoa(target.Revision)
+		}
+	}
+
+	if target.BurnAfterRead {
+		return nil, &accessError{http.StatusForbidden, "Unavailable - Patbin", "Burn-after-read pastes can't be compared"}
+	}
+	if target.Encryption != "" {
+		return nil, &accessError{http.StatusForbidden, "Unavailable - Patbin", "Encrypted pastes can't be compared"}
+	}
+
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 1 {
+		return nil, &accessError{http.StatusBadRequest, "Bad Request - Patbin", "Invalid revision number"}
+	}
+	rev, aerr := revisionOf(c, target, n)
+	if aerr != nil {
+		return nil, aerr
+	}
+
+	// A single-file paste is one file named after its ID, as in pasteFiles
+	files := rev.Files
+	if len(files) == 0 {
+		files = []models.RevisionFile{{
+			Filename: target.ID + "." + models.GetExtensionFromLanguage(rev.Language),
+			Language: rev.Language,
+			Content:  rev.Content,
+		}}
+	}
+
+	return &diffSide{
+		PasteID:  target.ID,
+		Revision: rev.Number,
+		Title:    rev.Title,
+		Label:    fmt.Sprintf("%s@%d", target.ID, rev.Number),
+		files:    files,
+	}, nil
+}
+
+// compareFiles diffs the files of two revisions matched by name, the files
+// of to in order followed by those removed from from, and keeps the ones
+// that changed. Two single files are compared whatever their names.
+func compareFiles(from, to []models.RevisionFile) []fileDiff {
+	var files []fileDiff
+	if len(from) == 1 && len(to) == 1 {
+		files = append(files, fileDiff{Filename: to[0].Filename, Status: "modified", lines: diff.Compute(from[0].Content, to[0].Content)})
+	} else {
+		old := make(map[string]string, len(from))
+		for _, f := range from {
+			old[f.Filename] = f.Content
+		}
+		for _, f := range to {
+			content, ok := old[f.Filename]
+			status := "modified"
+			if !ok {
+				status = "added"
+			}
+			delete(old, f.Filename)
+			files = append(files, fileDiff{Filename: f.Filename, Status: status, lines: diff.Compute(content, f.Content)})
+		}
+		for _, f := range from {
+			if _, ok := old[f.Filename]; ok {
+				files = append(files, fileDiff{Filename: f.Filename, Status: "removed", lines: diff.Compute(f.Content, "")})
+			}
+		}
+	}
+
+	changed := []fileDiff{}
+	for _, f := range files {
+		f.Stats = diff.Count(f.lines)
+		if f.Stats.Added > 0 || f.Stats.Removed > 0 {
+			changed = append(changed, f)
+		}
+	}
+	return changed
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// buildDiff resolves the from/to query parameters against the paste in the
+// URL. Without parameters the latest revision is compared to the one before;
+// from=parent selects the revision a fork was copied from.
+func (h *PasteHandler) buildDiff(c *gin.Context) (*diffResult, *accessError) {
+	paste, aerr := h.loadPaste(c, c.Param("id"))
+	if aerr != nil {
+		return nil, aerr
+	}
+
+	toRef := c.Query("to")
+	if toRef == "" {
+		toRef = strconv.Itoa(paste.Revision)
+	}
+	to, aerr := h.resolveDiffRef(c, paste, toRef)
+	if aerr != nil {
+		return nil, aerr
+	}
+
+	// A fork with no edits of its own is compared against its origin
+	fromRef := c.Query("from")
+	if fromRef == "" {
+		switch {
+		case to.PasteID == paste.ID && to.Revision > 1:
+			fromRef = strconv.Itoa(to.Revision - 1)
+		case to.PasteID == paste.ID && paste.ForkedFromID != nil:
+			fromRef = "parent"
+		default:
+			return nil, &accessError{http.StatusBadRequest, "Nothing to Compare - Patbin", "There is no earlier version to compare against"}
+		}
+	}
+	if fromRef == "parent" {
+		if paste.ForkedFromID == nil {
+			return nil, &accessError{http.StatusBadRequest, "Not a Fork - Patbin", "This paste is not a fork"}
+		}
+		fromRef = *paste.ForkedFromID + "@latest"
+		if paste.ForkedFromRev > 0 {
+			fromRef = fmt.Sprintf("%s@%d", *paste.ForkedFromID, paste.ForkedFromRev)
+		}
+	}
+	from, aerr := h.resolveDiffRef(c, paste, fromRef)
+	if aerr != nil {
+		return nil, aerr
+	}
+
+	result := &diffResult{
+		paste: paste,
+		from:  from,
+		to:    to,
+		files: compareFiles(from.files, to.files),
+	}
+	for _, f := range result.files {
+		result.stats.Added += f.Stats.Added
+		result.stats.Removed += f.Stats.Removed
+	}
+	return result, nil
+}
+
+func diffContext(c *gin.Context) int {
+	n, err := strconv.Atoi(c.Query("context"))
+	if err != nil || n < 0 {
+		return defaultDiffContext
+	}
+	if n > 100 {
+		n = 100
+	}
+	return n
+}
+
+// GetDiff returns a diff between two revisions or pastes, as JSON or as a
+// plain unified diff with ?format=text
+func (h *PasteHandler) GetDiff(c *gin.Context) {
+	result, aerr := h.buildDiff(c)
+	if aerr != nil {
+		if c.Query("format") == "text" {
+			c.String(aerr.status, aerr.message)
+		} else {
+			c.JSON(aerr.status, gin.H{"error": aerr.message})
+		}
+		return
+	}
+
+	// One unified diff per file, with /dev/null standing for a missing side
+	var unified strings.Builder
+	for i := range result.files {
+		f := &result.files[i]
+		f.Hunks = diff.Hunks(f.lines, diffContext(c))
+		fromName, toName := result.from.Label+"/"+f.Filename, result.to.Label+"/"+f.Filename
+		switch f.Status {
+		case "added":
+			fromName = "/dev/null"
+		case "removed":
+			toName = "/dev/null"
+		}
+		unified.WriteString(diff.Unified(fromName, toName, f.Hunks))
+	}
+
+	if c.Query("format") == "text" {
+		c.Header("Content-Type", "text/x-diff; charset=utf-8")
+		c.String(http.StatusOK, unified.String())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":    result.from,
+		"to":      result.to,
+		"stats":   result.stats,
+		"files":   result.files,
+		"unified": unified.String(),
+	})
+}
+
+// DiffPage renders a side-by-side or unified diff
+func (h *PasteHandler) DiffPage(c *gin.Context) {
+	result, aerr := h.buildDiff(c)
+	if aerr != nil {
+		c.HTML(aerr.status, "error.html", gin.H{
+			"title":   aerr.title,
+			"message": aerr.message,
+			"code":    aerr.status,
+		})
+		return
+	}
+
+	view := c.DefaultQuery("view", "split")
+	if view != "unified" {
+		view = "split"
+	}
+
+	var files []diffFile
+	for _, f := range result.files {
+		file := diffFile{Filename: f.Filename, Status: f.Status, Stats: f.Stats}
+		for _, hk := range diff.Hunks(f.lines, diffContext(c)) {
+			file.Hunks = append(file.Hunks, diffHunk{
+				Header: fmt.Sprintf("@@ -%d,%d +%d,%d @@", hk.OldStart, hk.OldLines, hk.NewStart, hk.NewLines),
+				Lines:  hk.Lines,
+				Rows:   diff.SideBySide(hk.Lines),
+			})
+		}
+		files = append(files, file)
+	}
+
+	c.HTML(http.StatusOK, "diff.html", gin.H{
+		"title": "Diff " + result.from.Label + " → " + result.to.Label + " - Patbin",
+		"paste": result.paste,
+		"from":  result.from,
+		"to":    result.to,
+		"stats": result.stats,
+		"files": files,
+		"view":  view,
+	})
+}
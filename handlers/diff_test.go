@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"patbin/config"
+	"patbin/database"
+	"patbin/models"
+	"strings"
+	"testing"
+)
+
+func TestDiffComparesEveryFile(t *testing.T) {
+	setupDB(t)
+	files := func(b string) []models.PasteFile {
+		return []models.PasteFile{{Filename: "a.txt", Content: "same\n"}, {Filename: "b.txt", Content: b}}
+	}
+	paste := &models.Paste{ID: "multi", Content: "same\n", Visibility: models.VisibilityPublic, Revision: 2}
+	storePaste(t, paste, files("new\n")...)
+	for n, b := range map[int]string{1: "old\n", 2: "new\n"} {
+		if err := database.SnapshotRevision(database.DB, &models.Paste{ID: "multi", Content: "same\n", Revision: n, Files: files(b)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := NewPasteHandler(&config.Config{})
+
+	c, w := request(0, http.MethodGet, "/api/paste/multi/diff", "multi")
+	h.GetDiff(c)
+	var body struct {
+		Stats   struct{ Added, Removed int }
+		Files   []fileDiff
+		Unified string
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%d %s: %v", w.Code, w.Body, err)
+	}
+	if len(body.Files) != 1 || body.Files[0].Filename != "b.txt" || body.Files[0].Status != "modified" {
+		t.Fatalf("files = %+v, want b.txt modified", body.Files)
+	}
+	if body.Stats.Added != 1 || body.Stats.Removed != 1 {
+		t.Errorf("stats = %+v, want one line added and one removed", body.Stats)
+	}
+	if !strings.Contains(body.Unified, "--- multi@1/b.txt\n+++ multi@2/b.txt\n") || !strings.Contains(body.Unified, "-old\n+new\n") {
+		t.Errorf("unified diff:\n%s", body.Unified)
+	}
+}
+
+func TestCompareFiles(t *testing.T) {
+	from := []models.RevisionFile{{Filename: "a", Content: "1\n"}, {Filename: "b", Content: "2\n"}}
+	to := []models.RevisionFile{{Filename: "c", Content: "3\n"}, {Filename: "a", Content: "1\n"}}
+	var got []string
+	for _, f := range compareFiles(from, to) {
+		got = append(got, f.Filename+" "+f.Status)
+	}
+	if strings.Join(got, ", ") != "c added, b removed" {
+		t.Errorf("compareFiles = %v", got)
+	}
+
+	// Two single files are compared whatever their names
+	single := compareFiles(from[:1], []models.RevisionFile{{Filename: "x.go", Content: "1\n2\n"}})
+	if len(single) != 1 || single[0].Status != "modified" || single[0].Stats.Added != 1 {
+		t.Errorf("single files = %+v", single)
+	}
+}
+
+func TestDiffAgainstLockedPasteTakesNoAttempt(t *testing.T) {
+	setupDB(t)
+	hash, _ := hashPastePassword("hunter2")
+	storePaste(t, &models.Paste{ID: "mine", Content: "a\n", Visibility: models.VisibilityPublic, Revision: 1})
+	storePaste(t, &models.Paste{ID: "locked", Content: "b\n", Visibility: models.VisibilityPublic, Revision: 1, Password: hash})
+	h := NewPasteHandler(&config.Config{JWTSecret: "secret"})
+
+	for i := 0; i <= maxPasswordAttempts; i++ {
+		c, w := request(0, http.MethodGet, "/api/paste/mine/diff?from=locked&to=1", "mine")
+		c.Request.Header.Set("X-Paste-Password", "wrong")
+		if h.GetDiff(c); w.Code != http.StatusUnauthorized {
+			t.Fatalf("diff against a locked paste: %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+	}
+	c, _ := request(0, http.MethodGet, "/locked", "locked")
+	c.Request.Header.Set("X-Paste-Password", "hunter2")
+	if aerr := h.checkPassword(c, &models.Paste{ID: "locked", Password: hash}); aerr != nil {
+		t.Fatalf("diffs used up the password attempts: %v", aerr)
+	}
+
+	c, w := request(0, http.MethodGet, "/api/paste/mine/diff?from=locked&to=1", "mine")
+	c.Request.AddCookie(&http.Cookie{Name: unlockCookieName("locked"), Value: h.unlockToken(&models.Paste{ID: "locked", Password: hash})})
+	if h.GetDiff(c); w.Code != http.StatusOK {
+		t.Errorf("diff against an unlocked paste: %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"encoding/base64"
+)
+
+// Encrypted pastes are encrypted by the client with a key that only ever
+// travels in the URL fragment. The server stores the ciphertext as is and
+// never highlights, indexes or diffs it.
+const cipherAESGCM = "aes-256-gcm"
+
+const (
+	gcmNonceSize = 12
+	gcmTagSize   = 16
+)
+
+// checkCiphertext validates encrypted content for a cipher: base64 of the
+// 12-byte nonce followed by the sealed content and its tag
+func checkCiphertext(cipher, content string) string {
+	if cipher != cipherAESGCM {
+		return "Unsupported encryption: " + cipher
+	}
+	data, err := base64.StdEncoding.DecodeString(content)
+	if err != nil || len(data) < gcmNonceSize+gcmTagSize {
+		return "Encrypted content must be base64 of the nonce and ciphertext"
+	}
+	return ""
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestCheckCiphertext(t *testing.T) {
+	sealed := base64.StdEncoding.EncodeToString(make([]byte, gcmNonceSize+gcmTagSize+5))
+	short := base64.StdEncoding.EncodeToString(make([]byte, gcmNonceSize+gcmTagSize-1))
+	tests := []struct {
+		cipher, content string
+		err             bool
+	}{
+		{cipherAESGCM, sealed, false},
+		{cipherAESGCM, short, true},
+		{cipherAESGCM, "not base64!", true},
+		{"rot13", sealed, true},
+		{"", strings.Repeat("A", 40), true},
+	}
+	for _, tt := range tests {
+		if msg := checkCiphertext(tt.cipher, tt.content); (msg != "") != tt.err {
+			t.Errorf("checkCiphertext(%q, %q) = %q, want error %v", tt.cipher, tt.content, msg, tt.err)
+		}
+	}
+}
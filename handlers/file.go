@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"archive/zip"
+	"html/template"
+	"net/http"
+	"patbin/langdetect"
+	"patbin/models"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const maxPasteFiles = 20
+
+type FileRequest struct {
+	Filename string `json:"filename"`
+	Content  string `json:"content"`
+	Language string `json:"language"`
+}
+
+// fileView is one tab of the paste view page
+type fileView struct {
+	Filename    string
+	Language    string
+	Lines       int
+	Highlighted template.HTML
+	Ciphertext  string       // set instead of Highlighted for encrypted pastes
+	Comments    map[int]uint // line to the first comment thread on it, in the first file
+}
+
+// buildFiles validates the files of a multi-file paste. Files without a
+// language get one detected from their name and content.
+func buildFiles(reqs []FileRequest) ([]models.PasteFile, string) {
+	if len(reqs) > maxPasteFiles {
+		return nil, "Too many files (max 20)"
+	}
+
+	files := make([]models.PasteFile, 0, len(reqs))
+	seen := make(map[string]bool)
+	total := 0
+	for _, req := range reqs {
+		name := strings.TrimSpace(req.Filename)
+		switch {
+		case name == "" || name == "." || name == "..":
+			return nil, "Every file needs a name"
+		case len(name) > 255 || strings.ContainsAny(name, "/\\"):
+			return nil, "Invalid filename: " + name
+		case seen[name]:
+			return nil, "Duplicate filename: " + name
+		case req.Content == "":
+			return nil, "File is empty: " + name
+		}
+		seen[name] = true
+
+		total += len(req.Content)
+		if total > maxContentSize {
+			return nil, "Content too large (max 512 KB)"
+		}
+
+		language := req.Language
+		if language == "" {
+			language = langdetect.Detect(req.Content, name).Language
+		}
+		files = append(files, models.PasteFile{
+			Filename: name,
+			Language: language,
+			Content:  req.Content,
+		})
+	}
+	return files, ""
+}
+
+// pasteFiles returns the files of a paste. A single-file paste is presented
+// as one file named after its ID.
+func pasteFiles(paste *models.Paste) []models.PasteFile {
+	if len(paste.Files) > 0 {
+		return paste.Files
+	}
+	return []models.PasteFile{{
+		PasteID:  paste.ID,
+		Filename: paste.ID + "." + models.GetExtensionFromLanguage(paste.Language),
+		Language: paste.Language,
+		Content:  paste.Content,
+	}}
+}
+
+// GetRawFile returns the raw content of one file of a paste
+func (h *PasteHandler) GetRawFile(c *gin.Context) {
+	paste, aerr := h.loadPaste(c, c.Param("id"))
+	if aerr != nil {
+		c.String(aerr.status, aerr.message)
+		return
+	}
+
+	// A mistyped name must not burn the paste
+	var file *models.PasteFile
+	for _, f := range pasteFiles(paste) {
+		if f.Filename == c.Param("filename") {
+			file = &f
+			break
+		}
+	}
+	if file == nil {
+		c.String(http.StatusNotFound, "File not found")
+		return
+	}
+	if aerr := confirmBurn(c, paste); aerr != nil {
+		c.String(aerr.status, aerr.message)
+		return
+	}
+
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.String(http.StatusOK, file.Content)
+}
+
+// DownloadZip sends every file of a paste as a zip archive
+func (h *PasteHandler) DownloadZip(c *gin.Context) {
+	paste, aerr := h.loadPaste(c, c.Param("id"))
+	if aerr == nil {
+		aerr = confirmBurn(c, paste)
+	}
+	if aerr != nil {
+		c.String(aerr.status, aerr.message)
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", `attachment; filename="`+paste.ID+`.zip"`)
+	c.Status(http.StatusOK)
+
+	zw := zip.NewWriter(c.Writer)
+	for _, f := range pasteFiles(paste) {
+		w, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     f.Filename,
+			Method:   zip.Deflate,
+			Modified: paste.UpdatedAt,
+		})
+		if err != nil {
+			return
+		}
+		if _, err := w.Write([]byte(f.Content)); err != nil {
+			return
+		}
+	}
+	zw.Close()
+}
+
+// orderFiles preloads the files of a paste in tab order
+func orderFiles(db *gorm.DB) *gorm.DB {
+	return db.Order("position")
+}
+
+// sameFiles reports whether two file lists have the same names, languages
+// and contents in the same order
+func sameFiles(a, b []models.PasteFile) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Filename != b[i].Filename || a[i].Language != b[i].Language || a[i].Content != b[i].Content {
+			return false
+		}
+	}
+	return true
+}
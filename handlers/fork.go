@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http"
+	"patbin/database"
+	"patbin/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxForkDepth bounds how many generations of forks are returned
+const maxForkDepth = 10
+
+// forkNode is one paste in a fork tree
+type forkNode struct {
+	ID         string      `json:"id"`
+	Title      string      `json:"title"`
+	Username   string      `json:"username,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	ForkCount  int         `json:"fork_count"`
+	TotalForks int         `json:"total_forks"`
+	Forks      []*forkNode `json:"forks"`
+}
+
+func newForkNode(paste *models.Paste) *forkNode {
+	node := &forkNode{
+		ID:        paste.ID,
+		Title:     paste.Title,
+		CreatedAt: paste.CreatedAt,
+		Forks:     []*forkNode{},
+	}
+	if paste.User != nil {
+		node.Username = paste.User.Username
+	}
+	return node
+}
+
+// countForks fills in the descendant totals bottom-up
+func countForks(node *forkNode) int {
+	node.ForkCount = len(node.Forks)
+	node.TotalForks = node.ForkCount
+	for _, child := range node.Forks {
+		node.TotalForks += countForks(child)
+	}
+	return node.TotalForks
+}
+
+// ListForks returns the tree of forks below a paste. Forks the current user
+// can't see are left out, along with everything forked from them.
+func (h *PasteHandler) ListForks(c *gin.Context) {
+	paste, aerr := h.loadPaste(c, c.Param("id"))
+	if aerr != nil {
+		c.JSON(aerr.status, gin.H{"error": aerr.message})
+		return
+	}
+
+	root := newForkNode(paste)
+	level := map[string]*forkNode{paste.ID: root}
+
+	for depth := 0; depth < maxForkDepth && len(level) > 0; depth++ {
+		ids := make([]string, 0, len(level))
+		for id := range level {
+			ids = append(ids, id)
+		}
+
+		var children []models.Paste
+		database.DB.Scopes(database.NotExpired).
+			Where("forked_from_id IN ?", ids).
+			Order("created_at ASC").
+			Preload("User").
+			Find(&children)
+
+		next := make(map[string]*forkNode)
+		for i := range children {
+			child := &children[i]
+			if !canListPaste(c, child) {
+				continue
+			}
+			node := newForkNode(child)
+			parent := level[*child.ForkedFromID]
+			parent.Forks = append(parent.Forks, node)
+			next[child.ID] = node
+		}
+		level = next
+	}
+
+	countForks(root)
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":             root.ID,
+		"forked_from_id": paste.ForkedFromID,
+		"fork_count":     root.ForkCount,
+		"total_forks":    root.TotalForks,
+		"forks":          root.Forks,
+	})
+}
@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"net/http"
+	"patbin/database"
+	"patbin/middleware"
+	"patbin/models"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Organization names end up in URLs, so they are kept to a safe alphabet
+var orgNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{2,49}$`)
+
+const errOrgCollection = "Organization pastes can't be filed in collections"
+
+type OrgHandler struct{}
+
+func NewOrgHandler() *OrgHandler {
+	return &OrgHandler{}
+}
+
+type CreateOrgRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type SetMemberRequest struct {
+	Role string `json:"role"`
+}
+
+// findOrg looks up an organization by name
+func findOrg(name string) (*models.Org, bool) {
+	var org models.Org
+	if result := database.DB.Where("name = ?", name).First(&org); result.Error != nil {
+		return nil, false
+	}
+	return &org, true
+}
+
+// orgRole returns the current user's role in an organization
+func orgRole(c *gin.Context, org *models.Org) string {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		return ""
+	}
+	return database.MemberRole(org.ID, userID)
+}
+
+// writableOrg looks up an organization the current user may add pastes to,
+// for a request handing a paste to it
+func writableOrg(c *gin.Context, name string) (*models.Org, string) {
+	if _, ok := middleware.GetUserID(c); !ok {
+		return nil, "Log in to create organization pastes"
+	}
+	org, ok := findOrg(name)
+	if !ok {
+		return nil, "Organization not found"
+	}
+	if role := orgRole(c, org); role != models.RoleOwner && role != models.RoleEditor {
+		return nil, "Only owners and editors can add pastes to " + org.Name
+	}
+	return org, ""
+}
+
+// writableOrgs lists the organizations a user may add pastes to, for forms
+func writableOrgs(userID uint) []models.Org {
+	orgs, _ := database.UserOrgs(userID)
+	return slices.DeleteFunc(orgs, func(o models.Org) bool { return o.Role == models.RoleViewer })
+}
+
+// orgPastes queries the current pastes of an organization that a user with
+// role may list: all of them for members, the public ones for anyone else
+func orgPastes(org *models.Org, role string) *gorm.DB {
+	query := database.DB.Model(&models.Paste{}).Scopes(database.NotExpired).Where("org_id = ?", org.ID)
+	if role == "" {
+		query = query.Where("visibility = ?", models.VisibilityPublic)
+	}
+	return query
+}
+
+// ListOrgs returns the organizations of the current user with their role
+func (h *OrgHandler) ListOrgs(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	orgs, err := database.UserOrgs(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list organizations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"orgs": orgs})
+}
+
+// CreateOrg creates an organization owned by the current user
+func (h *OrgHandler) CreateOrg(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	var req CreateOrgRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	req.Name = strings.ToLower(strings.TrimSpace(req.Name))
+	req.Description = strings.TrimSpace(req.Description)
+	if !orgNamePattern.MatchString(req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Organization names are 3 to 50 letters, digits or dashes"})
+		return
+	}
+	if len(req.Description) > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Description too long (max 500 characters)"})
+		return
+	}
+	if _, taken := findOrg(req.Name); taken {
+		c.JSON(http.StatusConflict, gin.H{"error": "Organization name already taken"})
+		return
+	}
+
+	org := models.Org{Name: req.Name, Description: req.Description}
+	if err := database.CreateOrg(database.DB, &org, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create organization"})
+		return
+	}
+	org.Role = models.RoleOwner
+
+	c.JSON(http.StatusCreated, org)
+}
+
+// GetOrg returns an organization and a page of its pastes. Members see all
+// of them, and the member list; everyone else the public pastes.
+func (h *OrgHandler) GetOrg(c *gin.Context) {
+	org, ok := findOrg(c.Param("org"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return
+	}
+
+	opts, msg := parsePage(c)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	org.Role = orgRole(c, org)
+	// Listings never carry content, which may be behind a password
+	pastes, next, err := database.PastePage(orgPastes(org, org.Role).
+		Omit("content").
+		Preload("User").
+		Preload("Tags", database.OrderTags), opts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return
+	}
+
+	resp := gin.H{
+		"org":         org,
+		"pastes":      pastes,
+		"next_cursor": next,
+	}
+	if org.Role != "" {
+		resp["members"], _ = database.OrgMembers(org.ID)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// SetMember adds a user to an organization or changes their role. Only
+// owners manage members.
+func (h *OrgHandler) SetMember(c *gin.Context) {
+	org, ok := findOrg(c.Param("org"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return
+	}
+	if orgRole(c, org) != models.RoleOwner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only owners can manage members"})
+		return
+	}
+
+	var req SetMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if !slices.Contains(models.OrgRoles, req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role: use owner, editor or viewer"})
+		return
+	}
+
+	var user models.User
+	if result := database.DB.Where("username = ?", c.Param("username")).First(&user); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var member models.OrgMember
+	var err error
+	if database.DB.Where("org_id = ? AND user_id = ?", org.ID, user.ID).First(&member).Error == nil {
+		if member.Role == models.RoleOwner && req.Role != models.RoleOwner && database.OwnerCount(org.ID) == 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "An organization needs at least one owner"})
+			return
+		}
+		err = database.DB.Model(&member).Update("role", req.Role).Error
+	} else {
+		member = models.OrgMember{OrgID: org.ID, UserID: user.ID, Role: req.Role}
+		err = database.DB.Create(&member).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update member"})
+		return
+	}
+	member.User = &user
+
+	c.JSON(http.StatusOK, member)
+}
+
+// RemoveMember takes a user out of an organization. Owners can remove
+// anyone, and members can leave. The pastes they created stay behind.
+func (h *OrgHandler) RemoveMember(c *gin.Context) {
+	org, ok := findOrg(c.Param("org"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return
+	}
+
+	var member models.OrgMember
+	err := database.DB.Joins("User").
+		Where("org_members.org_id = ? AND User.username = ?", org.ID, c.Param("username")).
+		First(&member).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	}
+
+	userID, _ := middleware.GetUserID(c)
+	if member.UserID != userID && orgRole(c, org) != models.RoleOwner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only owners can manage members"})
+		return
+	}
+	if member.Role == models.RoleOwner && database.OwnerCount(org.ID) == 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An organization needs at least one owner"})
+		return
+	}
+
+	if err := database.DB.Delete(&member).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed"})
+}
+
+// GetOrgPage renders the profile page of an organization
+func (h *OrgHandler) GetOrgPage(c *gin.Context) {
+	org, ok := findOrg(c.Param("org"))
+	if !ok {
+		c.HTML(http.StatusNotFound, "error.html", gin.H{
+			"title":   "Not Found - Patbin",
+			"message": "Organization not found",
+		})
+		return
+	}
+
+	opts, msg := parsePage(c)
+	if msg != "" {
+		c.HTML(http.StatusBadRequest, "error.html", gin.H{
+			"title":   "Bad Request - Patbin",
+			"message": msg,
+			"code":    http.StatusBadRequest,
+		})
+		return
+	}
+
+	org.Role = orgRole(c, org)
+	listed := orgPastes(org, org.Role)
+	pastes, next, err := database.PastePage(listed.Session(&gorm.Session{}).
+		Preload("User").
+		Preload("Tags", database.OrderTags), opts)
+	if err != nil {
+		c.Redirect(http.StatusFound, c.Request.URL.Path)
+		return
+	}
+	var count int64
+	listed.Count(&count)
+
+	var members []models.OrgMember
+	if org.Role != "" {
+		members, _ = database.OrgMembers(org.ID)
+	}
+	username, _ := middleware.GetUsername(c)
+
+	c.HTML(http.StatusOK, "org.html", gin.H{
+		"title":    org.Name + " - Patbin",
+		"org":      org,
+		"username": username,
+		"members":  members,
+		"roles":    models.OrgRoles,
+		"pastes":   pastes,
+		"count":    count,
+		"page":     newPageLinks(c.Request.URL.Path, nil, opts, next),
+	})
+}
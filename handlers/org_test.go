@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"patbin/database"
+	"patbin/models"
+	"path/filepath"
+	"testing"
+)
+
+func TestOrgPasteRoles(t *testing.T) {
+	if err := database.Init(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	org := models.Org{Name: "acme"}
+	if err := database.CreateOrg(database.DB, &org, 1); err != nil {
+		t.Fatal(err)
+	}
+	members := []models.OrgMember{
+		{OrgID: org.ID, UserID: 2, Role: models.RoleEditor},
+		{OrgID: org.ID, UserID: 3, Role: models.RoleViewer},
+	}
+	if err := database.DB.Create(&members).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	editor := uint(2)
+	byEditor := &models.Paste{Visibility: models.VisibilityPrivate, OrgID: &org.ID, UserID: &editor}
+	owner := uint(1)
+	byOwner := &models.Paste{Visibility: models.VisibilityPrivate, OrgID: &org.ID, UserID: &owner}
+
+	tests := []struct {
+		user        uint
+		paste       *models.Paste
+		view, edit  bool
+		deletePaste bool
+	}{
+		{1, byEditor, true, true, true},
+		{2, byEditor, true, true, true},
+		{2, byOwner, true, true, false},
+		{3, byOwner, true, false, false},
+		{4, byOwner, false, false, false},
+		{0, byOwner, false, false, false},
+	}
+	for _, tt := range tests {
+		c := asUser(tt.user)
+		if got := canViewPaste(c, tt.paste); got != tt.view {
+			t.Errorf("user %d: view %v, want %v", tt.user, got, tt.view)
+		}
+		if got := canEditPaste(c, tt.paste); got != tt.edit {
+			t.Errorf("user %d: edit %v, want %v", tt.user, got, tt.edit)
+		}
+		if got := canDeletePaste(c, tt.paste); got != tt.deletePaste {
+			t.Errorf("user %d: delete %v, want %v", tt.user, got, tt.deletePaste)
+		}
+	}
+
+	if n := database.OwnerCount(org.ID); n != 1 {
+		t.Errorf("%d owners, want 1", n)
+	}
+	orgs, err := database.UserOrgs(3)
+	if err != nil || len(orgs) != 1 || orgs[0].Role != models.RoleViewer {
+		t.Errorf("UserOrgs(3) = %+v, %v", orgs, err)
+	}
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"net/url"
+	"patbin/database"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// pageSorts are the orders offered on listing pages, in display order
+var pageSorts = []struct{ Sort, Label string }{
+	{database.SortCreated, "Newest"},
+	{database.SortUpdated, "Updated"},
+	{database.SortViews, "Most viewed"},
+	{database.SortStars, "Most starred"},
+	{database.SortTitle, "Title"},
+}
+
+// parsePage reads ?sort=&order=&cursor=&limit= of a paste listing. Titles
+// sort A-Z by default and everything else newest or largest first.
+func parsePage(c *gin.Context) (database.PageOptions, string) {
+	opts := database.PageOptions{
+		Sort:   c.DefaultQuery("sort", database.SortCreated),
+		Cursor: c.Query("cursor"),
+		Limit:  defaultPageLimit,
+	}
+	if !database.ValidSort(opts.Sort) {
+		return opts, "Invalid sort: use created, updated, views, stars or title"
+	}
+	switch c.Query("order") {
+	case "asc":
+	case "desc":
+		opts.Desc = true
+	case "":
+		opts.Desc = opts.Sort != database.SortTitle
+	default:
+		return opts, "Invalid order: use asc or desc"
+	}
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return opts, "Invalid limit"
+		}
+		opts.Limit = min(n, maxPageLimit)
+	}
+	return opts, ""
+}
+
+// sortLink is one of the sort options above a listing page
+type sortLink struct {
+	Label  string
+	URL    string
+	Active bool
+}
+
+// pageLinks are the links to reorder and page through a listing at path,
+// keeping the filter in its query parameters
+type pageLinks struct {
+	Sorts []sortLink
+	First string // set when past the first page
+	Next  string // set when there is a next page
+}
+
+func newPageLinks(path string, filter url.Values, opts database.PageOptions, next string) pageLinks {
+	link := func(v url.Values) string {
+		if len(v) == 0 {
+			return path
+		}
+		return path + "?" + v.Encode()
+	}
+	// Defaults are left out of the URLs
+	query := func(sort string) url.Values {
+		v := url.Values{}
+		for key, values := range filter {
+			v[key] = values
+		}
+		if sort != database.SortCreated {
+			v.Set("sort", sort)
+		}
+		return v
+	}
+
+	var links pageLinks
+	for _, s := range pageSorts {
+		links.Sorts = append(links.Sorts, sortLink{Label: s.Label, URL: link(query(s.Sort)), Active: s.Sort == opts.Sort})
+	}
+
+	current := query(opts.Sort)
+	if opts.Desc != (opts.Sort != database.SortTitle) {
+		if opts.Desc {
+			current.Set("order", "desc")
+		} else {
+			current.Set("order", "asc")
+		}
+	}
+	if opts.Limit != defaultPageLimit {
+		current.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Cursor != "" {
+		links.First = link(current)
+	}
+	if next != "" {
+		current.Set("cursor", next)
+		links.Next = link(current)
+	}
+	return links
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"patbin/database"
+	"patbin/middleware"
+	"patbin/models"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Wrong guesses at a paste password are limited per paste, so spreading
+// them over many clients doesn't help
+const (
+	maxPasswordAttempts = 5
+	passwordWindow      = 15 * time.Minute
+	unlockCookieMaxAge  = 24 * 60 * 60
+)
+
+var (
+	errPasswordRequired = &accessError{http.StatusUnauthorized, "Locked - Patbin", "This paste is password protected"}
+	errWrongPassword    = &accessError{http.StatusUnauthorized, "Locked - Patbin", "Wrong password"}
+	errTooManyAttempts  = &accessError{http.StatusTooManyRequests, "Locked - Patbin", "Too many wrong passwords, try again later"}
+)
+
+// passwordThrottle counts password attempts per paste in a fixed window
+type passwordThrottle struct {
+	mu       sync.Mutex
+	attempts map[string]*passwordAttempts
+}
+
+type passwordAttempts struct {
+	count int
+	since time.Time
+}
+
+func newPasswordThrottle() *passwordThrottle {
+	return &passwordThrottle{attempts: make(map[string]*passwordAttempts)}
+}
+
+// take claims an attempt at the password of a paste. When none are left it
+// returns false and how long until the window resets. Attempts are claimed
+// before checking, so concurrent guesses can't slip past the limit.
+func (t *passwordThrottle) take(id string, now time.Time) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Forget windows that have run out once the map gets big
+	if len(t.attempts) > 1024 {
+		for k, a := range t.attempts {
+			if now.Sub(a.since) >= passwordWindow {
+				delete(t.attempts, k)
+			}
+		}
+	}
+
+	a, ok := t.attempts[id]
+	if !ok || now.Sub(a.since) >= passwordWindow {
+		a = &passwordAttempts{since: now}
+		t.attempts[id] = a
+	}
+	if a.count >= maxPasswordAttempts {
+		return a.since.Add(passwordWindow).Sub(now), false
+	}
+	a.count++
+	return 0, true
+}
+
+// reset clears the attempts on a paste after a correct password
+func (t *passwordThrottle) reset(id string) {
+	t.mu.Lock()
+	delete(t.attempts, id)
+	t.mu.Unlock()
+}
+
+// hashPastePassword bcrypts a paste password, "" staying "" for no password
+func hashPastePassword(password string) (string, string) {
+	if password == "" {
+		return "", ""
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", "Invalid password (max 72 bytes)"
+	}
+	return string(hash), ""
+}
+
+func unlockCookieName(id string) string {
+	return "patbin_unlock_" + id
+}
+
+// unlockToken is the value of the cookie that unlocks a paste. It covers the
+// password hash, so changing the password locks out earlier visitors.
+func (h *PasteHandler) unlockToken(paste *models.Paste) string {
+	mac := hmac.New(sha256.New, []byte(h.cfg.JWTSecret))
+	mac.Write([]byte("unlock:" + paste.ID + ":" + paste.Password))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// checkPassword lets a request through to a password-protected paste when
+// it comes from someone who may edit it, carries an unlock cookie or has the
+// password in the X-Paste-Password header
+func (h *PasteHandler) checkPassword(c *gin.Context, paste *models.Paste) *accessError {
+	if h.unlocked(c, paste) {
+		return nil
+	}
+	password := c.GetHeader("X-Paste-Password")
+	if password == "" {
+		return errPasswordRequired
+	}
+	return h.verifyPassword(c, paste, password)
+}
+
+// checkUnlocked lets a request through to a password-protected paste only
+// when it is already unlocked, without taking a password attempt. It guards
+// the pastes a request reaches besides the one in its URL.
+func (h *PasteHandler) checkUnlocked(c *gin.Context, paste *models.Paste) *accessError {
+	if h.unlocked(c, paste) {
+		return nil
+	}
+	return errPasswordRequired
+}
+
+// unlocked reports whether a paste needs no password from this request: it
+// has none, the user may edit it or the request carries its unlock cookie
+func (h *PasteHandler) unlocked(c *gin.Context, paste *models.Paste) bool {
+	if paste.Password == "" || canEditPaste(c, paste) {
+		return true
+	}
+	cookie, err := c.Cookie(unlockCookieName(paste.ID))
+	return err == nil && hmac.Equal([]byte(cookie), []byte(h.unlockToken(paste)))
+}
+
+// verifyPassword checks a password guess against the throttle and the hash
+func (h *PasteHandler) verifyPassword(c *gin.Context, paste *models.Paste, password string) *accessError {
+	if wait, ok := h.passwords.take(paste.ID, time.Now()); !ok {
+		c.Header("Retry-After", strconv.Itoa(int(wait/time.Second)+1))
+		return errTooManyAttempts
+	}
+	if bcrypt.CompareHashAndPassword([]byte(paste.Password), []byte(password)) != nil {
+		return errWrongPassword
+	}
+	h.passwords.reset(paste.ID)
+	return nil
+}
+
+// renderLocked renders the unlock form when aerr asks for a password and
+// the error page otherwise
+func renderLocked(c *gin.Context, id string, aerr *accessError) {
+	if aerr != errPasswordRequired && aerr != errWrongPassword && aerr != errTooManyAttempts {
+		c.HTML(aerr.status, "error.html", gin.H{
+			"title":   aerr.title,
+			"message": aerr.message,
+			"code":    aerr.status,
+		})
+		return
+	}
+
+	renderUnlock(c, id, c.Request.URL.RequestURI(), aerr)
+}
+
+// renderUnlock renders the unlock form, which returns to next once unlocked
+func renderUnlock(c *gin.Context, id, next string, aerr *accessError) {
+	message := ""
+	if aerr != errPasswordRequired {
+		message = aerr.message
+	}
+	c.HTML(aerr.status, "unlock.html", gin.H{
+		"title":  aerr.title,
+		"action": "/" + id + "/unlock",
+		"next":   next,
+		"error":  message,
+		"csrf":   middleware.CSRFToken(c),
+	})
+}
+
+// UnlockPaste checks the password posted from the unlock form and sets the
+// cookie that unlocks the paste
+func (h *PasteHandler) UnlockPaste(c *gin.Context) {
+	id := c.Param("id")
+
+	var paste models.Paste
+	if result := database.DB.Select("id", "password", "user_id").First(&paste, "id = ?", id); result.Error != nil {
+		c.HTML(http.StatusNotFound, "error.html", gin.H{
+			"title":   "Not Found - Patbin",
+			"message": "Paste not found",
+			"code":    http.StatusNotFound,
+		})
+		return
+	}
+
+	// Only send people back to a page of the same paste
+	next := c.PostForm("next")
+	if rest, ok := strings.CutPrefix(next, "/"+id); !ok || (rest != "" && !strings.ContainsAny(rest[:1], "/?.")) {
+		next = "/" + id
+	}
+
+	if paste.Password != "" {
+		if aerr := h.verifyPassword(c, &paste, c.PostForm("password")); aerr != nil {
+			renderUnlock(c, id, next, aerr)
+			return
+		}
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(unlockCookieName(paste.ID), h.unlockToken(&paste), unlockCookieMaxAge, "/", "", false, true)
+	}
+
+	c.Redirect(http.StatusSeeOther, next)
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"patbin/config"
+	"patbin/models"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func TestPasswordThrottle(t *testing.T) {
+	throttle := newPasswordThrottle()
+	now := time.Unix(1700000000, 0)
+
+	for i := 0; i < maxPasswordAttempts; i++ {
+		if _, ok := throttle.take("p", now); !ok {
+			t.Fatalf("attempt %d refused", i+1)
+		}
+	}
+	wait, ok := throttle.take("p", now.Add(time.Minute))
+	if ok || wait != passwordWindow-time.Minute {
+		t.Fatalf("take = %v, %v; want refused for the rest of the window", wait, ok)
+	}
+	if _, ok := throttle.take("other", now); !ok {
+		t.Error("pastes should be throttled separately")
+	}
+	if _, ok := throttle.take("p", now.Add(passwordWindow)); !ok {
+		t.Error("a new window should allow attempts again")
+	}
+
+	throttle.reset("p")
+	for i := 0; i < maxPasswordAttempts; i++ {
+		if _, ok := throttle.take("p", now); !ok {
+			t.Fatalf("attempt %d after reset refused", i+1)
+		}
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	h := NewPasteHandler(&config.Config{JWTSecret: "secret"})
+	hash, msg := hashPastePassword("hunter2")
+	if msg != "" {
+		t.Fatal(msg)
+	}
+	paste := &models.Paste{ID: "locked", Password: hash}
+
+	check := func(header, cookie string) *accessError {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/locked", nil)
+		if header != "" {
+			c.Request.Header.Set("X-Paste-Password", header)
+		}
+		if cookie != "" {
+			c.Request.AddCookie(&http.Cookie{Name: unlockCookieName(paste.ID), Value: cookie})
+		}
+		return h.checkPassword(c, paste)
+	}
+
+	if aerr := check("", ""); aerr != errPasswordRequired {
+		t.Errorf("no password: %v", aerr)
+	}
+	if aerr := check("hunter2", ""); aerr != nil {
+		t.Errorf("right password: %v", aerr)
+	}
+	if aerr := check("", h.unlockToken(paste)); aerr != nil {
+		t.Errorf("unlock cookie: %v", aerr)
+	}
+	if aerr := check("", "forged"); aerr != errPasswordRequired {
+		t.Errorf("forged cookie: %v", aerr)
+	}
+
+	for i := 0; i < maxPasswordAttempts; i++ {
+		if aerr := check("wrong", ""); aerr != errWrongPassword {
+			t.Fatalf("wrong password %d: %v", i+1, aerr)
+		}
+	}
+	if aerr := check("hunter2", ""); aerr != errTooManyAttempts {
+		t.Errorf("right password after too many guesses: %v", aerr)
+	}
+
+	// Changing the password invalidates unlock cookies
+	token := h.unlockToken(paste)
+	paste.Password, _ = hashPastePassword("new")
+	if aerr := check("", token); aerr != errPasswordRequired {
+		t.Errorf("cookie for the old password: %v", aerr)
+	}
+
+	if hash, msg := hashPastePassword(""); hash != "" || msg != "" {
+		t.Error("an empty password should mean none")
+	}
+}
@@ -3,36 +3,104 @@ package handlers
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"fmt"
+	"html/template"
 	"net/http"
+	"patbin/config"
 	"patbin/database"
+	"patbin/highlight"
+	"patbin/langdetect"
 	"patbin/middleware"
 	"patbin/models"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-type PasteHandler struct{}
+const maxContentSize = 512 * 1024 // 512 KB
 
-func NewPasteHandler() *PasteHandler {
-	return &PasteHandler{}
+type PasteHandler struct {
+	cfg        *config.Config
+	highlights *highlight.Cache
+	passwords  *passwordThrottle
+}
+
+func NewPasteHandler(cfg *config.Config) *PasteHandler {
+	return &PasteHandler{
+		cfg:        cfg,
+		highlights: highlight.NewCache(256),
+		passwords:  newPasswordThrottle(),
+	}
 }
 
 type CreatePasteRequest struct {
-	Title         string `json:"title"`
-	Content       string `json:"content" binding:"required"`
-	Language      string `json:"language"`
-	IsPublic      bool   `json:"is_public"`
+	Title    string `json:"title"`
+	Content  string `json:"content"`
+	Language string `json:"language"`
+	Filename string `json:"filename"` // optional, used to detect the language
+	// Visibility is "public" (the default), "unlisted" or "private"
+	Visibility string `json:"visibility"`
+	// IsPublic is what older clients send instead of Visibility
+	IsPublic      *bool  `json:"is_public"`
 	ExpiresIn     string `json:"expires_in"` // "1h", "1d", "1w", "never"
 	BurnAfterRead bool   `json:"burn_after_read"`
+	// Encryption marks Content as ciphertext made by the client ("aes-256-gcm")
+	Encryption string `json:"encryption"`
+	// Password, if set, must be given to read the paste
+	Password string `json:"password"`
+	// Files makes a multi-file paste; Content and Language then come from the first file
+	Files []FileRequest `json:"files"`
+	Tags  []string      `json:"tags"`
+	// CollectionID files the paste in one of the user's collections
+	CollectionID *uint `json:"collection_id"`
+	// Org names an organization of the user to own the paste
+	Org string `json:"org"`
 }
 
 type UpdatePasteRequest struct {
-	Title    string `json:"title"`
+	Title      string `json:"title"`
+	Content    string `json:"content"`
+	Language   string `json:"language"`
+	Visibility string `json:"visibility"`
+	IsPublic   *bool  `json:"is_public"` // instead of Visibility, from older clients
+	// Password sets a new password; an empty string removes it
+	Password *string `json:"password"`
+	// Files, when present, replaces all files of the paste
+	Files []FileRequest `json:"files"`
+	// Tags, when present, replaces all tags of the paste
+	Tags []string `json:"tags"`
+	// CollectionID moves the paste to another collection; 0 takes it out
+	CollectionID *uint `json:"collection_id"`
+	// Org hands a paste of the user's own to one of their organizations
+	Org string `json:"org"`
+}
+
+type DetectLanguageRequest struct {
+	Content  string `json:"content"`
+	Filename string `json:"filename"`
+}
+
+type HighlightRequest struct {
 	Content  string `json:"content"`
 	Language string `json:"language"`
-	IsPublic *bool  `json:"is_public"`
+}
+
+// splitExt separates an optional file extension from a paste ID
+func splitExt(id string) (string, string) {
+	if idx := strings.LastIndex(id, "."); idx != -1 {
+		return id[:idx], id[idx+1:]
+	}
+	return id, ""
+}
+
+// flushBlobs copies the content a request just committed out to the
+// storage backend. Whatever fails stays in the database until the janitor
+// retries it.
+func flushBlobs(c *gin.Context) {
+	database.FlushBlobs(c.Request.Context(), 100)
 }
 
 // generateID creates a random 8-character hex ID
@@ -42,19 +110,106 @@ func generateID() string {
 	return hex.EncodeToString(bytes)
 }
 
+// pasteVisibility validates the visibility asked for, falling back to the
+// is_public flag of older clients and then to public
+func pasteVisibility(c *gin.Context, visibility string, isPublic *bool) (string, string) {
+	if visibility == "" {
+		visibility = models.VisibilityPublic
+		if isPublic != nil && !*isPublic {
+			visibility = models.VisibilityPrivate
+		}
+	}
+	if !slices.Contains(models.Visibilities, visibility) {
+		return "", "Invalid visibility: use public, unlisted or private"
+	}
+	// Nobody could ever read a private paste without an owner
+	if _, ok := middleware.GetUserID(c); !ok && visibility == models.VisibilityPrivate {
+		return "", "Log in to create private pastes, or make it unlisted"
+	}
+	return visibility, ""
+}
+
 // CreatePaste creates a new paste
 func (h *PasteHandler) CreatePaste(c *gin.Context) {
 	var req CreatePasteRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Content == "" && len(req.Files) == 0) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Content is required"})
 		return
 	}
 
-	const maxContentSize = 512 * 1024 // 512 KB
-	if len(req.Content) > maxContentSize {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Content too large (max 512 KB)"})
+	paste, status, msg := createPaste(c, &req)
+	if msg != "" {
+		c.JSON(status, gin.H{"error": msg})
 		return
 	}
+
+	c.JSON(http.StatusCreated, paste)
+}
+
+// createPaste validates req and stores the paste it describes, returning
+// the status and message of the error when it can't
+func createPaste(c *gin.Context, req *CreatePasteRequest) (*models.Paste, int, string) {
+	var files []models.PasteFile
+	if len(req.Files) > 0 {
+		var msg string
+		if files, msg = buildFiles(req.Files); msg != "" {
+			return nil, http.StatusBadRequest, msg
+		}
+		req.Content, req.Language = files[0].Content, files[0].Language
+	}
+
+	if len(req.Content) > maxContentSize {
+		return nil, http.StatusBadRequest, "Content too large (max 512 KB)"
+	}
+
+	if req.Encryption != "" {
+		msg := checkCiphertext(req.Encryption, req.Content)
+		if msg == "" && len(files) > 0 {
+			msg = "Encrypted pastes can't have multiple files"
+		}
+		if msg != "" {
+			return nil, http.StatusBadRequest, msg
+		}
+		// There is nothing to detect a language from
+		if req.Language == "" {
+			req.Language = "plaintext"
+		}
+	}
+	// Fill in the language when the client didn't pick one
+	if req.Language == "" {
+		req.Language = langdetect.Detect(req.Content, req.Filename).Language
+	}
+
+	password, msg := hashPastePassword(req.Password)
+	if msg != "" {
+		return nil, http.StatusBadRequest, msg
+	}
+
+	visibility, msg := pasteVisibility(c, req.Visibility, req.IsPublic)
+	if msg != "" {
+		return nil, http.StatusBadRequest, msg
+	}
+
+	tags, msg := parseTags(req.Tags)
+	if msg != "" {
+		return nil, http.StatusBadRequest, msg
+	}
+	var collection *models.Collection
+	if req.CollectionID != nil {
+		if collection, msg = ownCollection(c, *req.CollectionID); msg != "" {
+			return nil, http.StatusBadRequest, msg
+		}
+	}
+	var org *models.Org
+	if req.Org != "" {
+		if org, msg = writableOrg(c, req.Org); msg != "" {
+			return nil, http.StatusBadRequest, msg
+		}
+		if collection != nil {
+			return nil, http.StatusBadRequest, errOrgCollection
+		}
+	}
+
 	var id string
 	for {
 		id = generateID()
@@ -69,8 +224,11 @@ func (h *PasteHandler) CreatePaste(c *gin.Context) {
 		Title:         req.Title,
 		Content:       req.Content,
 		Language:      req.Language,
-		IsPublic:      req.IsPublic,
+		Encryption:    req.Encryption,
+		Visibility:    visibility,
+		Password:      password,
 		BurnAfterRead: req.BurnAfterRead,
+		Revision:      1,
 		CreatedAt:     time.Now(),
 		UpdatedAt:     time.Now(),
 	}
@@ -79,6 +237,12 @@ func (h *PasteHandler) CreatePaste(c *gin.Context) {
 	if userID, ok := middleware.GetUserID(c); ok {
 		paste.UserID = &userID
 	}
+	if collection != nil {
+		paste.CollectionID = &collection.ID
+	}
+	if org != nil {
+		paste.OrgID = &org.ID
+	}
 
 	// Set expiration
 	if req.ExpiresIn != "" && req.ExpiresIn != "never" {
@@ -99,117 +263,293 @@ func (h *PasteHandler) CreatePaste(c *gin.Context) {
 		}
 	}
 
-	if result := database.DB.Create(&paste); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create paste"})
-		return
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := database.CreatePaste(tx, &paste); err != nil {
+			return err
+		}
+		if err := database.ReplaceFiles(tx, &paste, files); err != nil {
+			return err
+		}
+		if err := database.SetTags(tx, &paste, tags); err != nil {
+			return err
+		}
+		if err := database.IndexPaste(tx, &paste); err != nil {
+			return err
+		}
+		return database.SnapshotRevision(tx, &paste)
+	})
+	if err != nil {
+		return nil, http.StatusInternalServerError, "Failed to create paste"
 	}
+	flushBlobs(c)
 
-	c.JSON(http.StatusCreated, paste)
+	return &paste, http.StatusCreated, ""
 }
 
 // GetPaste retrieves a paste by ID
 func (h *PasteHandler) GetPaste(c *gin.Context) {
-	id := c.Param("id")
+	id, _ := splitExt(c.Param("id"))
 
-	// Remove extension if present
-	if idx := strings.LastIndex(id, "."); idx != -1 {
-		id = id[:idx]
+	paste, aerr := h.loadPaste(c, id)
+	if aerr != nil {
+		c.JSON(aerr.status, gin.H{"error": aerr.message})
+		return
 	}
 
-	var paste models.Paste
-	if result := database.DB.Preload("User").First(&paste, "id = ?", id); result.Error != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Paste not found"})
+	// API clients ask for the content explicitly, so they burn it right away
+	if paste.BurnAfterRead {
+		if aerr := burnPaste(paste); aerr != nil {
+			c.JSON(aerr.status, gin.H{"error": aerr.message})
+			return
+		}
+		paste.Views++
+		c.JSON(http.StatusOK, paste)
 		return
 	}
 
-	// Check if expired
-	if paste.ExpiresAt != nil && paste.ExpiresAt.Before(time.Now()) {
-		database.DB.Delete(&paste)
-		c.JSON(http.StatusNotFound, gin.H{"error": "Paste has expired"})
+	// Increment views
+	database.DB.Model(paste).Update("views", paste.Views+1)
+	paste.Views++
+
+	c.JSON(http.StatusOK, paste)
+}
+
+// GetEditablePaste returns a paste to those who may edit it, for clients
+// editing it in place. Unlike GetPaste it never burns the paste or counts a
+// view.
+func (h *PasteHandler) GetEditablePaste(c *gin.Context) {
+	var paste models.Paste
+	if result := database.DB.Scopes(database.NotExpired).Preload("Files", orderFiles).Preload("Tags", database.OrderTags).Preload("Org").First(&paste, "id = ?", c.Param("id")); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Paste not found"})
 		return
 	}
 
-	// Check visibility
-	if !paste.IsPublic {
-		userID, authenticated := middleware.GetUserID(c)
-		if !authenticated || paste.UserID == nil || *paste.UserID != userID {
-			c.JSON(http.StatusForbidden, gin.H{"error": "This paste is private"})
-			return
-		}
+	// Owners, and editors of an organization's pastes
+	if !canEditPaste(c, &paste) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only edit your own pastes"})
+		return
 	}
 
-	// Handle burn after read
-	if paste.BurnAfterRead && paste.Views > 0 {
-		database.DB.Delete(&paste)
-		c.JSON(http.StatusNotFound, gin.H{"error": "Paste has been burned after reading"})
+	if err := database.LoadContent(c.Request.Context(), &paste); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errContentUnavailable.message})
 		return
 	}
 
-	// Increment views
-	database.DB.Model(&paste).Update("views", paste.Views+1)
-	paste.Views++
-
+	c.Header("Cache-Control", "no-store")
 	c.JSON(http.StatusOK, paste)
 }
 
 // UpdatePaste updates an existing paste
 func (h *PasteHandler) UpdatePaste(c *gin.Context) {
 	id := c.Param("id")
-	userID, ok := middleware.GetUserID(c)
-	if !ok {
+	if _, ok := middleware.GetUserID(c); !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
 		return
 	}
 
 	var paste models.Paste
-	if result := database.DB.First(&paste, "id = ?", id); result.Error != nil {
+	if result := database.DB.Preload("Files", orderFiles).Preload("Tags", database.OrderTags).Preload("Org").First(&paste, "id = ?", id); result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Paste not found"})
 		return
 	}
 
-	// Check ownership
-	if paste.UserID == nil || *paste.UserID != userID {
+	// Owners, and editors of an organization's pastes
+	if !canEditPaste(c, &paste) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "You can only edit your own pastes"})
 		return
 	}
 
+	if err := database.LoadContent(c.Request.Context(), &paste); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errContentUnavailable.message})
+		return
+	}
+
 	var req UpdatePasteRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
 
+	if paste.Encryption != "" {
+		msg := ""
+		if req.Files != nil {
+			msg = "Encrypted pastes can't have multiple files"
+		} else if req.Content != "" {
+			msg = checkCiphertext(paste.Encryption, req.Content)
+		}
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+	}
+
+	// New files replace the old ones, the first standing in for the content
+	var files []models.PasteFile
+	if req.Files != nil {
+		if len(req.Files) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A paste needs at least one file"})
+			return
+		}
+		var msg string
+		if files, msg = buildFiles(req.Files); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		req.Content, req.Language = files[0].Content, files[0].Language
+	}
+
 	updates := map[string]interface{}{
 		"updated_at": time.Now(),
 	}
 
-	if req.Title != "" {
+	// Any change to the body creates a new revision
+	changed := false
+	if req.Title != "" && req.Title != paste.Title {
 		updates["title"] = req.Title
+		changed = true
 	}
-	if req.Content != "" {
+	if req.Content != "" && req.Content != paste.Content {
 		updates["content"] = req.Content
+		changed = true
 	}
-	if req.Language != "" {
+	if req.Language != "" && req.Language != paste.Language {
 		updates["language"] = req.Language
+		changed = true
+	}
+	if req.Visibility != "" || req.IsPublic != nil {
+		visibility, msg := pasteVisibility(c, req.Visibility, req.IsPublic)
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		updates["visibility"] = visibility
 	}
-	if req.IsPublic != nil {
-		updates["is_public"] = *req.IsPublic
+	if req.Password != nil {
+		password, msg := hashPastePassword(*req.Password)
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		updates["password"] = password
+	}
+	// Tags and collections aren't part of the body and make no revision
+	var tags []string
+	if req.Tags != nil {
+		var msg string
+		if tags, msg = parseTags(req.Tags); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+	}
+	// Pastes can join an organization, but never leave it
+	inOrg := paste.OrgID != nil
+	if req.Org != "" && (paste.Org == nil || paste.Org.Name != req.Org) {
+		if inOrg {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Organization pastes can't be moved"})
+			return
+		}
+		org, msg := writableOrg(c, req.Org)
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		updates["org_id"] = org.ID
+		updates["collection_id"] = nil
+		inOrg = true
+	}
+	if req.CollectionID != nil {
+		if *req.CollectionID == 0 {
+			updates["collection_id"] = nil
+		} else if inOrg {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errOrgCollection})
+			return
+		} else if collection, msg := ownCollection(c, *req.CollectionID); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		} else {
+			updates["collection_id"] = collection.ID
+		}
+	}
+
+	// Editing the content of a multi-file paste edits its first file
+	if files == nil && changed && len(paste.Files) > 0 {
+		files = append([]models.PasteFile(nil), paste.Files...)
+		files[0].Content = req.Content
+		if req.Content == "" {
+			files[0].Content = paste.Content
+		}
+		if req.Language != "" {
+			files[0].Language = req.Language
+		}
+	}
+	filesChanged := files != nil && !sameFiles(paste.Files, files)
+	if filesChanged {
+		changed = true
 	}
 
-	if result := database.DB.Model(&paste).Updates(updates); result.Error != nil {
+	// The reloaded row won't hold the content if it is stored elsewhere
+	content := paste.Content
+	if req.Content != "" {
+		content = req.Content
+	}
+	oldBackend, oldKey := paste.ContentBackend, paste.ContentKey
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if changed {
+			// Pastes created before revisions existed have no snapshot yet
+			if err := database.SnapshotRevision(tx, &paste); err != nil {
+				return err
+			}
+			updates["revision"] = paste.Revision + 1
+		}
+		if _, ok := updates["content"]; ok {
+			if err := database.SetContent(tx, &paste, content, updates); err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&paste).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&paste, "id = ?", id).Error; err != nil {
+			return err
+		}
+		paste.Content = content
+		if filesChanged {
+			if err := database.ReplaceFiles(tx, &paste, files); err != nil {
+				return err
+			}
+		}
+		if tags != nil {
+			if err := database.SetTags(tx, &paste, tags); err != nil {
+				return err
+			}
+		}
+		if changed || filesChanged {
+			if err := database.IndexPaste(tx, &paste); err != nil {
+				return err
+			}
+		}
+		if !changed {
+			return nil
+		}
+		return database.SnapshotRevision(tx, &paste)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update paste"})
 		return
 	}
+	flushBlobs(c)
+	if oldKey != paste.ContentKey {
+		database.DeleteContent(c.Request.Context(), oldBackend, oldKey)
+	}
 
-	database.DB.First(&paste, "id = ?", id)
 	c.JSON(http.StatusOK, paste)
 }
 
 // DeletePaste deletes a paste
 func (h *PasteHandler) DeletePaste(c *gin.Context) {
 	id := c.Param("id")
-	userID, ok := middleware.GetUserID(c)
-	if !ok {
+	if _, ok := middleware.GetUserID(c); !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
 		return
 	}
@@ -220,13 +560,13 @@ func (h *PasteHandler) DeletePaste(c *gin.Context) {
 		return
 	}
 
-	// Check ownership
-	if paste.UserID == nil || *paste.UserID != userID {
+	// Owners, and editors of an organization's pastes they created
+	if !canDeletePaste(c, &paste) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "You can only delete your own pastes"})
 		return
 	}
 
-	if result := database.DB.Delete(&paste); result.Error != nil {
+	if err := database.DeletePaste(database.DB, &paste); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete paste"})
 		return
 	}
@@ -236,51 +576,36 @@ func (h *PasteHandler) DeletePaste(c *gin.Context) {
 
 // GetRawPaste returns the raw content of a paste
 func (h *PasteHandler) GetRawPaste(c *gin.Context) {
-	id := c.Param("id")
-
-	var paste models.Paste
-	if result := database.DB.First(&paste, "id = ?", id); result.Error != nil {
-		c.String(http.StatusNotFound, "Paste not found")
-		return
+	paste, aerr := h.loadPaste(c, c.Param("id"))
+	if aerr == nil {
+		aerr = confirmBurn(c, paste)
 	}
-
-	// Check if expired
-	if paste.ExpiresAt != nil && paste.ExpiresAt.Before(time.Now()) {
-		database.DB.Delete(&paste)
-		c.String(http.StatusNotFound, "Paste has expired")
+	if aerr != nil {
+		c.String(aerr.status, aerr.message)
 		return
 	}
 
-	// Check visibility
-	if !paste.IsPublic {
-		userID, authenticated := middleware.GetUserID(c)
-		if !authenticated || paste.UserID == nil || *paste.UserID != userID {
-			c.String(http.StatusForbidden, "This paste is private")
-			return
-		}
+	if paste.Encryption != "" {
+		c.Header("X-Paste-Encryption", paste.Encryption)
 	}
-
 	c.Header("Content-Type", "text/plain; charset=utf-8")
 	c.String(http.StatusOK, paste.Content)
 }
 
 // ForkPaste creates a copy of an existing paste
 func (h *PasteHandler) ForkPaste(c *gin.Context) {
-	id := c.Param("id")
-
-	var original models.Paste
-	if result := database.DB.First(&original, "id = ?", id); result.Error != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Paste not found"})
+	// Forking reads the paste, so the same expiry, visibility and password
+	// rules apply
+	original, aerr := h.loadPaste(c, c.Param("id"))
+	if aerr != nil {
+		c.JSON(aerr.status, gin.H{"error": aerr.message})
 		return
 	}
 
-	// Check visibility for forking
-	if !original.IsPublic {
-		userID, authenticated := middleware.GetUserID(c)
-		if !authenticated || original.UserID == nil || *original.UserID != userID {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Cannot fork a private paste"})
-			return
-		}
+	// A fork would be a second copy of content meant to be read once
+	if original.BurnAfterRead {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot fork a burn-after-read paste"})
+		return
 	}
 
 	// Generate new ID
@@ -294,13 +619,18 @@ func (h *PasteHandler) ForkPaste(c *gin.Context) {
 	}
 
 	forked := models.Paste{
-		ID:        newID,
-		Title:     original.Title + " (Fork)",
-		Content:   original.Content,
-		Language:  original.Language,
-		IsPublic:  true,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		ID:            newID,
+		Title:         original.Title + " (Fork)",
+		Content:       original.Content,
+		Language:      original.Language,
+		Encryption:    original.Encryption,
+		Password:      original.Password,   // unlocking a paste shouldn't publish it
+		Visibility:    original.Visibility, // a fork of an unlisted paste shouldn't list it
+		Revision:      1,
+		ForkedFromID:  &original.ID,
+		ForkedFromRev: original.Revision,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
 	}
 
 	// Set user if authenticated
@@ -308,70 +638,66 @@ func (h *PasteHandler) ForkPaste(c *gin.Context) {
 		forked.UserID = &userID
 	}
 
-	if result := database.DB.Create(&forked); result.Error != nil {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := database.CreatePaste(tx, &forked); err != nil {
+			return err
+		}
+		if err := database.ReplaceFiles(tx, &forked, append([]models.PasteFile(nil), original.Files...)); err != nil {
+			return err
+		}
+		// Tags carry over, but collections belong to the original's owner
+		tags := make([]string, len(original.Tags))
+		for i, t := range original.Tags {
+			tags[i] = t.Name
+		}
+		if err := database.SetTags(tx, &forked, tags); err != nil {
+			return err
+		}
+		if err := database.IndexPaste(tx, &forked); err != nil {
+			return err
+		}
+		return database.SnapshotRevision(tx, &forked)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fork paste"})
 		return
 	}
+	flushBlobs(c)
 
 	c.JSON(http.StatusCreated, forked)
 }
 
 // ViewPastePage renders the paste view page
 func (h *PasteHandler) ViewPastePage(c *gin.Context) {
-	id := c.Param("id")
-	ext := ""
+	id, ext := splitExt(c.Param("id"))
 
-	// Extract extension for syntax highlighting
-	if idx := strings.LastIndex(id, "."); idx != -1 {
-		ext = id[idx+1:]
-		id = id[:idx]
-	}
-
-	var paste models.Paste
-	if result := database.DB.Preload("User").First(&paste, "id = ?", id); result.Error != nil {
-		c.HTML(http.StatusNotFound, "error.html", gin.H{
-			"title":   "Not Found - Patbin",
-			"message": "Paste not found",
-		})
+	paste, aerr := h.loadPaste(c, id)
+	if aerr != nil {
+		renderLocked(c, id, aerr)
 		return
 	}
 
-	// Check if expired
-	if paste.ExpiresAt != nil && paste.ExpiresAt.Before(time.Now()) {
-		database.DB.Delete(&paste)
-		c.HTML(http.StatusNotFound, "error.html", gin.H{
-			"title":   "Expired - Patbin",
-			"message": "This paste has expired",
-		})
-		return
-	}
-
-	// Check visibility
-	if !paste.IsPublic {
-		userID, authenticated := middleware.GetUserID(c)
-		if !authenticated || paste.UserID == nil || *paste.UserID != userID {
-			c.HTML(http.StatusForbidden, "error.html", gin.H{
-				"title":   "Private - Patbin",
-				"message": "This paste is private",
-			})
-			return
-		}
-	}
-
-	// Handle burn after read
-	if paste.BurnAfterRead && paste.Views > 0 {
-		database.DB.Delete(&paste)
-		c.HTML(http.StatusNotFound, "error.html", gin.H{
-			"title":   "Burned - Patbin",
-			"message": "This paste has been burned after reading",
+	// Link previews and crawlers only ever get the interstitial; the
+	// content is revealed by posting its form
+	if paste.BurnAfterRead {
+		c.HTML(http.StatusOK, "burn.html", gin.H{
+			"title":  "Burn After Read - Patbin",
+			"action": c.Request.URL.Path,
+			"csrf":   middleware.CSRFToken(c),
 		})
 		return
 	}
 
 	// Increment views
-	database.DB.Model(&paste).Update("views", paste.Views+1)
+	database.DB.Model(paste).Update("views", paste.Views+1)
 	paste.Views++
 
+	h.renderPaste(c, paste, ext, false)
+}
+
+// renderPaste renders the view page for the current state of a paste.
+// burned marks a burn-after-read paste that no longer exists.
+func (h *PasteHandler) renderPaste(c *gin.Context, paste *models.Paste, ext string, burned bool) {
 	// Determine language
 	language := paste.Language
 	if ext != "" {
@@ -381,29 +707,126 @@ func (h *PasteHandler) ViewPastePage(c *gin.Context) {
 		language = "plaintext"
 	}
 
-	// Count lines
-	lines := strings.Count(paste.Content, "\n") + 1
+	// Lineage: where this paste came from and how often it was forked
+	var forkedFrom *models.Paste
+	if paste.ForkedFromID != nil {
+		var parent models.Paste
+		if result := database.DB.Select("id", "title", "visibility", "user_id", "org_id").First(&parent, "id = ?", *paste.ForkedFromID); result.Error == nil && canViewPaste(c, &parent) {
+			forkedFrom = &parent
+		}
+	}
+	var forkCount int64
+	database.DB.Model(&models.Paste{}).Where("forked_from_id = ?", paste.ID).Count(&forkCount)
 
-	// Check if current user owns this paste
-	isOwner := false
-	if userID, ok := middleware.GetUserID(c); ok && paste.UserID != nil {
-		isOwner = *paste.UserID == userID
+	views := h.fileViews(paste, language, paste.Revision, paste.UpdatedAt, burned)
+
+	// Burned pastes take no comments, and had none
+	var comments *commentView
+	if !burned {
+		comments = loadComments(c, paste, paste.Revision, &views[0])
 	}
+	userID, loggedIn := middleware.GetUserID(c)
+	canStar := loggedIn && !paste.BurnAfterRead
 
 	c.HTML(http.StatusOK, "view.html", gin.H{
-		"title":    paste.Title + " - Patbin",
-		"paste":    paste,
-		"language": language,
-		"lines":    lines,
-		"isOwner":  isOwner,
-		"ext":      ext,
+		"title":      paste.Title + " - Patbin",
+		"paste":      paste,
+		"language":   language,
+		"files":      views,
+		"lines":      views[0].Lines,
+		"canEdit":    canEditPaste(c, paste),
+		"canDelete":  canDeletePaste(c, paste),
+		"ext":        ext,
+		"forkedFrom": forkedFrom,
+		"forkCount":  forkCount,
+		"burned":     burned,
+		"comments":   comments,
+		"canStar":    canStar,
+		"starred":    canStar && database.HasStarred(paste.ID, userID),
+	})
+}
+
+// fileViews prepares one tab per file of revision of a paste, last changed
+// at stamp. language only overrides the files of single-file pastes.
+func (h *PasteHandler) fileViews(paste *models.Paste, language string, revision int, stamp time.Time, burned bool) []fileView {
+	files := pasteFiles(paste)
+	views := make([]fileView, len(files))
+	for i, f := range files {
+		fileLanguage := f.Language
+		if len(paste.Files) == 0 || fileLanguage == "" {
+			fileLanguage = language
+		}
+		view := fileView{
+			Filename: f.Filename,
+			Language: fileLanguage,
+			Lines:    strings.Count(f.Content, "\n") + 1,
+		}
+		// Burned content stays out of the cache so it doesn't outlive the paste
+		if paste.Encryption != "" {
+			view.Ciphertext = f.Content
+		} else if burned {
+			view.Highlighted = highlight.Highlight(f.Content, fileLanguage)
+		} else {
+			view.Highlighted = h.highlight(paste.ID+"/"+f.Filename, revision, stamp, f.Content, fileLanguage)
+		}
+		views[i] = view
+	}
+	return views
+}
+
+// highlight renders content through the cache. Revisions are immutable, so
+// the paste ID, revision and language identify the output; the timestamp
+// guards against a deleted paste's ID being reused.
+func (h *PasteHandler) highlight(id string, revision int, stamp time.Time, content, language string) template.HTML {
+	key := fmt.Sprintf("%s@%d:%s:%d", id, revision, language, stamp.UnixNano())
+	return h.highlights.Highlight(key, content, language)
+}
+
+// DetectLanguage guesses the language of content for editor integrations
+func (h *PasteHandler) DetectLanguage(c *gin.Context) {
+	var req DetectLanguageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	c.JSON(http.StatusOK, langdetect.Detect(req.Content, req.Filename))
+}
+
+// Highlight renders arbitrary content for the editor preview
+func (h *PasteHandler) Highlight(c *gin.Context) {
+	var req HighlightRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if len(req.Content) > maxContentSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Content too large (max 512 KB)"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"language": req.Language,
+		"html":     highlight.Highlight(req.Content, req.Language),
 	})
 }
 
 // HomePage renders the home page with paste creation form
 func (h *PasteHandler) HomePage(c *gin.Context) {
+	username, _ := middleware.GetUsername(c)
+	var collections []models.Collection
+	var orgs []models.Org
+	if userID, ok := middleware.GetUserID(c); ok {
+		database.DB.Where("user_id = ?", userID).Order("name").Find(&collections)
+		orgs = writableOrgs(userID)
+	}
+
 	c.HTML(http.StatusOK, "index.html", gin.H{
-		"title": "Patbin - Modern Pastebin",
+		"title":       "Patbin - Modern Pastebin",
+		"username":    username,
+		"collections": collections,
+		"orgs":        orgs,
 	})
 }
 
@@ -417,7 +840,7 @@ func (h *PasteHandler) EditPastePage(c *gin.Context) {
 	}
 
 	var paste models.Paste
-	if result := database.DB.First(&paste, "id = ?", id); result.Error != nil {
+	if result := database.DB.Preload("Files", orderFiles).Preload("Tags", database.OrderTags).Preload("Org").First(&paste, "id = ?", id); result.Error != nil {
 		c.HTML(http.StatusNotFound, "error.html", gin.H{
 			"title":   "Not Found - Patbin",
 			"message": "Paste not found",
@@ -425,8 +848,8 @@ func (h *PasteHandler) EditPastePage(c *gin.Context) {
 		return
 	}
 
-	// Check ownership
-	if paste.UserID == nil || *paste.UserID != userID {
+	// Owners, and editors of an organization's pastes
+	if !canEditPaste(c, &paste) {
 		c.HTML(http.StatusForbidden, "error.html", gin.H{
 			"title":   "Forbidden - Patbin",
 			"message": "You can only edit your own pastes",
@@ -434,20 +857,57 @@ func (h *PasteHandler) EditPastePage(c *gin.Context) {
 		return
 	}
 
+	if err := database.LoadContent(c.Request.Context(), &paste); err != nil {
+		c.HTML(errContentUnavailable.status, "error.html", gin.H{
+			"title":   errContentUnavailable.title,
+			"message": errContentUnavailable.message,
+			"code":    errContentUnavailable.status,
+		})
+		return
+	}
+
+	// An organization's pastes aren't filed, and stay with it
+	var collections []models.Collection
+	var orgs []models.Org
+	if paste.OrgID == nil {
+		database.DB.Where("user_id = ?", userID).Order("name").Find(&collections)
+		orgs = writableOrgs(userID)
+	}
+	var collectionID uint
+	if paste.CollectionID != nil {
+		collectionID = *paste.CollectionID
+	}
+
 	c.HTML(http.StatusOK, "edit.html", gin.H{
-		"title": "Edit - " + paste.Title,
-		"paste": paste,
+		"title":        "Edit - " + paste.Title,
+		"paste":        paste,
+		"tags":         tagNames(paste.Tags),
+		"collections":  collections,
+		"collectionID": collectionID,
+		"orgs":         orgs,
 	})
 }
 
-// RecentPastes returns recent public pastes
+// RecentPastes returns a page of public pastes, newest first by default
 func (h *PasteHandler) RecentPastes(c *gin.Context) {
-	var pastes []models.Paste
-	database.DB.Where("is_public = ?", true).
-		Order("created_at DESC").
-		Limit(20).
-		Preload("User").
-		Find(&pastes)
-
-	c.JSON(http.StatusOK, pastes)
+	opts, msg := parsePage(c)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	// Listings never carry content, which may be behind a password
+	pastes, next, err := database.PastePage(database.DB.Scopes(database.NotExpired).
+		Omit("content").
+		Where("visibility = ?", models.VisibilityPublic).
+		Preload("User"), opts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"pastes":      pastes,
+		"next_cursor": next,
+	})
 }
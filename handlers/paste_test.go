@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"patbin/config"
+	"patbin/database"
+	"patbin/models"
+	"patbin/storage"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// asUser returns a request context for user, or an anonymous one for 0
+func asUser(user uint) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	if user != 0 {
+		c.Set("user_id", user)
+	}
+	return c
+}
+
+// request returns a context for a request by user to the paste id, and the
+// recorder of its response
+func request(user uint, method, target, id string) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, target, nil)
+	c.Params = gin.Params{{Key: "id", Value: id}}
+	if user != 0 {
+		c.Set("user_id", user)
+	}
+	return c, w
+}
+
+// setupDB opens an empty database storing content inline
+func setupDB(t *testing.T) {
+	t.Helper()
+	if err := database.Init(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.InitStorage(&config.Config{StorageBackend: storage.Inline}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func storePaste(t *testing.T, paste *models.Paste, files ...models.PasteFile) {
+	t.Helper()
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := database.CreatePaste(tx, paste); err != nil {
+			return err
+		}
+		return database.ReplaceFiles(tx, paste, files)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPasteVisibility(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		user       uint
+		visibility string
+		isPublic   *bool
+		want       string
+	}{
+		{0, "", nil, models.VisibilityPublic},
+		{0, models.VisibilityUnlisted, nil, models.VisibilityUnlisted},
+		{0, models.VisibilityPrivate, nil, ""},
+		{0, "", &no, ""},
+		{1, "", &no, models.VisibilityPrivate},
+		{1, "", &yes, models.VisibilityPublic},
+		{1, models.VisibilityUnlisted, &no, models.VisibilityUnlisted},
+		{1, "secret", nil, ""},
+	}
+	for _, tt := range tests {
+		got, msg := pasteVisibility(asUser(tt.user), tt.visibility, tt.isPublic)
+		if got != tt.want || (msg == "") != (tt.want != "") {
+			t.Errorf("user %d, %q, %v: got %q, %q; want %q", tt.user, tt.visibility, tt.isPublic, got, msg, tt.want)
+		}
+	}
+}
+
+func TestCanViewPaste(t *testing.T) {
+	owner := uint(1)
+	tests := []struct {
+		visibility  string
+		user        uint
+		view, list  bool
+		edit, erase bool
+	}{
+		{models.VisibilityPublic, 0, true, true, false, false},
+		{models.VisibilityUnlisted, 0, true, false, false, false},
+		{models.VisibilityUnlisted, 2, true, false, false, false},
+		{models.VisibilityUnlisted, owner, true, true, true, true},
+		{models.VisibilityPrivate, 0, false, false, false, false},
+		{models.VisibilityPrivate, 2, false, false, false, false},
+		{models.VisibilityPrivate, owner, true, true, true, true},
+	}
+	for _, tt := range tests {
+		paste := &models.Paste{Visibility: tt.visibility, UserID: &owner}
+		c := asUser(tt.user)
+		if got := canViewPaste(c, paste); got != tt.view {
+			t.Errorf("%s paste, user %d: view %v, want %v", tt.visibility, tt.user, got, tt.view)
+		}
+		if got := canListPaste(c, paste); got != tt.list {
+			t.Errorf("%s paste, user %d: list %v, want %v", tt.visibility, tt.user, got, tt.list)
+		}
+		if got := canEditPaste(c, paste); got != tt.edit {
+			t.Errorf("%s paste, user %d: edit %v, want %v", tt.visibility, tt.user, got, tt.edit)
+		}
+		if got := canDeletePaste(c, paste); got != tt.erase {
+			t.Errorf("%s paste, user %d: delete %v, want %v", tt.visibility, tt.user, got, tt.erase)
+		}
+	}
+}
+
+func TestGetEditablePasteKeepsBurnAfterRead(t *testing.T) {
+	setupDB(t)
+	owner := uint(1)
+	storePaste(t, &models.Paste{ID: "burn", Content: "once", BurnAfterRead: true, Visibility: models.VisibilityUnlisted, UserID: &owner})
+	h := NewPasteHandler(&config.Config{})
+
+	c, w := request(2, http.MethodGet, "/api/paste/burn/edit", "burn")
+	if h.GetEditablePaste(c); w.Code != http.StatusForbidden {
+		t.Errorf("another user: %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	c, w = request(owner, http.MethodGet, "/api/paste/burn/edit", "burn")
+	h.GetEditablePaste(c)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"content":"once"`) {
+		t.Fatalf("owner: %d %s", w.Code, w.Body)
+	}
+	var paste models.Paste
+	if err := database.DB.First(&paste, "id = ?", "burn").Error; err != nil {
+		t.Fatal("loading a paste to edit burned it")
+	}
+	if paste.Views != 0 {
+		t.Errorf("loading a paste to edit counted %d views", paste.Views)
+	}
+}
+
+func TestForkPasteExpired(t *testing.T) {
+	setupDB(t)
+	past := time.Now().Add(-time.Minute)
+	storePaste(t, &models.Paste{ID: "gone", Content: "old", Visibility: models.VisibilityPublic, ExpiresAt: &past})
+	storePaste(t, &models.Paste{ID: "live", Content: "new", Visibility: models.VisibilityPublic, Revision: 1})
+	h := NewPasteHandler(&config.Config{})
+
+	c, w := request(0, http.MethodPost, "/api/paste/gone/fork", "gone")
+	if h.ForkPaste(c); w.Code != http.StatusNotFound {
+		t.Errorf("forking an expired paste: %d, want %d", w.Code, http.StatusNotFound)
+	}
+	c, w = request(0, http.MethodPost, "/api/paste/live/fork", "live")
+	if h.ForkPaste(c); w.Code != http.StatusCreated || !strings.Contains(w.Body.String(), `"forked_from_id":"live"`) {
+		t.Errorf("forking a live paste: %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"net/http"
+	"patbin/database"
+	"patbin/middleware"
+	"patbin/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// accessError describes why a paste can't be served to the current user
+type accessError struct {
+	status  int
+	title   string
+	message string
+}
+
+var errContentUnavailable = &accessError{http.StatusInternalServerError, "Error - Patbin", "Failed to load paste content"}
+
+// pasteRole returns the current user's role on a paste: owner of their own
+// pastes, their member role on an organization's, and "" on the rest
+func pasteRole(c *gin.Context, paste *models.Paste) string {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		return ""
+	}
+	if paste.OrgID != nil {
+		return database.MemberRole(*paste.OrgID, userID)
+	}
+	if paste.UserID != nil && *paste.UserID == userID {
+		return models.RoleOwner
+	}
+	return ""
+}
+
+// canViewPaste reports whether the current user may read the paste
+func canViewPaste(c *gin.Context, paste *models.Paste) bool {
+	return paste.Visibility != models.VisibilityPrivate || pasteRole(c, paste) != ""
+}
+
+// canListPaste reports whether the paste may show up in listings for the
+// current user; unlisted pastes are only listed for their owners
+func canListPaste(c *gin.Context, paste *models.Paste) bool {
+	return paste.Visibility == models.VisibilityPublic || pasteRole(c, paste) != ""
+}
+
+// canEditPaste reports whether the current user may edit the paste
+func canEditPaste(c *gin.Context, paste *models.Paste) bool {
+	role := pasteRole(c, paste)
+	return role == models.RoleOwner || role == models.RoleEditor
+}
+
+// canDeletePaste reports whether the current user may delete the paste.
+// Editors of an organization may only delete the pastes they created.
+func canDeletePaste(c *gin.Context, paste *models.Paste) bool {
+	switch pasteRole(c, paste) {
+	case models.RoleOwner:
+		return true
+	case models.RoleEditor:
+		userID, _ := middleware.GetUserID(c)
+		return paste.UserID != nil && *paste.UserID == userID
+	}
+	return false
+}
+
+// loadPaste fetches a paste and applies the expiry and visibility rules
+// shared by the read endpoints
+func (h *PasteHandler) loadPaste(c *gin.Context, id string) (*models.Paste, *accessError) {
+	return h.fetchPaste(c, id, h.checkPassword)
+}
+
+// fetchPaste is loadPaste with the password check of the caller's choosing
+func (h *PasteHandler) fetchPaste(c *gin.Context, id string, checkPassword func(*gin.Context, *models.Paste) *accessError) (*models.Paste, *accessError) {
+	var paste models.Paste
+	if result := database.DB.Preload("User").Preload("Files", orderFiles).Preload("Tags", database.OrderTags).Preload("Collection").Preload("Org").First(&paste, "id = ?", id); result.Error != nil {
+		return nil, &accessError{http.StatusNotFound, "Not Found - Patbin", "Paste not found"}
+	}
+
+	if paste.ExpiresAt != nil && paste.ExpiresAt.Before(time.Now()) {
+		database.DeletePaste(database.DB, &paste)
+		return nil, &accessError{http.StatusNotFound, "Expired - Patbin", "This paste has expired"}
+	}
+
+	if !canViewPaste(c, &paste) {
+		return nil, &accessError{http.StatusForbidden, "Private - Patbin", "This paste is private"}
+	}
+
+	if aerr := checkPassword(c, &paste); aerr != nil {
+		return nil, aerr
+	}
+
+	// Burn-after-read pastes used to survive their first view
+	if paste.BurnAfterRead && paste.Views > 0 {
+		database.DeletePaste(database.DB, &paste)
+		return nil, errBurned
+	}
+
+	if err := database.LoadContent(c.Request.Context(), &paste); err != nil {
+		return nil, errContentUnavailable
+	}
+
+	return &paste, nil
+}
+
+// loadRevision resolves revision n of a paste for the read endpoints
+func (h *PasteHandler) loadRevision(c *gin.Context, id, n string) (*models.Paste, *models.PasteRevision, *accessError) {
+	paste, aerr := h.loadPaste(c, id)
+	if aerr != nil {
+		return nil, nil, aerr
+	}
+
+	// Revisions would let a burn-after-read paste be read more than once
+	if paste.BurnAfterRead {
+		return nil, nil, &accessError{http.StatusForbidden, "Unavailable - Patbin", "Revisions are not available for burn-after-read pastes"}
+	}
+
+	number, err := strconv.Atoi(n)
+	if err != nil || number < 1 {
+		return nil, nil, &accessError{http.StatusBadRequest, "Bad Request - Patbin", "Invalid revision number"}
+	}
+
+	rev, aerr := revisionOf(c, paste, number)
+	if aerr != nil {
+		return nil, nil, aerr
+	}
+
+	return paste, rev, nil
+}
+
+// revisionOf looks up revision number of a paste. Pastes that predate
+// revision tracking only have their current state, which stands in for it.
+func revisionOf(c *gin.Context, paste *models.Paste, number int) (*models.PasteRevision, *accessError) {
+	var rev models.PasteRevision
+	if result := database.DB.Preload("Files", orderFiles).Where("paste_id = ? AND number = ?", paste.ID, number).First(&rev); result.Error == nil {
+		if err := database.LoadRevisionContent(c.Request.Context(), &rev); err != nil {
+			return nil, errContentUnavailable
+		}
+	} else {
+		if number != paste.Revision {
+			return nil, &accessError{http.StatusNotFound, "Not Found - Patbin", "Revision not found"}
+		}
+		rev = models.PasteRevision{
+			PasteID:   paste.ID,
+			Number:    paste.Revision,
+			Title:     paste.Title,
+			Content:   paste.Content,
+			Language:  paste.Language,
+			UserID:    paste.UserID,
+			CreatedAt: paste.UpdatedAt,
+		}
+		for i, f := range paste.Files {
+			rev.Files = append(rev.Files, models.RevisionFile{Filename: f.Filename, Language: f.Language, Content: f.Content, Position: i})
+		}
+	}
+
+	return &rev, nil
+}
+
+// ListRevisions returns the revision history of a paste, newest first
+func (h *PasteHandler) ListRevisions(c *gin.Context) {
+	paste, aerr := h.loadPaste(c, c.Param("id"))
+	if aerr != nil {
+		c.JSON(aerr.status, gin.H{"error": aerr.message})
+		return
+	}
+	if paste.BurnAfterRead {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Revisions are not available for burn-after-read pastes"})
+		return
+	}
+
+	var revisions []models.PasteRevision
+	database.DB.Select("id", "paste_id", "number", "title", "language", "user_id", "created_at").
+		Where("paste_id = ?", paste.ID).
+		Order("number DESC").
+		Find(&revisions)
+
+	if len(revisions) == 0 {
+		revisions = append(revisions, models.PasteRevision{
+			PasteID:   paste.ID,
+			Number:    paste.Revision,
+			Title:     paste.Title,
+			Language:  paste.Language,
+			UserID:    paste.UserID,
+			CreatedAt: paste.UpdatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"paste_id":  paste.ID,
+		"current":   paste.Revision,
+		"revisions": revisions,
+	})
+}
+
+// GetRevision returns a single revision including its content
+func (h *PasteHandler) GetRevision(c *gin.Context) {
+	_, rev, aerr := h.loadRevision(c, c.Param("id"), c.Param("n"))
+	if aerr != nil {
+		c.JSON(aerr.status, gin.H{"error": aerr.message})
+		return
+	}
+
+	c.JSON(http.StatusOK, rev)
+}
+
+// GetRawRevision returns the raw content of a single revision
+func (h *PasteHandler) GetRawRevision(c *gin.Context) {
+	_, rev, aerr := h.loadRevision(c, c.Param("id"), c.Param("n"))
+	if aerr != nil {
+		c.String(aerr.status, aerr.message)
+		return
+	}
+
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.String(http.StatusOK, rev.Content)
+}
+
+// ViewRevisionPage renders a past revision of a paste
+func (h *PasteHandler) ViewRevisionPage(c *gin.Context) {
+	paste, rev, aerr := h.loadRevision(c, c.Param("id"), c.Param("n"))
+	if aerr != nil {
+		renderLocked(c, c.Param("id"), aerr)
+		return
+	}
+
+	language := rev.Language
+	if language == "" {
+		language = "plaintext"
+	}
+
+	// Render the revision through the regular paste view. Revisions from
+	// before files were recorded with them only hold the first file.
+	snapshot := *paste
+	snapshot.Title = rev.Title
+	snapshot.Content = rev.Content
+	snapshot.Language = rev.Language
+	snapshot.Files = nil
+	for _, f := range rev.Files {
+		snapshot.Files = append(snapshot.Files, models.PasteFile{Filename: f.Filename, Language: f.Language, Content: f.Content})
+	}
+
+	views := h.fileViews(&snapshot, language, rev.Number, rev.CreatedAt, false)
+	comments := loadComments(c, paste, rev.Number, &views[0])
+
+	c.HTML(http.StatusOK, "view.html", gin.H{
+		"title":     rev.Title + " (rev " + strconv.Itoa(rev.Number) + ") - Patbin",
+		"paste":     snapshot,
+		"language":  language,
+		"files":     views,
+		"lines":     views[0].Lines,
+		"canEdit":   canEditPaste(c, paste),
+		"canDelete": canDeletePaste(c, paste),
+		"revision":  rev,
+		"comments":  comments,
+	})
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"patbin/database"
+	"patbin/middleware"
+	"patbin/models"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 50
+)
+
+// SnippetHTML escapes a search snippet and highlights the matched terms
+func SnippetHTML(snippet string) template.HTML {
+	s := template.HTMLEscapeString(snippet)
+	s = strings.ReplaceAll(s, database.SnippetStart, "<mark>")
+	s = strings.ReplaceAll(s, database.SnippetEnd, "</mark>")
+	return template.HTML(s)
+}
+
+// Search finds pastes by title and content. Private pastes only show up
+// for their owner.
+func (h *PasteHandler) Search(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Search query is required"})
+		return
+	}
+
+	opts := database.SearchOptions{
+		Query:    q,
+		Language: c.Query("language"),
+		Limit:    defaultSearchLimit,
+	}
+	if n, err := strconv.Atoi(c.Query("limit")); err == nil && n > 0 {
+		opts.Limit = min(n, maxSearchLimit)
+	}
+	if userID, ok := middleware.GetUserID(c); ok {
+		opts.ViewerID = &userID
+	}
+	if username := c.Query("user"); username != "" {
+		var user models.User
+		if result := database.DB.Where("username = ?", username).First(&user); result.Error != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		opts.AuthorID = &user.ID
+	}
+
+	results, err := database.SearchPastes(opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Search failed"})
+		return
+	}
+	for i := range results {
+		results[i].Snippet = string(SnippetHTML(results[i].Snippet))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"query":   q,
+		"results": results,
+	})
+}
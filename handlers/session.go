@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"net/http"
+	"patbin/database"
+	"patbin/middleware"
+	"patbin/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sessionView is a session as listed to its user
+type sessionView struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+// activeSessions returns the user's unexpired sessions, most recent first
+func activeSessions(c *gin.Context, userID uint) []sessionView {
+	var sessions []models.Session
+	database.DB.Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions)
+
+	current, _ := middleware.GetSessionID(c)
+	views := make([]sessionView, len(sessions))
+	for i, s := range sessions {
+		views[i] = sessionView{Session: s, Current: s.ID == current}
+	}
+	return views
+}
+
+// ListSessions returns the current user's active sessions
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+	c.JSON(http.StatusOK, gin.H{"sessions": activeSessions(c, userID)})
+}
+
+// RevokeSession ends one of the current user's sessions
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+	id := c.Param("id")
+
+	result := database.DB.Where("id = ? AND user_id = ?", id, userID).Delete(&models.Session{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	if current, _ := middleware.GetSessionID(c); current == id {
+		middleware.ClearSessionCookies(c, h.cfg)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// RevokeAllSessions ends every session of the current user, this one
+// included
+func (h *AuthHandler) RevokeAllSessions(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	result := database.DB.Where("user_id = ?", userID).Delete(&models.Session{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	middleware.ClearSessionCookies(c, h.cfg)
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out everywhere", "revoked": result.RowsAffected})
+}
+
+// SessionsPage renders the list of the user's active sessions
+func (h *AuthHandler) SessionsPage(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+	username, _ := middleware.GetUsername(c)
+
+	c.HTML(http.StatusOK, "sessions.html", gin.H{
+		"title":    "Sessions - Patbin",
+		"username": username,
+		"sessions": activeSessions(c, userID),
+	})
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+	"patbin/database"
+	"patbin/middleware"
+	"patbin/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StarPaste stars a paste for the current user; starring it again is a
+// no-op
+func (h *PasteHandler) StarPaste(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	paste, aerr := h.loadPaste(c, c.Param("id"))
+	if aerr != nil {
+		c.JSON(aerr.status, gin.H{"error": aerr.message})
+		return
+	}
+	// They are gone once read, so there would be nothing left to go back to
+	if paste.BurnAfterRead {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Burn-after-read pastes can't be starred"})
+		return
+	}
+
+	if err := database.StarPaste(database.DB, paste, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to star paste"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"starred": true,
+		"stars":   paste.Stars,
+	})
+}
+
+// UnstarPaste takes the current user's star off a paste. It skips the
+// access checks, so a star can still be taken off a paste that was made
+// private or locked since.
+func (h *PasteHandler) UnstarPaste(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	var paste models.Paste
+	if result := database.DB.Select("id", "stars").First(&paste, "id = ?", c.Param("id")); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Paste not found"})
+		return
+	}
+
+	if err := database.UnstarPaste(database.DB, &paste, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unstar paste"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"starred": false,
+		"stars":   paste.Stars,
+	})
+}
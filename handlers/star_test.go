@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+	"patbin/config"
+	"patbin/database"
+	"patbin/models"
+	"testing"
+)
+
+func TestUnstarPasteMadePrivate(t *testing.T) {
+	setupDB(t)
+	owner, fan := uint(1), uint(2)
+	paste := &models.Paste{ID: "p", Content: "x", Visibility: models.VisibilityPublic, UserID: &owner}
+	storePaste(t, paste)
+	h := NewPasteHandler(&config.Config{})
+
+	c, w := request(fan, http.MethodPost, "/api/paste/p/star", "p")
+	if h.StarPaste(c); w.Code != http.StatusOK {
+		t.Fatalf("star: %d %s", w.Code, w.Body)
+	}
+
+	hash, _ := hashPastePassword("hunter2")
+	database.DB.Model(&models.Paste{}).Where("id = ?", "p").Updates(map[string]interface{}{
+		"visibility": models.VisibilityPrivate,
+		"password":   hash,
+	})
+
+	c, w = request(fan, http.MethodDelete, "/api/paste/p/star", "p")
+	if h.UnstarPaste(c); w.Code != http.StatusOK {
+		t.Fatalf("unstar a paste made private: %d %s", w.Code, w.Body)
+	}
+	if database.HasStarred("p", fan) {
+		t.Error("the star is still there")
+	}
+	database.DB.First(paste, "id = ?", "p")
+	if paste.Stars != 0 {
+		t.Errorf("stars = %d, want 0", paste.Stars)
+	}
+
+	c, w = request(fan, http.MethodDelete, "/api/paste/missing/star", "missing")
+	if h.UnstarPaste(c); w.Code != http.StatusNotFound {
+		t.Errorf("unstar a missing paste: %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
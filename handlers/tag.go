@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"patbin/database"
+	"patbin/middleware"
+	"patbin/models"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const maxTagLength = 32
+
+// normalizeTag lowercases a tag, returning "" for one that isn't valid
+func normalizeTag(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" || len(s) > maxTagLength {
+		return ""
+	}
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		case strings.ContainsRune("-_.+#", r):
+		default:
+			return ""
+		}
+	}
+	return s
+}
+
+// parseTags validates the tags of a request, dropping duplicates
+func parseTags(tags []string) ([]string, string) {
+	seen := make(map[string]bool)
+	names := []string{}
+	for _, t := range tags {
+		if strings.TrimSpace(t) == "" {
+			continue
+		}
+		name := normalizeTag(t)
+		if name == "" {
+			return nil, "Invalid tag " + strconv.Quote(t) + ": use up to 32 letters, digits, -, _, ., + or #"
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	if len(names) > models.MaxPasteTags {
+		return nil, "Too many tags (max " + strconv.Itoa(models.MaxPasteTags) + ")"
+	}
+	sort.Strings(names)
+	return names, ""
+}
+
+// splitTags reads tags given as one string, separated by commas or spaces
+func splitTags(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' })
+}
+
+// tagNames lists the names of tags, for forms
+func tagNames(tags []models.Tag) string {
+	names := make([]string, len(tags))
+	for i, t := range tags {
+		names[i] = t.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// ownCollection looks up a collection of the current user for a request
+// filing a paste in it. Anonymous pastes can't be filed.
+func ownCollection(c *gin.Context, id uint) (*models.Collection, string) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		return nil, "Log in to file pastes in collections"
+	}
+	var collection models.Collection
+	if result := database.DB.Where("id = ? AND user_id = ?", id, userID).First(&collection); result.Error != nil {
+		return nil, "Collection not found"
+	}
+	return &collection, ""
+}
+
+// pasteFilter narrows a user's paste listing to a tag or a collection
+type pasteFilter struct {
+	Tag        string
+	Collection *models.Collection
+}
+
+// parseFilter reads ?tag= and ?collection= of a listing of ownerID's
+// pastes; a tag in the path, as on tag pages, comes first
+func parseFilter(c *gin.Context, ownerID uint) (pasteFilter, int, string) {
+	var f pasteFilter
+	tag := c.Param("tag")
+	if tag == "" {
+		tag = c.Query("tag")
+	}
+	if tag != "" {
+		if f.Tag = normalizeTag(tag); f.Tag == "" {
+			return f, http.StatusBadRequest, "Invalid tag"
+		}
+	}
+	if s := c.Query("collection"); s != "" {
+		id, err := strconv.ParseUint(s, 10, 0)
+		var collection models.Collection
+		if err != nil || database.DB.Where("id = ? AND user_id = ?", id, ownerID).First(&collection).Error != nil {
+			return f, http.StatusNotFound, "Collection not found"
+		}
+		f.Collection = &collection
+	}
+	return f, 0, ""
+}
+
+func (f pasteFilter) scope(db *gorm.DB) *gorm.DB {
+	if f.Tag != "" {
+		db = db.Scopes(database.TaggedWith(f.Tag))
+	}
+	if f.Collection != nil {
+		db = db.Scopes(database.InCollection(f.Collection.ID))
+	}
+	return db
+}
+
+// query is the filter as query parameters, for links that keep it. A tag
+// taken from the path is left to the path.
+func (f pasteFilter) query(c *gin.Context) url.Values {
+	v := url.Values{}
+	if f.Tag != "" && c.Param("tag") == "" {
+		v.Set("tag", f.Tag)
+	}
+	if f.Collection != nil {
+		v.Set("collection", strconv.FormatUint(uint64(f.Collection.ID), 10))
+	}
+	return v
+}
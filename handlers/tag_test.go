@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		in   []string
+		want []string
+		err  bool
+	}{
+		{nil, []string{}, false},
+		{[]string{"Go", " go ", "", "c++", "c#", "v1.2_rc-1"}, []string{"c#", "c++", "go", "v1.2_rc-1"}, false},
+		{[]string{"two words"}, nil, true},
+		{[]string{"émoji"}, nil, true},
+		{[]string{strings.Repeat("x", maxTagLength+1)}, nil, true},
+		{strings.Fields("a b c d e f g h i j k"), nil, true},
+	}
+	for _, tt := range tests {
+		got, msg := parseTags(tt.in)
+		if (msg != "") != tt.err {
+			t.Errorf("parseTags(%q) error %q, want error %v", tt.in, msg, tt.err)
+			continue
+		}
+		if !tt.err && fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("parseTags(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSplitTags(t *testing.T) {
+	if got := splitTags(" go, cli  tools,,"); fmt.Sprint(got) != "[go cli tools]" {
+		t.Errorf("splitTags = %q", got)
+	}
+}
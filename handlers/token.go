@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"patbin/database"
+	"patbin/middleware"
+	"patbin/models"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TokenHandler struct{}
+
+func NewTokenHandler() *TokenHandler {
+	return &TokenHandler{}
+}
+
+type CreateTokenRequest struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ExpiresIn string   `json:"expires_in"` // "30d", "90d", "1y", "never"
+}
+
+// createdToken is the only response that ever includes the token itself
+type createdToken struct {
+	models.APIToken
+	Token string `json:"token"`
+}
+
+// ListTokens returns the current user's API tokens
+func (h *TokenHandler) ListTokens(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	var tokens []models.APIToken
+	database.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens)
+
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+// CreateToken issues a new API token. The token is shown once; only its
+// hash is stored.
+func (h *TokenHandler) CreateToken(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	var req CreateTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A token needs a name (max 100 characters)"})
+		return
+	}
+
+	var scopes []string
+	for _, scope := range req.Scopes {
+		if !slices.Contains(models.TokenScopes, scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope: " + scope})
+			return
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A token needs at least one scope"})
+		return
+	}
+
+	var expiresAt *time.Time
+	switch req.ExpiresIn {
+	case "", "never":
+	case "30d", "90d", "1y":
+		days := map[string]int{"30d": 30, "90d": 90, "1y": 365}[req.ExpiresIn]
+		t := time.Now().AddDate(0, 0, days)
+		expiresAt = &t
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid expiry"})
+		return
+	}
+
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+	raw := middleware.TokenPrefix + hex.EncodeToString(secret)
+
+	token := models.APIToken{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    raw[:len(middleware.TokenPrefix)+8],
+		Hash:      middleware.HashToken(raw),
+		Scopes:    strings.Join(scopes, " "),
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+	if err := database.DB.Create(&token).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, createdToken{APIToken: token, Token: raw})
+}
+
+// RevokeToken deletes one of the current user's API tokens
+func (h *TokenHandler) RevokeToken(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	result := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).Delete(&models.APIToken{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
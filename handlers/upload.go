@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"patbin/middleware"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxUploadSize bounds the request body of CreatePasteRaw, leaving room
+// for multipart framing around maxContentSize of content
+const maxUploadSize = maxContentSize + 64*1024
+
+// CreatePasteRaw creates a paste from a raw request body, a multipart file
+// upload or a url-encoded form, for use with curl:
+//
+//	cmd | curl --data-binary @- host/
+//	curl -F 'f=@main.go' host/
+//
+// Options come from form fields, query parameters or X-Paste-* headers,
+// in that order, and the reply is the URL of the paste as plain text.
+func (h *PasteHandler) CreatePasteRaw(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadSize)
+
+	req, msg := readUpload(c)
+	if msg != "" {
+		c.String(http.StatusBadRequest, msg+"\n")
+		return
+	}
+	if req.Content == "" && len(req.Files) == 0 {
+		c.String(http.StatusBadRequest, "Content is required\n")
+		return
+	}
+
+	paste, status, msg := createPaste(c, req)
+	if msg != "" {
+		c.String(status, msg+"\n")
+		return
+	}
+
+	c.String(http.StatusCreated, h.baseURL(c)+"/"+paste.ID+"\n")
+}
+
+// readUpload turns the body of a CreatePasteRaw request into a request
+func readUpload(c *gin.Context) (*CreatePasteRequest, string) {
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+
+	req := &CreatePasteRequest{}
+	var form url.Values
+	switch mediaType {
+	case "multipart/form-data":
+		mf, err := c.MultipartForm()
+		if err != nil {
+			return nil, uploadError(err)
+		}
+		form = url.Values(mf.Value)
+		files, msg := uploadedFiles(mf)
+		if msg != "" {
+			return nil, msg
+		}
+		switch {
+		case len(files) == 1:
+			req.Content, req.Filename = files[0].Content, files[0].Filename
+			req.Title = files[0].Filename
+		case len(files) > 1:
+			req.Files = files
+		default:
+			req.Content = formContent(form)
+		}
+
+	default:
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			return nil, uploadError(err)
+		}
+		// curl -d sends url-encoded forms, but also raw data under the same
+		// content type; only a content field makes it a form
+		if mediaType == "application/x-www-form-urlencoded" {
+			if values, err := url.ParseQuery(string(body)); err == nil && formContent(values) != "" {
+				form = values
+				req.Content = formContent(values)
+				break
+			}
+		}
+		req.Content = string(body)
+	}
+
+	option := func(field, header string) string {
+		if v := form.Get(field); v != "" {
+			return v
+		}
+		if v := c.Query(field); v != "" {
+			return v
+		}
+		return c.GetHeader(header)
+	}
+
+	if title := option("title", "X-Paste-Title"); title != "" {
+		req.Title = title
+	}
+	if filename := option("filename", "X-Paste-Filename"); filename != "" {
+		req.Filename = filename
+	}
+	req.Language = option("language", "X-Paste-Language")
+	if req.Language == "" {
+		req.Language = option("lang", "X-Paste-Lang")
+	}
+	req.ExpiresIn = option("expires", "X-Paste-Expires")
+	req.BurnAfterRead = isTrue(option("burn", "X-Paste-Burn"))
+	req.Tags = splitTags(option("tags", "X-Paste-Tags"))
+	req.Visibility = option("visibility", "X-Paste-Visibility")
+	req.Org = option("org", "X-Paste-Org")
+	// Never in the URL, where it would end up in logs
+	req.Password = form.Get("password")
+	if req.Password == "" {
+		req.Password = c.GetHeader("X-Paste-Password")
+	}
+	return req, ""
+}
+
+// uploadedFiles reads the files of a multipart form, ordered by field name
+func uploadedFiles(mf *multipart.Form) ([]FileRequest, string) {
+	fields := make([]string, 0, len(mf.File))
+	for field := range mf.File {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var files []FileRequest
+	for _, field := range fields {
+		for _, fh := range mf.File[field] {
+			f, err := fh.Open()
+			if err != nil {
+				return nil, uploadError(err)
+			}
+			var buf bytes.Buffer
+			_, err = buf.ReadFrom(f)
+			f.Close()
+			if err != nil {
+				return nil, uploadError(err)
+			}
+			files = append(files, FileRequest{Filename: fh.Filename, Content: buf.String()})
+		}
+	}
+	return files, ""
+}
+
+// formContent is the content posted as a form field
+func formContent(form url.Values) string {
+	if v := form.Get("content"); v != "" {
+		return v
+	}
+	return form.Get("c")
+}
+
+func uploadError(err error) string {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return "Content too large (max 512 KB)"
+	}
+	return "Invalid upload"
+}
+
+func isTrue(s string) bool {
+	switch strings.ToLower(s) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// baseURL is the scheme and host the request was made to. The scheme a
+// client connected to a proxy with only counts from a trusted proxy.
+func (h *PasteHandler) baseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" && middleware.FromTrustedProxy(c, h.cfg.TrustedProxies) {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"patbin/config"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func upload(t *testing.T, req *http.Request) (*CreatePasteRequest, string) {
+	t.Helper()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = req
+	return readUpload(c)
+}
+
+func TestReadUploadRaw(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/?title=Log&burn=yes&expires=1h", strings.NewReader("a=b&c"))
+	// curl --data-binary sends this type too
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Paste-Language", "text")
+	req.Header.Set("X-Paste-Tags", "ci, logs")
+	req.Header.Set("X-Paste-Password", "pw")
+
+	got, msg := upload(t, req)
+	if msg != "" {
+		t.Fatal(msg)
+	}
+	if got.Content != "a=b&c" || got.Title != "Log" || got.Language != "text" || !got.BurnAfterRead ||
+		got.ExpiresIn != "1h" || got.Password != "pw" || len(got.Tags) != 2 {
+		t.Errorf("request = %+v", got)
+	}
+}
+
+func TestReadUploadForm(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/?title=query", strings.NewReader("c=hello&title=form&lang=go"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Paste-Title", "header")
+
+	got, msg := upload(t, req)
+	if msg != "" {
+		t.Fatal(msg)
+	}
+	// Form fields win over the query and headers
+	if got.Content != "hello" || got.Title != "form" || got.Language != "go" {
+		t.Errorf("request = %+v", got)
+	}
+}
+
+func multipartRequest(t *testing.T, fields map[string]string, files ...[2]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, value := range fields {
+		mw.WriteField(name, value)
+	}
+	for i, f := range files {
+		w, err := mw.CreateFormFile(string(rune('a'+i)), f[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(f[1]))
+	}
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestReadUploadMultipart(t *testing.T) {
+	got, msg := upload(t, multipartRequest(t, nil, [2]string{"main.go", "package main"}))
+	if msg != "" {
+		t.Fatal(msg)
+	}
+	if got.Content != "package main" || got.Filename != "main.go" || got.Title != "main.go" || len(got.Files) != 0 {
+		t.Errorf("one file: %+v", got)
+	}
+
+	got, msg = upload(t, multipartRequest(t, map[string]string{"title": "Bundle"},
+		[2]string{"a.go", "package a"}, [2]string{"b.go", "package b"}))
+	if msg != "" {
+		t.Fatal(msg)
+	}
+	if got.Title != "Bundle" || len(got.Files) != 2 || got.Files[0].Filename != "a.go" || got.Files[1].Content != "package b" {
+		t.Errorf("two files: %+v", got)
+	}
+
+	got, msg = upload(t, multipartRequest(t, map[string]string{"content": "typed in"}))
+	if msg != "" || got.Content != "typed in" {
+		t.Errorf("no files: %+v, %q", got, msg)
+	}
+}
+
+func TestReadUploadTooLarge(t *testing.T) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(strings.Repeat("x", maxUploadSize+1)))
+	req.Body = http.MaxBytesReader(w, req.Body, maxUploadSize)
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+
+	if _, msg := readUpload(c); msg != "Content too large (max 512 KB)" {
+		t.Errorf("msg = %q", msg)
+	}
+}
+
+func TestBaseURLForwardedProto(t *testing.T) {
+	h := NewPasteHandler(&config.Config{TrustedProxies: []string{"10.0.0.1"}})
+	for remote, want := range map[string]string{
+		"10.0.0.1:4000":    "https://paste.example.com",
+		"203.0.113.7:4000": "http://paste.example.com",
+	} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "http://paste.example.com/", nil)
+		c.Request.RemoteAddr = remote
+		c.Request.Header.Set("X-Forwarded-Proto", "https")
+		if got := h.baseURL(c); got != want {
+			t.Errorf("from %s: %s, want %s", remote, got, want)
+		}
+	}
+}
@@ -5,8 +5,10 @@ import (
 	"patbin/database"
 	"patbin/middleware"
 	"patbin/models"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type UserHandler struct{}
@@ -15,7 +17,8 @@ func NewUserHandler() *UserHandler {
 	return &UserHandler{}
 }
 
-// GetUserProfile returns a user's public pastes
+// GetUserProfile returns a user, their tags and collections, and a page of
+// their own public pastes, optionally of one tag or collection
 func (h *UserHandler) GetUserProfile(c *gin.Context) {
 	username := c.Param("username")
 
@@ -25,18 +28,39 @@ func (h *UserHandler) GetUserProfile(c *gin.Context) {
 		return
 	}
 
-	var pastes []models.Paste
-	database.DB.Where("user_id = ? AND is_public = ?", user.ID, true).
-		Order("created_at DESC").
-		Find(&pastes)
+	opts, msg := parsePage(c)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	filter, status, msg := parseFilter(c, user.ID)
+	if msg != "" {
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+
+	// Listings never carry content, which may be behind a password
+	pastes, next, err := database.PastePage(database.DB.Scopes(database.NotExpired, filter.scope).
+		Omit("content").
+		Where("user_id = ? AND org_id IS NULL AND visibility = ?", user.ID, models.VisibilityPublic).
+		Preload("Tags", database.OrderTags), opts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return
+	}
 
+	tags, _ := database.UserTags(user.ID, false)
 	c.JSON(http.StatusOK, gin.H{
-		"user":   user,
-		"pastes": pastes,
+		"user":        user,
+		"tags":        tags,
+		"collections": publicCollections(user.ID),
+		"pastes":      pastes,
+		"next_cursor": next,
 	})
 }
 
-// GetUserProfilePage renders the user profile page
+// GetUserProfilePage renders the user profile page, and the pages of their
+// tags at /u/:username/tag/:tag
 func (h *UserHandler) GetUserProfilePage(c *gin.Context) {
 	username := c.Param("username")
 
@@ -49,19 +73,88 @@ func (h *UserHandler) GetUserProfilePage(c *gin.Context) {
 		return
 	}
 
-	var pastes []models.Paste
-	database.DB.Where("user_id = ? AND is_public = ?", user.ID, true).
-		Order("created_at DESC").
-		Find(&pastes)
+	opts, msg := parsePage(c)
+	status := http.StatusBadRequest
+	var filter pasteFilter
+	if msg == "" {
+		filter, status, msg = parseFilter(c, user.ID)
+	}
+	if msg != "" {
+		c.HTML(status, "error.html", gin.H{
+			"title":   http.StatusText(status) + " - Patbin",
+			"message": msg,
+			"code":    status,
+		})
+		return
+	}
+
+	public := database.DB.Model(&models.Paste{}).Scopes(database.NotExpired, filter.scope).
+		Where("user_id = ? AND org_id IS NULL AND visibility = ?", user.ID, models.VisibilityPublic)
+	pastes, next, err := database.PastePage(public.Session(&gorm.Session{}).Preload("Tags", database.OrderTags), opts)
+	if err != nil {
+		c.Redirect(http.StatusFound, c.Request.URL.Path)
+		return
+	}
+	var count int64
+	public.Count(&count)
 
+	tags, _ := database.UserTags(user.ID, false)
+	title := user.Username
+	if filter.Tag != "" {
+		title = filter.Tag + " - " + title
+	}
 	c.HTML(http.StatusOK, "profile.html", gin.H{
-		"title":       user.Username + " - Patbin",
+		"title":       title + " - Patbin",
 		"profileUser": user,
 		"pastes":      pastes,
+		"count":       count,
+		"tags":        tags,
+		"collections": publicCollections(user.ID),
+		"filter":      filter,
+		"page":        newPageLinks(c.Request.URL.Path, filter.query(c), opts, next),
 	})
 }
 
-// GetDashboard returns the current user's dashboard with all their pastes
+// publicCollections lists the collections of a user holding public pastes;
+// the rest would show up empty
+func publicCollections(userID uint) []models.Collection {
+	collections, _ := database.UserCollections(userID, false)
+	public := []models.Collection{}
+	for _, col := range collections {
+		if col.PasteCount > 0 {
+			public = append(public, col)
+		}
+	}
+	return public
+}
+
+// tabStarred is the dashboard tab listing the pastes the user starred
+const tabStarred = "starred"
+
+// parseTab reads ?tab= of the dashboard, which lists the user's own pastes
+// unless it is the starred tab
+func parseTab(c *gin.Context) (string, string) {
+	switch tab := c.Query("tab"); tab {
+	case "", tabStarred:
+		return tab, ""
+	}
+	return "", "Invalid tab: use starred"
+}
+
+// dashboardPastes queries the pastes listed on a tab of the dashboard
+func dashboardPastes(userID uint, tab string) *gorm.DB {
+	if tab == tabStarred {
+		// Listings never carry content, which may be behind a password
+		return database.DB.Scopes(database.NotExpired, database.StarredBy(userID)).
+			Omit("content").
+			Preload("User")
+	}
+	return database.DB.Scopes(database.NotExpired).Where("user_id = ? AND org_id IS NULL", userID)
+}
+
+// GetDashboard returns a page of the current user's own pastes, or with
+// ?tab=starred of those they starred, optionally of one tag or collection;
+// the pastes of their organizations are on theirs
 func (h *UserHandler) GetDashboard(c *gin.Context) {
 	userID, ok := middleware.GetUserID(c)
 	if !ok {
@@ -69,12 +162,34 @@ func (h *UserHandler) GetDashboard(c *gin.Context) {
 		return
 	}
 
-	var pastes []models.Paste
-	database.DB.Where("user_id = ?", userID).
-		Order("created_at DESC").
-		Find(&pastes)
+	opts, msg := parsePage(c)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	tab, msg := parseTab(c)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	filter, status, msg := parseFilter(c, userID)
+	if msg != "" {
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"pastes": pastes})
+	pastes, next, err := database.PastePage(dashboardPastes(userID, tab).
+		Scopes(filter.scope).
+		Preload("Tags", database.OrderTags), opts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"pastes":      pastes,
+		"next_cursor": next,
+	})
 }
 
 // GetDashboardPage renders the user's dashboard page
@@ -87,22 +202,79 @@ func (h *UserHandler) GetDashboardPage(c *gin.Context) {
 
 	username, _ := middleware.GetUsername(c)
 
-	var pastes []models.Paste
-	database.DB.Where("user_id = ?", userID).
-		Order("created_at DESC").
-		Find(&pastes)
+	opts, msg := parsePage(c)
+	var tab string
+	if msg == "" {
+		tab, msg = parseTab(c)
+	}
+	status := http.StatusBadRequest
+	var filter pasteFilter
+	if msg == "" {
+		filter, status, msg = parseFilter(c, userID)
+	}
+	if msg != "" {
+		c.HTML(status, "error.html", gin.H{
+			"title":   http.StatusText(status) + " - Patbin",
+			"message": msg,
+			"code":    status,
+		})
+		return
+	}
+
+	pastes, next, err := database.PastePage(dashboardPastes(userID, tab).
+		Scopes(filter.scope).
+		Preload("Tags", database.OrderTags), opts)
+	if err != nil {
+		c.Redirect(http.StatusFound, "/dashboard")
+		return
+	}
+	links := filter.query(c)
+	if tab != "" {
+		links.Set("tab", tab)
+	}
 
 	// Count stats
-	var publicCount, privateCount int64
-	database.DB.Model(&models.Paste{}).Where("user_id = ? AND is_public = ?", userID, true).Count(&publicCount)
-	database.DB.Model(&models.Paste{}).Where("user_id = ? AND is_public = ?", userID, false).Count(&privateCount)
+	var publicCount, unlistedCount, privateCount int64
+	database.DB.Model(&models.Paste{}).Scopes(database.NotExpired).Where("user_id = ? AND org_id IS NULL AND visibility = ?", userID, models.VisibilityPublic).Count(&publicCount)
+	database.DB.Model(&models.Paste{}).Scopes(database.NotExpired).Where("user_id = ? AND org_id IS NULL AND visibility = ?", userID, models.VisibilityUnlisted).Count(&unlistedCount)
+	database.DB.Model(&models.Paste{}).Scopes(database.NotExpired).Where("user_id = ? AND org_id IS NULL AND visibility = ?", userID, models.VisibilityPrivate).Count(&privateCount)
+
+	// Search within the user's own pastes, private ones included
+	query := strings.TrimSpace(c.Query("q"))
+	var results []database.SearchResult
+	if query != "" {
+		results, _ = database.SearchPastes(database.SearchOptions{
+			Query:    query,
+			AuthorID: &userID,
+			ViewerID: &userID,
+			Limit:    maxSearchLimit,
+		})
+	}
+
+	var tokens []models.APIToken
+	database.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens)
+
+	tags, _ := database.UserTags(userID, true)
+	collections, _ := database.UserCollections(userID, true)
+	orgs, _ := database.UserOrgs(userID)
 
 	c.HTML(http.StatusOK, "dashboard.html", gin.H{
-		"title":        "Dashboard - Patbin",
-		"username":     username,
-		"pastes":       pastes,
-		"publicCount":  publicCount,
-		"privateCount": privateCount,
-		"totalCount":   len(pastes),
+		"title":         "Dashboard - Patbin",
+		"username":      username,
+		"pastes":        pastes,
+		"publicCount":   publicCount,
+		"unlistedCount": unlistedCount,
+		"privateCount":  privateCount,
+		"totalCount":    publicCount + unlistedCount + privateCount,
+		"tags":          tags,
+		"collections":   collections,
+		"orgs":          orgs,
+		"filter":        filter,
+		"tab":           tab,
+		"page":          newPageLinks("/dashboard", links, opts, next),
+		"query":         query,
+		"results":       results,
+		"tokens":        tokens,
+		"scopes":        models.TokenScopes,
 	})
 }
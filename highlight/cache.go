@@ -0,0 +1,56 @@
+package highlight
+
+import (
+	"container/list"
+	"html/template"
+	"sync"
+)
+
+// Cache keeps rendered HTML for the most recently viewed pastes
+type Cache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key  string
+	html template.HTML
+}
+
+// NewCache creates an LRU cache holding up to size rendered documents
+func NewCache(size int) *Cache {
+	return &Cache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Highlight returns the cached rendering for key, highlighting src as
+// language on a miss
+func (c *Cache) Highlight(key, src, language string) template.HTML {
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		c.order.MoveToFront(el)
+		html := el.Value.(*cacheEntry).html
+		c.mu.Unlock()
+		return html
+	}
+	c.mu.Unlock()
+
+	html := Highlight(src, language)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		c.entries[key] = c.order.PushFront(&cacheEntry{key: key, html: html})
+		for c.order.Len() > c.size {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			delete(c.entries, oldest.Value.(*cacheEntry).key)
+		}
+	}
+	return html
+}
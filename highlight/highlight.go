@@ -0,0 +1,122 @@
+package highlight
+
+import (
+	"html/template"
+	"strings"
+)
+
+// TokenType doubles as the CSS class emitted for a token, using the same
+// names as Prism so the existing theme in style.css applies unchanged
+type TokenType string
+
+const (
+	Plain       TokenType = ""
+	Comment     TokenType = "comment"
+	String      TokenType = "string"
+	Number      TokenType = "number"
+	Keyword     TokenType = "keyword"
+	Builtin     TokenType = "builtin"
+	Constant    TokenType = "constant"
+	Function    TokenType = "function"
+	ClassName   TokenType = "class-name"
+	Operator    TokenType = "operator"
+	Punctuation TokenType = "punctuation"
+	Variable    TokenType = "variable"
+	Symbol      TokenType = "symbol"
+	Property    TokenType = "property"
+	Selector    TokenType = "selector"
+	Tag         TokenType = "tag"
+	AttrName    TokenType = "attr-name"
+	AttrValue   TokenType = "attr-value"
+	Prolog      TokenType = "prolog"
+	CData       TokenType = "cdata"
+	URL         TokenType = "url"
+	Bold        TokenType = "bold"
+	Italic      TokenType = "italic"
+)
+
+type Token struct {
+	Type TokenType
+	Text string
+}
+
+// lexer turns source text into tokens
+type lexer func(src string) []Token
+
+// lexers maps the language names used by models.LanguageExtensions to their
+// tokenizers. Languages without an entry render as plain text.
+var lexers = map[string]lexer{}
+
+func register(lex lexer, names ...string) {
+	for _, name := range names {
+		lexers[name] = lex
+	}
+}
+
+// Supported reports whether language has a tokenizer
+func Supported(language string) bool {
+	_, ok := lexers[language]
+	return ok
+}
+
+// Tokenize splits src into tokens for language. Unknown languages produce a
+// single plain token.
+func Tokenize(src, language string) []Token {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	lex, ok := lexers[language]
+	if !ok {
+		return []Token{{Type: Plain, Text: src}}
+	}
+	return merge(src, lex(src))
+}
+
+// Highlight renders src as HTML with each token wrapped in a
+// <span class="token ..."> element
+func Highlight(src, language string) template.HTML {
+	return Render(Tokenize(src, language))
+}
+
+// Render escapes tokens and wraps the non-plain ones in spans
+func Render(tokens []Token) template.HTML {
+	var sb strings.Builder
+	for _, t := range tokens {
+		if t.Type == Plain {
+			sb.WriteString(template.HTMLEscapeString(t.Text))
+			continue
+		}
+		sb.WriteString(`<span class="token `)
+		sb.WriteString(string(t.Type))
+		sb.WriteString(`">`)
+		sb.WriteString(template.HTMLEscapeString(t.Text))
+		sb.WriteString(`</span>`)
+	}
+	return template.HTML(sb.String())
+}
+
+// merge joins adjacent tokens of the same type and drops empty ones. Lexers
+// must cover src exactly, in order, so merged text is sliced straight from it.
+func merge(src string, tokens []Token) []Token {
+	total := 0
+	for _, t := range tokens {
+		total += len(t.Text)
+	}
+	if total != len(src) {
+		return []Token{{Type: Plain, Text: src}}
+	}
+
+	out := make([]Token, 0, len(tokens))
+	start, pos := 0, 0
+	for _, t := range tokens {
+		if t.Text == "" {
+			continue
+		}
+		if n := len(out); n > 0 && out[n-1].Type == t.Type {
+			out[n-1].Text = src[start : pos+len(t.Text)]
+		} else {
+			start = pos
+			out = append(out, Token{Type: t.Type, Text: t.Text})
+		}
+		pos += len(t.Text)
+	}
+	return out
+}
@@ -0,0 +1,115 @@
+package highlight
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// samples end in the middle of a string and a comment to exercise the
+// lexers on unterminated input too
+var samples = []string{
+	"",
+	"package main\n\nimport \"fmt\"\n\n// main greets\nfunc main() {\n\tx := 0x1F + 2.5e3\n\tfmt.Println(`raw`, 'c', x)\n}\n",
+	"<div class=\"a\" id='b'><!-- note --><![CDATA[ x ]]></div>\n<?xml version=\"1.0\"?>\n",
+	"SELECT * FROM t WHERE a = 'it''s' -- trailing\n/* block */ @media (max-width: 10px) { .a > b { color: #fff; } }\n",
+	"# heading\n**bold** _it_ [link](http://x) `code`\n---\nkey: [1, 2]\n$var = @{ a => \"$b\" }; s/x/y/g;\n",
+	"def f(self): return r'\\d' \"\"\"doc\nstring",
+	"let s = \"unterminated\n/* open comment",
+}
+
+func TestLexersCoverSource(t *testing.T) {
+	for name, lex := range lexers {
+		for i, src := range samples {
+			var sb strings.Builder
+			for _, tok := range lex(src) {
+				sb.WriteString(tok.Text)
+			}
+			if sb.String() != src {
+				t.Errorf("%s, sample %d: tokens spell %q", name, i, sb.String())
+			}
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tokens := Tokenize("// hi\r\nfunc f() string { return \"x\" }", "go")
+	want := map[string]TokenType{
+		"// hi":  Comment,
+		"func":   Keyword,
+		"return": Keyword,
+		`"x"`:    String,
+	}
+	for _, tok := range tokens {
+		if typ, ok := want[tok.Text]; ok {
+			if tok.Type != typ {
+				t.Errorf("%q is %q, want %q", tok.Text, tok.Type, typ)
+			}
+			delete(want, tok.Text)
+		}
+		if strings.Contains(tok.Text, "\r") {
+			t.Error("CRLF line endings should be normalized")
+		}
+	}
+	for text := range want {
+		t.Errorf("no %q token in %v", text, tokens)
+	}
+
+	for i := 1; i < len(tokens); i++ {
+		if tokens[i].Type == tokens[i-1].Type {
+			t.Errorf("adjacent %q tokens %q and %q weren't merged", tokens[i].Type, tokens[i-1].Text, tokens[i].Text)
+		}
+	}
+}
+
+func TestHighlightEscapes(t *testing.T) {
+	for _, language := range []string{"html", "javascript", "unknown"} {
+		html := string(Highlight(`<script>alert("&")</script>`, language))
+		if strings.Contains(html, "<script") || strings.Contains(html, `"&"`) {
+			t.Errorf("%s: unescaped output %s", language, html)
+		}
+	}
+	if got := Highlight("a < b", "nosuchlanguage"); got != "a &lt; b" {
+		t.Errorf("plain text rendered as %q", got)
+	}
+}
+
+func TestCache(t *testing.T) {
+	c := NewCache(2)
+	for i := 0; i < 3; i++ {
+		c.Highlight(fmt.Sprint(i), "x", "go")
+	}
+	if len(c.entries) != 2 || c.entries["0"] != nil {
+		t.Errorf("cache holds %d entries, want the 2 most recent", len(c.entries))
+	}
+
+	// A hit returns the cached rendering, not a new one
+	if got := c.Highlight("2", "changed", "go"); got != Highlight("x", "go") {
+		t.Errorf("hit rendered %q", got)
+	}
+}
+
+func TestUnclosedBraceVariablesStayLinear(t *testing.T) {
+	if tokens := Tokenize("echo ${name}", "bash"); !hasToken(tokens, "${name}", Variable) {
+		t.Errorf("no ${name} variable in %v", tokens)
+	}
+
+	src := strings.Repeat("${", 256<<10)
+	for _, lang := range []string{"bash", "php", "perl", "ruby"} {
+		start := time.Now()
+		Tokenize(src, lang)
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("%s: a 512 KB line of unclosed ${ took %v", lang, d)
+		}
+	}
+}
+
+func hasToken(tokens []Token, text string, typ TokenType) bool {
+	for _, tok := range tokens {
+		if tok.Text == text && tok.Type == typ {
+			return true
+		}
+	}
+	return false
+}
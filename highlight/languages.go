@@ -0,0 +1,236 @@
+package highlight
+
+var cBlock = [][2]string{{"/*", "*/"}}
+
+func init() {
+	register((&spec{
+		keywords:      words("break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var"),
+		builtins:      words("append cap clear close complex copy delete imag len make max min new panic print println real recover any bool byte comparable complex64 complex128 error float32 float64 int int8 int16 int32 int64 rune string uint uint8 uint16 uint32 uint64 uintptr"),
+		constants:     words("true false nil iota"),
+		classKeywords: words("type"),
+		lineComments:  []string{"//"},
+		blockComments: cBlock,
+		quotes:        `"'`,
+		rawQuotes:     "`",
+	}).lex, "go")
+
+	register((&spec{
+		keywords:      words("and as assert async await break class continue def del elif else except finally for from global if import in is lambda match case nonlocal not or pass raise return try while with yield"),
+		builtins:      words("abs all any bool bytes callable chr dict dir divmod enumerate filter float format frozenset getattr hasattr hash help hex id input int isinstance issubclass iter len list map max min next object oct open ord pow print property range repr reversed round set setattr slice sorted staticmethod classmethod str sum super tuple type vars zip self cls"),
+		constants:     words("True False None NotImplemented Ellipsis"),
+		classKeywords: words("class"),
+		lineComments:  []string{"#"},
+		quotes:        `"'`,
+		tripleQuotes:  true,
+		decorators:    true,
+	}).lex, "python")
+
+	jsKeywords := "async await break case catch class const continue debugger default delete do else export extends finally for from function if import in instanceof let new of return static super switch this throw try typeof var void while with yield get set"
+	jsBuiltins := "Array Boolean Date Error JSON Map Math Number Object Promise Proxy Reflect RegExp Set String Symbol WeakMap WeakSet console document window globalThis require module exports process"
+	register((&spec{
+		keywords:      words(jsKeywords),
+		builtins:      words(jsBuiltins),
+		constants:     words("true false null undefined NaN Infinity"),
+		classKeywords: words("class extends new"),
+		lineComments:  []string{"//"},
+		blockComments: cBlock,
+		quotes:        `"'`,
+		multiQuotes:   "`",
+		identExtra:    "$",
+		decorators:    true,
+	}).lex, "javascript")
+
+	register((&spec{
+		keywords:      words(jsKeywords + " abstract as declare enum implements interface keyof namespace private protected public readonly type satisfies infer is asserts override"),
+		builtins:      words(jsBuiltins + " any boolean never number object string symbol unknown void bigint Record Partial Readonly Pick Omit"),
+		constants:     words("true false null undefined NaN Infinity"),
+		classKeywords: words("class extends implements interface new type enum"),
+		lineComments:  []string{"//"},
+		blockComments: cBlock,
+		quotes:        `"'`,
+		multiQuotes:   "`",
+		identExtra:    "$",
+		decorators:    true,
+		classCase:     true,
+	}).lex, "typescript")
+
+	register((&spec{
+		constants:  words("true false null"),
+		quotes:     `"`,
+		keyStrings: true,
+	}).lex, "json")
+
+	register((&spec{
+		keywords:      words("add all alter and any as asc begin between by case cascade check column commit constraint create cross database default delete desc distinct drop else end exists foreign from full group having if in index inner insert intersect into is join key left like limit not null offset on or order outer primary references replace returning right rollback select set table then transaction truncate union unique update using values view when where with"),
+		builtins:      words("avg count max min sum coalesce nullif cast now lower upper length substring trim round abs date datetime int integer bigint smallint text varchar char boolean float double real decimal numeric timestamp serial blob"),
+		constants:     words("true false"),
+		lineComments:  []string{"--"},
+		blockComments: cBlock,
+		quotes:        `'"`,
+		rawQuotes:     "`",
+		foldCase:      true,
+	}).lex, "sql")
+
+	register((&spec{
+		keywords:     words("if then else elif fi for while until do done case esac in function select return break continue local export readonly declare unset shift time"),
+		builtins:     words("echo printf read cd pwd ls cat grep sed awk cut sort uniq head tail find xargs test source alias exit exec eval set trap kill wait mkdir rm cp mv chmod chown touch curl wget sudo git"),
+		constants:    words("true false"),
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		multiQuotes:  "`",
+		varPrefixes:  "$",
+	}).lex, "bash")
+
+	cKeywords := "auto break case char const continue default do double else enum extern float for goto if inline int long register restrict return short signed sizeof static struct switch typedef union unsigned void volatile while"
+	register((&spec{
+		keywords:      words(cKeywords + " _Bool _Complex bool"),
+		builtins:      words("printf scanf malloc calloc realloc free memcpy memset strlen strcmp strcpy fopen fclose size_t uint8_t uint16_t uint32_t uint64_t int8_t int16_t int32_t int64_t FILE"),
+		constants:     words("NULL true false"),
+		classKeywords: words("struct enum union"),
+		lineComments:  []string{"//"},
+		blockComments: cBlock,
+		quotes:        `"'`,
+		preprocessor:  true,
+	}).lex, "c")
+
+	register((&spec{
+		keywords:      words(cKeywords + " alignas alignof and asm bool catch class concept const_cast consteval constexpr co_await co_return co_yield decltype delete dynamic_cast explicit export final friend mutable namespace new noexcept not operator or override private protected public reinterpret_cast requires static_assert static_cast template this thread_local throw try typeid typename using virtual"),
+		builtins:      words("std cout cin cerr endl string vector map set unordered_map unique_ptr shared_ptr make_unique make_shared size_t"),
+		constants:     words("true false nullptr NULL"),
+		classKeywords: words("class struct enum union namespace typename"),
+		lineComments:  []string{"//"},
+		blockComments: cBlock,
+		quotes:        `"'`,
+		preprocessor:  true,
+	}).lex, "cpp")
+
+	register((&spec{
+		keywords:      words("abstract as base bool break byte case catch char checked class const continue decimal default delegate do double else enum event explicit extern finally fixed float for foreach goto if implicit in int interface internal is lock long namespace new object operator out override params private protected public readonly record ref return sbyte sealed short sizeof stackalloc static string struct switch this throw try typeof uint ulong unchecked unsafe ushort using var virtual void volatile while async await get set init yield"),
+		builtins:      words("Console String Math List Dictionary Task Exception"),
+		constants:     words("true false null"),
+		classKeywords: words("class struct interface enum record new"),
+		lineComments:  []string{"//"},
+		blockComments: cBlock,
+		quotes:        `"'`,
+		preprocessor:  true,
+		classCase:     true,
+	}).lex, "csharp")
+
+	register((&spec{
+		keywords:      words("abstract assert boolean break byte case catch char class const continue default do double else enum extends final finally float for goto if implements import instanceof int interface long native new package private protected public record return short static strictfp super switch synchronized this throw throws transient try var void volatile while yield sealed permits"),
+		builtins:      words("String System Object Integer Long Double Boolean Math List Map Set ArrayList HashMap Optional Exception"),
+		constants:     words("true false null"),
+		classKeywords: words("class interface enum extends implements new record"),
+		lineComments:  []string{"//"},
+		blockComments: cBlock,
+		quotes:        `"'`,
+		tripleQuotes:  true,
+		decorators:    true,
+		classCase:     true,
+	}).lex, "java")
+
+	register((&spec{
+		keywords:      words("as async await break const continue crate dyn else enum extern fn for if impl in let loop match mod move mut pub ref return self Self static struct super trait type union unsafe use where while"),
+		builtins:      words("Box Option Result Some None Ok Err String Vec HashMap println print eprintln format vec panic assert assert_eq i8 i16 i32 i64 i128 isize u8 u16 u32 u64 u128 usize f32 f64 bool char str"),
+		constants:     words("true false"),
+		classKeywords: words("struct enum trait impl type union"),
+		lineComments:  []string{"//"},
+		blockComments: cBlock,
+		quotes:        `"`,
+		charLiterals:  true,
+		classCase:     true,
+	}).lex, "rust")
+
+	register((&spec{
+		keywords:      words("alias and begin break case class def defined do else elsif end ensure for if in module next not or redo rescue retry return self super then undef unless until when while yield"),
+		builtins:      words("puts print p require require_relative attr_accessor attr_reader attr_writer include extend raise lambda proc new"),
+		constants:     words("true false nil"),
+		classKeywords: words("class module"),
+		lineComments:  []string{"#"},
+		quotes:        `"'`,
+		multiQuotes:   "`",
+		varPrefixes:   "@$",
+		identExtra:    "?!",
+		symbols:       true,
+		classCase:     true,
+	}).lex, "ruby")
+
+	register((&spec{
+		keywords:      words("abstract and array as break callable case catch class clone const continue declare default do echo else elseif empty enddeclare endfor endforeach endif endswitch endwhile enum extends final finally fn for foreach function global goto if implements include include_once instanceof insteadof interface isset list match namespace new or print private protected public readonly require require_once return static switch throw trait try unset use var while xor yield php"),
+		builtins:      words("strlen count array_map array_filter array_keys array_values in_array explode implode json_encode json_decode sprintf printf var_dump print_r isset"),
+		constants:     words("true false null TRUE FALSE NULL"),
+		classKeywords: words("class interface trait extends implements new"),
+		lineComments:  []string{"//", "#"},
+		blockComments: cBlock,
+		quotes:        `"'`,
+		varPrefixes:   "$",
+	}).lex, "php")
+
+	register((&spec{
+		keywords:      words("actor associatedtype async await break case catch class continue default defer deinit do else enum extension fallthrough fileprivate for func guard if import in init inout internal is let open operator private protocol public repeat rethrows return self Self some static struct subscript super switch throw throws try typealias var where while any"),
+		builtins:      words("print Int Double Float String Bool Array Dictionary Set Optional Character"),
+		constants:     words("true false nil"),
+		classKeywords: words("class struct enum protocol extension"),
+		lineComments:  []string{"//"},
+		blockComments: cBlock,
+		quotes:        `"`,
+		tripleQuotes:  true,
+		decorators:    true,
+		classCase:     true,
+	}).lex, "swift")
+
+	register((&spec{
+		keywords:      words("abstract actual annotation as break by catch class companion const constructor continue crossinline data do else enum expect external final finally for fun get if import in infix init inline inner interface internal is lateinit noinline object open operator out override package private protected public reified return sealed set super suspend tailrec this throw try typealias val var vararg when where while"),
+		builtins:      words("println print listOf mutableListOf mapOf mutableMapOf setOf arrayOf String Int Long Double Float Boolean Any Unit Nothing List Map Set"),
+		constants:     words("true false null"),
+		classKeywords: words("class interface object"),
+		lineComments:  []string{"//"},
+		blockComments: cBlock,
+		quotes:        `"'`,
+		tripleQuotes:  true,
+		decorators:    true,
+		classCase:     true,
+	}).lex, "kotlin")
+
+	register((&spec{
+		keywords:      words("abstract case catch class def do else enum export extends final finally for forSome given if implicit import lazy match new object override package private protected return sealed super then this throw trait try type using val var while with yield"),
+		builtins:      words("println print String Int Long Double Boolean Any Unit Nothing List Map Set Seq Option Some None Future"),
+		constants:     words("true false null"),
+		classKeywords: words("class trait object extends with new"),
+		lineComments:  []string{"//"},
+		blockComments: cBlock,
+		quotes:        `"`,
+		tripleQuotes:  true,
+		charLiterals:  true,
+		decorators:    true,
+		classCase:     true,
+	}).lex, "scala")
+
+	register((&spec{
+		keywords:     words("if else repeat while function for in next break return switch library require"),
+		builtins:     words("c list vector matrix data.frame print cat paste paste0 length sum mean median sd apply lapply sapply seq rep nrow ncol head tail summary"),
+		constants:    words("TRUE FALSE NULL NA NaN Inf T F"),
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		rawQuotes:    "`",
+		identExtra:   ".",
+	}).lex, "r")
+
+	register((&spec{
+		keywords:      words("and break do else elseif end for function goto if in local not or repeat return then until while"),
+		builtins:      words("print pairs ipairs type tostring tonumber require setmetatable getmetatable table string math os io pcall error assert select next rawget rawset"),
+		constants:     words("true false nil"),
+		lineComments:  []string{"--"},
+		blockComments: [][2]string{{"--[[", "]]"}},
+		quotes:        `"'`,
+	}).lex, "lua")
+
+	register((&spec{
+		keywords:     words("if elsif else unless while until for foreach do last next redo return sub my our local use no package require and or not eq ne lt gt le ge cmp"),
+		builtins:     words("print printf say chomp chop split join push pop shift unshift keys values each exists delete defined die warn open close sort map grep scalar ref bless"),
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		multiQuotes:  "`",
+		varPrefixes:  "$@%",
+	}).lex, "perl")
+}
@@ -0,0 +1,364 @@
+package highlight
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// scanner accumulates tokens while walking a source string
+type scanner struct {
+	src    string
+	pos    int
+	tokens []Token
+}
+
+func (s *scanner) emit(t TokenType, end int) {
+	s.tokens = append(s.tokens, Token{Type: t, Text: s.src[s.pos:end]})
+	s.pos = end
+}
+
+func (s *scanner) hasPrefix(prefix string) bool {
+	return strings.HasPrefix(s.src[s.pos:], prefix)
+}
+
+// lineEnd returns the index of the next newline at or after i
+func lineEnd(src string, i int) int {
+	if j := strings.IndexByte(src[i:], '\n'); j >= 0 {
+		return i + j
+	}
+	return len(src)
+}
+
+// skipSpaces returns the index of the first non-blank character at or after i
+func skipSpaces(src string, i int) int {
+	for i < len(src) && (src[i] == ' ' || src[i] == '\t') {
+		i++
+	}
+	return i
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= utf8.RuneSelf
+}
+
+func isIdentChar(c byte) bool { return isIdentStart(c) || isDigit(c) }
+
+// scanQuoted returns the end of a string literal opened at pos. Strings that
+// aren't closed run to the end of the line, or of the input if multiline.
+func scanQuoted(src string, pos int, quote string, multiline, escapes bool) int {
+	i := pos + len(quote)
+	for i < len(src) {
+		switch {
+		case escapes && src[i] == '\\':
+			i += 2
+		case strings.HasPrefix(src[i:], quote):
+			return i + len(quote)
+		case src[i] == '\n' && !multiline:
+			return i
+		default:
+			i++
+		}
+	}
+	return len(src)
+}
+
+// scanNumber returns the end of a numeric literal starting at pos
+func scanNumber(src string, pos int) int {
+	i := pos
+	if src[i] == '0' && i+1 < len(src) && strings.IndexByte("xXbBoO", src[i+1]) >= 0 {
+		i += 2
+	}
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case isDigit(c) || c == '_':
+			i++
+		case c == '.' && i+1 < len(src) && isDigit(src[i+1]):
+			i++
+		case (c == 'e' || c == 'E') && i+1 < len(src) &&
+			(isDigit(src[i+1]) || ((src[i+1] == '+' || src[i+1] == '-') && i+2 < len(src) && isDigit(src[i+2]))):
+			i += 2
+		case isIdentChar(c):
+			// hex digits and type suffixes such as 10u, 1.5f, 7i64
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+const (
+	operatorChars    = "+-*/%=&|<>!^~?:"
+	punctuationChars = "{}[]();,."
+)
+
+// spec describes a C-like language well enough for the generic lexer
+type spec struct {
+	keywords      map[string]bool
+	builtins      map[string]bool
+	constants     map[string]bool
+	classKeywords map[string]bool // keywords followed by a type name
+
+	lineComments  []string
+	blockComments [][2]string
+	quotes        string // single-line, backslash-escaped string delimiters
+	multiQuotes   string // delimiters of strings that may span lines
+	rawQuotes     string // delimiters without escape processing
+	tripleQuotes  bool   // Python-style """ and ''' strings
+	charLiterals  bool   // ' only opens character literals (Rust lifetimes)
+
+	varPrefixes  string // sigils such as $ in shell or @ in Ruby
+	identExtra   string // extra identifier characters
+	decorators   bool   // @name annotations
+	symbols      bool   // Ruby :symbols
+	preprocessor bool   // # directives at the start of a line
+	foldCase     bool   // case-insensitive keywords (SQL)
+	classCase    bool   // Capitalized identifiers are type names
+	keyStrings   bool   // "key": strings are properties (JSON)
+}
+
+func words(s string) map[string]bool {
+	m := make(map[string]bool)
+	for _, w := range strings.Fields(s) {
+		m[w] = true
+	}
+	return m
+}
+
+func (sp *spec) isIdentStart(c byte) bool {
+	return isIdentStart(c) || (sp.identExtra != "" && strings.IndexByte(sp.identExtra, c) >= 0)
+}
+
+func (sp *spec) isIdentChar(c byte) bool {
+	return sp.isIdentStart(c) || isDigit(c)
+}
+
+func (sp *spec) lex(src string) []Token {
+	s := &scanner{src: src}
+	lineStart := true
+	expectClass := false
+
+	for s.pos < len(src) {
+		c := src[s.pos]
+
+		// Whitespace
+		if c == '\n' {
+			s.emit(Plain, s.pos+1)
+			lineStart = true
+			continue
+		}
+		if c == ' ' || c == '\t' || c == '\r' {
+			i := s.pos
+			for i < len(src) && (src[i] == ' ' || src[i] == '\t' || src[i] == '\r') {
+				i++
+			}
+			s.emit(Plain, i)
+			continue
+		}
+		atLineStart := lineStart
+		lineStart = false
+
+		if sp.preprocessor && atLineStart && c == '#' {
+			s.emit(Keyword, lineEnd(src, s.pos))
+			continue
+		}
+
+		if end, ok := sp.comment(s); ok {
+			s.emit(Comment, end)
+			continue
+		}
+
+		if end, ok := sp.stringLiteral(s); ok {
+			s.emit(String, end)
+			if sp.keyStrings {
+				if j := skipSpaces(src, end); j < len(src) && src[j] == ':' {
+					s.tokens[len(s.tokens)-1].Type = Property
+				}
+			}
+			expectClass = false
+			continue
+		}
+
+		if isDigit(c) || (c == '.' && s.pos+1 < len(src) && isDigit(src[s.pos+1])) {
+			s.emit(Number, scanNumber(src, s.pos))
+			expectClass = false
+			continue
+		}
+
+		if end, ok := sp.variable(s); ok {
+			s.emit(Variable, end)
+			continue
+		}
+
+		if sp.decorators && c == '@' && s.pos+1 < len(src) && sp.isIdentStart(src[s.pos+1]) {
+			i := s.pos + 1
+			for i < len(src) && (sp.isIdentChar(src[i]) || src[i] == '.') {
+				i++
+			}
+			s.emit(Builtin, i)
+			continue
+		}
+
+		if sp.symbols && c == ':' && s.pos+1 < len(src) && sp.isIdentStart(src[s.pos+1]) &&
+			(s.pos == 0 || (src[s.pos-1] != ':' && !sp.isIdentChar(src[s.pos-1]))) {
+			i := s.pos + 1
+			for i < len(src) && sp.isIdentChar(src[i]) {
+				i++
+			}
+			s.emit(Symbol, i)
+			continue
+		}
+
+		if sp.isIdentStart(c) {
+			i := s.pos
+			for i < len(src) && sp.isIdentChar(src[i]) {
+				i++
+			}
+			word := src[s.pos:i]
+			key := word
+			if sp.foldCase {
+				key = strings.ToLower(word)
+			}
+
+			var t TokenType
+			switch {
+			case sp.keywords[key]:
+				t = Keyword
+			case sp.constants[key]:
+				t = Constant
+			case expectClass:
+				t = ClassName
+			case sp.builtins[key]:
+				t = Builtin
+			case func() bool { j := skipSpaces(src, i); return j < len(src) && src[j] == '(' }():
+				t = Function
+			case sp.classCase && word[0] >= 'A' && word[0] <= 'Z':
+				t = ClassName
+				if strings.ToUpper(word) == word && len(word) > 1 {
+					t = Constant
+				}
+			}
+			expectClass = t == Keyword && sp.classKeywords[key]
+			s.emit(t, i)
+			continue
+		}
+
+		expectClass = false
+		switch {
+		case strings.IndexByte(operatorChars, c) >= 0:
+			i := s.pos
+			for i < len(src) && strings.IndexByte(operatorChars, src[i]) >= 0 {
+				i++
+			}
+			s.emit(Operator, i)
+		case strings.IndexByte(punctuationChars, c) >= 0:
+			s.emit(Punctuation, s.pos+1)
+		default:
+			_, size := utf8.DecodeRuneInString(src[s.pos:])
+			s.emit(Plain, s.pos+size)
+		}
+	}
+
+	return s.tokens
+}
+
+// comment matches a line or block comment at the scanner position
+func (sp *spec) comment(s *scanner) (int, bool) {
+	for _, bc := range sp.blockComments {
+		if s.hasPrefix(bc[0]) {
+			if j := strings.Index(s.src[s.pos+len(bc[0]):], bc[1]); j >= 0 {
+				return s.pos + len(bc[0]) + j + len(bc[1]), true
+			}
+			return len(s.src), true
+		}
+	}
+	for _, lc := range sp.lineComments {
+		if !s.hasPrefix(lc) {
+			continue
+		}
+		// "#" only starts a comment at a word boundary: $# and a#b are not comments
+		if lc == "#" && s.pos > 0 && strings.IndexByte(" \t\n;(", s.src[s.pos-1]) < 0 {
+			continue
+		}
+		return lineEnd(s.src, s.pos), true
+	}
+	return 0, false
+}
+
+// stringLiteral matches a string or character literal at the scanner position
+func (sp *spec) stringLiteral(s *scanner) (int, bool) {
+	c := s.src[s.pos]
+
+	if sp.tripleQuotes && (s.hasPrefix(`"""`) || s.hasPrefix(`'''`)) {
+		return scanQuoted(s.src, s.pos, s.src[s.pos:s.pos+3], true, true), true
+	}
+	if sp.charLiterals && c == '\'' {
+		return charLiteral(s.src, s.pos)
+	}
+	switch {
+	case strings.IndexByte(sp.rawQuotes, c) >= 0:
+		return scanQuoted(s.src, s.pos, string(c), true, false), true
+	case strings.IndexByte(sp.multiQuotes, c) >= 0:
+		return scanQuoted(s.src, s.pos, string(c), true, true), true
+	case strings.IndexByte(sp.quotes, c) >= 0:
+		return scanQuoted(s.src, s.pos, string(c), false, true), true
+	}
+	return 0, false
+}
+
+// charLiteral matches 'x' or '\n', leaving lifetimes like 'a alone
+func charLiteral(src string, pos int) (int, bool) {
+	i := pos + 1
+	if i >= len(src) {
+		return 0, false
+	}
+	if src[i] == '\\' {
+		if j := strings.IndexByte(src[i+1:], '\''); j >= 0 && j <= 10 {
+			return i + 1 + j + 1, true
+		}
+		return 0, false
+	}
+	_, size := utf8.DecodeRuneInString(src[i:])
+	if i+size < len(src) && src[i+size] == '\'' {
+		return i + size + 1, true
+	}
+	return 0, false
+}
+
+// maxBraceVariable bounds how far a ${...} variable may reach for its brace
+const maxBraceVariable = 256
+
+// variable matches sigil-prefixed variables such as $x, ${x}, $? or @ivar
+func (sp *spec) variable(s *scanner) (int, bool) {
+	src := s.src
+	c := src[s.pos]
+	if sp.varPrefixes == "" || strings.IndexByte(sp.varPrefixes, c) < 0 || s.pos+1 >= len(src) {
+		return 0, false
+	}
+
+	i := s.pos + 1
+	for c == '@' && i < len(src) && src[i] == c {
+		i++ // @@class_var
+	}
+	switch {
+	case i < len(src) && src[i] == '{':
+		// Only look a short way for the brace, or a line of unclosed ${
+		// would be searched again from every one of them
+		end := min(len(src), i+maxBraceVariable)
+		if j := strings.IndexByte(src[i:end], '}'); j >= 0 && strings.IndexByte(src[i:i+j], '\n') < 0 {
+			return i + j + 1, true
+		}
+		return 0, false
+	case i < len(src) && sp.isIdentStart(src[i]):
+		for i < len(src) && sp.isIdentChar(src[i]) {
+			i++
+		}
+		return i, true
+	case c == '$' && i < len(src) && strings.IndexByte("#?@$!*-0123456789", src[i]) >= 0:
+		return i + 1, true
+	}
+	return 0, false
+}
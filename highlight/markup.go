@@ -0,0 +1,228 @@
+package highlight
+
+import (
+	"strings"
+)
+
+func init() {
+	register(func(src string) []Token { return lexMarkup(src, true) }, "html")
+	register(func(src string) []Token { return lexMarkup(src, false) }, "xml")
+	register(lexCSS, "css")
+}
+
+// lexMarkup tokenizes HTML or XML. In HTML the bodies of <script> and
+// <style> elements are handed to the JavaScript and CSS lexers.
+func lexMarkup(src string, html bool) []Token {
+	s := &scanner{src: src}
+
+	for s.pos < len(src) {
+		switch {
+		case s.hasPrefix("<!--"):
+			s.emit(Comment, indexAfter(src, s.pos+4, "-->"))
+		case s.hasPrefix("<![CDATA["):
+			s.emit(CData, indexAfter(src, s.pos+9, "]]>"))
+		case s.hasPrefix("<!") || s.hasPrefix("<?"):
+			s.emit(Prolog, indexAfter(src, s.pos+2, ">"))
+		case src[s.pos] == '<' && s.pos+1 < len(src) && (isIdentStart(src[s.pos+1]) || src[s.pos+1] == '/'):
+			name := lexTag(s)
+			if html && (name == "script" || name == "style") {
+				end := indexFold(src, s.pos, "</"+name)
+				if end < 0 {
+					end = len(src)
+				}
+				lang := "javascript"
+				if name == "style" {
+					lang = "css"
+				}
+				s.tokens = append(s.tokens, lexers[lang](src[s.pos:end])...)
+				s.pos = end
+			}
+		case src[s.pos] == '&':
+			end := s.pos + 1
+			for end < len(src) && end-s.pos < 12 && (isIdentChar(src[end]) || src[end] == '#') {
+				end++
+			}
+			if end < len(src) && src[end] == ';' {
+				s.emit(Constant, end+1)
+			} else {
+				s.emit(Plain, s.pos+1)
+			}
+		default:
+			end := s.pos + 1
+			for end < len(src) && src[end] != '<' && src[end] != '&' {
+				end++
+			}
+			s.emit(Plain, end)
+		}
+	}
+	return s.tokens
+}
+
+// lexTag tokenizes a start or end tag and returns its lowercased name for
+// start tags
+func lexTag(s *scanner) string {
+	src := s.src
+	closing := s.hasPrefix("</")
+	if closing {
+		s.emit(Punctuation, s.pos+2)
+	} else {
+		s.emit(Punctuation, s.pos+1)
+	}
+
+	start := s.pos
+	for s.pos < len(src) && (isIdentChar(src[s.pos]) || strings.IndexByte(":-.", src[s.pos]) >= 0) {
+		s.pos++
+	}
+	name := strings.ToLower(src[start:s.pos])
+	s.pos = start
+	s.emit(Tag, start+len(name))
+
+	for s.pos < len(src) {
+		c := src[s.pos]
+		switch {
+		case c == '>':
+			s.emit(Punctuation, s.pos+1)
+			if closing {
+				return ""
+			}
+			return name
+		case s.hasPrefix("/>"):
+			s.emit(Punctuation, s.pos+2)
+			return ""
+		case c == '=':
+			s.emit(Punctuation, s.pos+1)
+		case c == '"' || c == '\'':
+			s.emit(AttrValue, scanQuoted(src, s.pos, string(c), true, false))
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			s.emit(Plain, s.pos+1)
+		case c == '<':
+			// Unterminated tag; let the caller carry on from here
+			return ""
+		default:
+			end := s.pos + 1
+			for end < len(src) && strings.IndexByte(" \t\n\r=>/<\"'", src[end]) < 0 {
+				end++
+			}
+			t := AttrName
+			if prev := s.tokens[len(s.tokens)-1]; prev.Text == "=" {
+				t = AttrValue
+			}
+			s.emit(t, end)
+		}
+	}
+	return ""
+}
+
+// indexAfter returns the position just past the first occurrence of needle
+// at or after i, or the end of src
+func indexAfter(src string, i int, needle string) int {
+	if i > len(src) {
+		return len(src)
+	}
+	if j := strings.Index(src[i:], needle); j >= 0 {
+		return i + j + len(needle)
+	}
+	return len(src)
+}
+
+// indexFold is a case-insensitive strings.Index starting at i
+func indexFold(src string, i int, needle string) int {
+	if j := strings.Index(strings.ToLower(src[i:]), strings.ToLower(needle)); j >= 0 {
+		return i + j
+	}
+	return -1
+}
+
+// cssNestingRules are at-rules whose blocks hold rulesets, not declarations
+var cssNestingRules = words("@media @supports @document @layer @container @scope")
+
+// lexCSS tokenizes stylesheets, telling selectors apart from declarations
+// by tracking which kind of block we are in
+func lexCSS(src string) []Token {
+	s := &scanner{src: src}
+	var blocks []bool // true for declaration blocks
+	pendingDecl := true
+	declStart := false
+
+	inDecl := func() bool { return len(blocks) > 0 && blocks[len(blocks)-1] }
+
+	for s.pos < len(src) {
+		c := src[s.pos]
+		switch {
+		case s.hasPrefix("/*"):
+			s.emit(Comment, indexAfter(src, s.pos+2, "*/"))
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			s.emit(Plain, s.pos+1)
+		case c == '"' || c == '\'':
+			s.emit(String, scanQuoted(src, s.pos, string(c), false, true))
+		case c == '@':
+			end := s.pos + 1
+			for end < len(src) && (isIdentChar(src[end]) || src[end] == '-') {
+				end++
+			}
+			pendingDecl = !cssNestingRules[src[s.pos:end]]
+			s.emit(Keyword, end)
+		case c == '{':
+			blocks = append(blocks, pendingDecl)
+			pendingDecl = true
+			declStart = true
+			s.emit(Punctuation, s.pos+1)
+		case c == '}':
+			if len(blocks) > 0 {
+				blocks = blocks[:len(blocks)-1]
+			}
+			s.emit(Punctuation, s.pos+1)
+		case c == ';':
+			declStart = inDecl()
+			s.emit(Punctuation, s.pos+1)
+		case !inDecl():
+			// Selector text runs up to the next block or statement
+			end := s.pos
+			for end < len(src) && strings.IndexByte("{;}", src[end]) < 0 && !strings.HasPrefix(src[end:], "/*") {
+				end++
+			}
+			trimmed := strings.TrimRight(src[s.pos:end], " \t\n\r")
+			s.emit(Selector, s.pos+len(trimmed))
+		case declStart && (isIdentStart(c) || c == '-'):
+			end := s.pos
+			for end < len(src) && (isIdentChar(src[end]) || src[end] == '-') {
+				end++
+			}
+			declStart = false
+			s.emit(Property, end)
+		case c == '#':
+			end := s.pos + 1
+			for end < len(src) && isIdentChar(src[end]) {
+				end++
+			}
+			s.emit(Number, end)
+		case isDigit(c) || (c == '.' && s.pos+1 < len(src) && isDigit(src[s.pos+1])):
+			end := scanNumber(src, s.pos)
+			if end < len(src) && src[end] == '%' {
+				end++
+			}
+			s.emit(Number, end)
+		case c == '!':
+			end := s.pos + 1
+			for end < len(src) && isIdentChar(src[end]) {
+				end++
+			}
+			s.emit(Keyword, end)
+		case isIdentStart(c) || c == '-':
+			end := s.pos
+			for end < len(src) && (isIdentChar(src[end]) || src[end] == '-') {
+				end++
+			}
+			t := Plain
+			if end < len(src) && src[end] == '(' {
+				t = Function
+			}
+			s.emit(t, end)
+		case strings.IndexByte(":,()", c) >= 0:
+			s.emit(Punctuation, s.pos+1)
+		default:
+			s.emit(Operator, s.pos+1)
+		}
+	}
+	return s.tokens
+}
@@ -0,0 +1,270 @@
+package highlight
+
+import (
+	"strings"
+)
+
+func init() {
+	register(lexYAML, "yaml")
+	register(lexMarkdown, "markdown")
+}
+
+var yamlConstants = words("true false yes no on off null ~ True False Yes No On Off Null TRUE FALSE NULL")
+
+// lexYAML works line by line: keys, list markers, comments and scalars
+func lexYAML(src string) []Token {
+	s := &scanner{src: src}
+
+	for s.pos < len(src) {
+		end := lineEnd(src, s.pos)
+		line := src[s.pos:end]
+
+		switch trimmed := strings.TrimSpace(line); {
+		case trimmed == "---" || trimmed == "...":
+			s.emit(Punctuation, end)
+		case strings.HasPrefix(trimmed, "#"):
+			s.emit(Comment, end)
+		default:
+			lexYAMLLine(s, end)
+		}
+
+		if s.pos < len(src) {
+			s.emit(Plain, s.pos+1) // newline
+		}
+	}
+	return s.tokens
+}
+
+func lexYAMLLine(s *scanner, end int) {
+	src := s.src
+
+	// Indentation and list markers
+	for s.pos < end {
+		i := skipSpaces(src, s.pos)
+		if i > s.pos {
+			s.emit(Plain, i)
+		}
+		if s.pos+1 < end && src[s.pos] == '-' && src[s.pos+1] == ' ' {
+			s.emit(Punctuation, s.pos+1)
+			continue
+		}
+		break
+	}
+
+	// key:
+	if i := yamlKeyEnd(src[s.pos:end]); i > 0 {
+		s.emit(Property, s.pos+i)
+		s.emit(Punctuation, s.pos+1)
+	}
+
+	for s.pos < end {
+		c := src[s.pos]
+		switch {
+		case c == ' ' || c == '\t':
+			s.emit(Plain, skipSpaces(src, s.pos))
+		case c == '#' && s.pos > 0 && src[s.pos-1] == ' ':
+			s.emit(Comment, end)
+		case c == '"' || c == '\'':
+			s.emit(String, scanQuoted(src, s.pos, string(c), false, c == '"'))
+		case c == '&' || c == '*':
+			i := s.pos + 1
+			for i < end && src[i] != ' ' {
+				i++
+			}
+			s.emit(Variable, i)
+		case c == '!':
+			i := s.pos + 1
+			for i < end && src[i] != ' ' {
+				i++
+			}
+			s.emit(Keyword, i)
+		case c == '|' || c == '>' || strings.IndexByte("[]{},", c) >= 0:
+			s.emit(Punctuation, s.pos+1)
+		default:
+			i := s.pos
+			for i < end && strings.IndexByte(",]}", src[i]) < 0 && !strings.HasPrefix(src[i:end], " #") {
+				i++
+			}
+			scalar := strings.TrimRight(src[s.pos:i], " \t")
+			t := String
+			switch {
+			case yamlConstants[scalar]:
+				t = Constant
+			case scalar != "" && scanNumber(scalar, 0) == len(scalar) && (isDigit(scalar[0]) || scalar[0] == '.'):
+				t = Number
+			case strings.HasPrefix(scalar, "-") && len(scalar) > 1 && isDigit(scalar[1]) && scanNumber(scalar, 1) == len(scalar):
+				t = Number
+			}
+			if scalar == "" {
+				scalar = src[s.pos : s.pos+1]
+				t = Plain
+			}
+			s.emit(t, s.pos+len(scalar))
+		}
+	}
+}
+
+// yamlKeyEnd returns the length of a "key:" prefix of line, or 0
+func yamlKeyEnd(line string) int {
+	if line == "" {
+		return 0
+	}
+	if line[0] == '"' || line[0] == '\'' {
+		end := scanQuoted(line, 0, line[:1], false, line[0] == '"')
+		if end < len(line) && line[end] == ':' && (end+1 == len(line) || line[end+1] == ' ') {
+			return end
+		}
+		return 0
+	}
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case ':':
+			if i > 0 && (i+1 == len(line) || line[i+1] == ' ') {
+				return i
+			}
+		case '#', '[', '{', '"', '\'':
+			return 0
+		}
+	}
+	return 0
+}
+
+// lexMarkdown highlights block structure and a few inline elements. Fenced
+// code blocks are highlighted with the language named after the fence.
+func lexMarkdown(src string) []Token {
+	s := &scanner{src: src}
+
+	for s.pos < len(src) {
+		end := lineEnd(src, s.pos)
+		line := src[s.pos:end]
+		trimmed := strings.TrimLeft(line, " ")
+
+		switch {
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			fence := trimmed[:3]
+			lang := strings.TrimSpace(trimmed[3:])
+			s.emit(Punctuation, end)
+
+			bodyStart := end
+			if bodyStart < len(src) {
+				bodyStart++
+			}
+			bodyEnd, closeEnd := len(src), len(src)
+			for i := bodyStart; i < len(src); {
+				e := lineEnd(src, i)
+				if strings.HasPrefix(strings.TrimLeft(src[i:e], " "), fence) {
+					bodyEnd, closeEnd = i, e
+					break
+				}
+				i = e + 1
+			}
+			if end < bodyStart {
+				s.emit(Plain, bodyStart)
+			}
+			if alias, ok := fenceAliases[lang]; ok {
+				lang = alias
+			}
+			if lex, ok := lexers[lang]; ok && lang != "markdown" {
+				s.tokens = append(s.tokens, lex(src[bodyStart:bodyEnd])...)
+				s.pos = bodyEnd
+			} else {
+				s.emit(String, bodyEnd)
+			}
+			s.emit(Punctuation, closeEnd)
+		case strings.HasPrefix(trimmed, "#"):
+			s.emit(Keyword, end)
+		case strings.HasPrefix(trimmed, ">"):
+			s.emit(Plain, s.pos+len(line)-len(trimmed))
+			s.emit(Punctuation, s.pos+1)
+			lexMarkdownInline(s, end)
+		case isListMarker(trimmed):
+			s.emit(Plain, s.pos+len(line)-len(trimmed))
+			s.emit(Punctuation, s.pos+strings.IndexByte(trimmed, ' '))
+			lexMarkdownInline(s, end)
+		case isRule(trimmed):
+			s.emit(Punctuation, end)
+		default:
+			lexMarkdownInline(s, end)
+		}
+
+		if s.pos < len(src) {
+			s.emit(Plain, s.pos+1) // newline
+		}
+	}
+	return s.tokens
+}
+
+// fenceAliases maps common fence info strings to lexer names
+var fenceAliases = map[string]string{
+	"js":     "javascript",
+	"ts":     "typescript",
+	"py":     "python",
+	"sh":     "bash",
+	"shell":  "bash",
+	"yml":    "yaml",
+	"rb":     "ruby",
+	"rs":     "rust",
+	"golang": "go",
+	"c++":    "cpp",
+	"cs":     "csharp",
+}
+
+// isRule matches thematic breaks such as --- or * * *
+func isRule(line string) bool {
+	line = strings.TrimSpace(line)
+	if len(line) < 3 || strings.IndexByte("-*_", line[0]) < 0 {
+		return false
+	}
+	return strings.Trim(line, string(line[0])+" ") == "" && strings.Count(line, line[:1]) >= 3
+}
+
+func isListMarker(line string) bool {
+	if len(line) > 1 && strings.IndexByte("-*+", line[0]) >= 0 && line[1] == ' ' {
+		return true
+	}
+	i := 0
+	for i < len(line) && isDigit(line[i]) {
+		i++
+	}
+	return i > 0 && i+1 < len(line) && (line[i] == '.' || line[i] == ')') && line[i+1] == ' '
+}
+
+// lexMarkdownInline handles `code`, **bold**, *italic* and [links](url)
+func lexMarkdownInline(s *scanner, end int) {
+	src := s.src
+	for s.pos < end {
+		rest := src[s.pos:end]
+		switch {
+		case rest[0] == '`':
+			if j := strings.IndexByte(rest[1:], '`'); j >= 0 {
+				s.emit(String, s.pos+j+2)
+				continue
+			}
+		case strings.HasPrefix(rest, "**") || strings.HasPrefix(rest, "__"):
+			if j := strings.Index(rest[2:], rest[:2]); j > 0 {
+				s.emit(Bold, s.pos+j+4)
+				continue
+			}
+		case rest[0] == '*' || (rest[0] == '_' && (s.pos == 0 || !isIdentChar(src[s.pos-1]))):
+			if j := strings.IndexByte(rest[1:], rest[0]); j > 0 && rest[1] != ' ' {
+				s.emit(Italic, s.pos+j+2)
+				continue
+			}
+		case rest[0] == '[':
+			if j := strings.Index(rest, "]("); j > 0 {
+				if k := strings.IndexByte(rest[j:], ')'); k > 0 {
+					s.emit(Plain, s.pos+j+2)
+					s.emit(URL, s.pos+k-2)
+					s.emit(Plain, s.pos+1)
+					continue
+				}
+			}
+		}
+
+		i := s.pos + 1
+		for i < end && strings.IndexByte("`*_[", src[i]) < 0 {
+			i++
+		}
+		s.emit(Plain, i)
+	}
+}
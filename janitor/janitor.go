@@ -0,0 +1,142 @@
+// Package janitor periodically purges pastes that can no longer be read:
+// those past their expiry and burn-after-read pastes that were already read.
+// It also copies out blobs still waiting for their storage backend, removes
+// content blobs no paste refers to any more and expired login sessions.
+package janitor
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"patbin/database"
+	"patbin/models"
+
+	"gorm.io/gorm"
+)
+
+// Stats counts the pastes, blobs and sessions removed by one sweep, and the
+// blobs it flushed to storage
+type Stats struct {
+	Expired  int
+	Burned   int
+	Flushed  int
+	Blobs    int
+	Sessions int
+}
+
+type Janitor struct {
+	db        *gorm.DB
+	interval  time.Duration
+	batchSize int
+}
+
+func New(db *gorm.DB, interval time.Duration, batchSize int) *Janitor {
+	return &Janitor{
+		db:        db,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+// Run sweeps once immediately and then every interval until ctx is done
+func (j *Janitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		stats, err := j.Sweep(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("janitor: sweep failed: %v", err)
+		}
+		if stats.Expired > 0 || stats.Burned > 0 {
+			log.Printf("janitor: purged %d expired and %d burned pastes", stats.Expired, stats.Burned)
+		}
+		if stats.Flushed > 0 {
+			log.Printf("janitor: flushed %d blobs to storage", stats.Flushed)
+		}
+		if stats.Blobs > 0 {
+			log.Printf("janitor: purged %d unused blobs", stats.Blobs)
+		}
+		if stats.Sessions > 0 {
+			log.Printf("janitor: purged %d expired sessions", stats.Sessions)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep purges everything currently due, a batch at a time so the
+// database is never locked for long
+func (j *Janitor) Sweep(ctx context.Context) (Stats, error) {
+	var stats Stats
+
+	expired, err := j.purge(ctx, func(db *gorm.DB) *gorm.DB {
+		return db.Where("expires_at IS NOT NULL AND expires_at <= ?", time.Now())
+	})
+	stats.Expired = expired
+	if err != nil {
+		return stats, err
+	}
+
+	// A burn-after-read paste that has been viewed is gone for readers
+	stats.Burned, err = j.purge(ctx, func(db *gorm.DB) *gorm.DB {
+		return db.Where("burn_after_read = ? AND views > 0", true)
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	// Content whose request failed to write it out
+	stats.Flushed, err = database.FlushBlobs(ctx, j.batchSize)
+	if err != nil {
+		return stats, err
+	}
+
+	// Content released by edits, or left over when a purge failed midway
+	stats.Blobs, err = database.PurgeBlobs(j.db.WithContext(ctx), j.batchSize)
+	if err != nil {
+		return stats, err
+	}
+
+	// Sessions nobody refreshed within the session lifetime
+	result := j.db.WithContext(ctx).Where("expires_at <= ?", time.Now()).Delete(&models.Session{})
+	stats.Sessions = int(result.RowsAffected)
+	return stats, result.Error
+}
+
+// purge deletes the pastes selected by scope and returns how many went
+func (j *Janitor) purge(ctx context.Context, scope func(*gorm.DB) *gorm.DB) (int, error) {
+	total := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+
+		var batch []models.Paste
+		err := j.db.WithContext(ctx).
+			Select("id", "forked_from_id", "forked_from_rev", "content_hash", "content_backend", "content_key").
+			Scopes(scope).
+			Order("id").
+			Limit(j.batchSize).
+			Find(&batch).Error
+		if err != nil {
+			return total, err
+		}
+
+		for i := range batch {
+			if err := database.DeletePaste(j.db.WithContext(ctx), &batch[i]); err != nil {
+				return total, err
+			}
+			total++
+		}
+
+		if len(batch) < j.batchSize {
+			return total, nil
+		}
+	}
+}
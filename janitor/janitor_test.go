@@ -0,0 +1,73 @@
+package janitor
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"patbin/config"
+	"patbin/database"
+	"patbin/models"
+	"patbin/storage"
+
+	"gorm.io/gorm"
+)
+
+func TestSweep(t *testing.T) {
+	if err := database.Init(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.InitStorage(&config.Config{StorageBackend: storage.Inline}); err != nil {
+		t.Fatal(err)
+	}
+	db := database.DB
+
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	pastes := []models.Paste{
+		{ID: "expired", Content: "gone", ExpiresAt: &past},
+		{ID: "burned", Content: "read", BurnAfterRead: true, Views: 1},
+		{ID: "unread", Content: "waiting", BurnAfterRead: true},
+		{ID: "later", Content: "still here", ExpiresAt: &future},
+		{ID: "kept", Content: "still here"},
+	}
+	for i := range pastes {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return database.CreatePaste(tx, &pastes[i])
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	sessions := []models.Session{
+		{ID: "old", UserID: 1, RefreshHash: "a", ExpiresAt: past},
+		{ID: "live", UserID: 1, RefreshHash: "b", ExpiresAt: future},
+	}
+	if err := db.Create(&sessions).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Batches smaller than the work make the sweep loop
+	stats, err := New(db, time.Hour, 1).Sweep(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Stats{Expired: 1, Burned: 1, Blobs: 0, Sessions: 1}); stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+
+	var left []string
+	db.Model(&models.Paste{}).Order("id").Pluck("id", &left)
+	if want := []string{"kept", "later", "unread"}; len(left) != 3 || left[0] != want[0] || left[1] != want[1] || left[2] != want[2] {
+		t.Errorf("pastes left %v, want %v", left, want)
+	}
+	var blobs int64
+	db.Model(&models.Blob{}).Count(&blobs)
+	if blobs != 2 {
+		t.Errorf("%d blobs left, want 2", blobs)
+	}
+
+	if stats, err := New(db, time.Hour, 1).Sweep(context.Background()); err != nil || stats != (Stats{}) {
+		t.Errorf("second sweep = %+v, %v; want nothing to do", stats, err)
+	}
+}
@@ -0,0 +1,365 @@
+package langdetect
+
+import (
+	"encoding/json"
+	"patbin/models"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Only the head of large pastes is inspected
+const maxScan = 64 * 1024
+
+// minScore is the heuristic score below which content stays plaintext
+const minScore = 4
+
+type Result struct {
+	Language   string  `json:"language"`
+	Confidence float64 `json:"confidence"`
+	Reason     string  `json:"reason"`
+}
+
+var plaintext = Result{Language: "plaintext", Confidence: 0, Reason: "none"}
+
+// Detect guesses the language of content. Evidence is tried from strongest
+// to weakest: the filename, an editor modeline, a shebang, the document's
+// structure, and finally keyword heuristics.
+func Detect(content, filename string) Result {
+	if lang := fromFilename(filename); lang != "" {
+		return Result{Language: lang, Confidence: 1, Reason: "filename"}
+	}
+
+	if len(content) > maxScan {
+		content = content[:maxScan]
+	}
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	if strings.TrimSpace(content) == "" {
+		return plaintext
+	}
+
+	if lang := fromModeline(content); lang != "" {
+		return Result{Language: lang, Confidence: 1, Reason: "modeline"}
+	}
+	if lang := fromShebang(content); lang != "" {
+		return Result{Language: lang, Confidence: 0.95, Reason: "shebang"}
+	}
+	if lang := fromStructure(content); lang != "" {
+		return Result{Language: lang, Confidence: 0.9, Reason: "structure"}
+	}
+	return fromHeuristics(content)
+}
+
+// knownLanguages are the names the highlighter and the UI understand
+var knownLanguages = func() map[string]bool {
+	m := map[string]bool{"csharp": true}
+	for _, lang := range models.LanguageExtensions {
+		m[lang] = true
+	}
+	return m
+}()
+
+// normalize maps an extension, alias or language name to a language
+func normalize(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if knownLanguages[name] {
+		return name
+	}
+	if lang, ok := models.LanguageExtensions[name]; ok {
+		return lang
+	}
+	if lang, ok := aliases[name]; ok {
+		return lang
+	}
+	return ""
+}
+
+var aliases = map[string]string{
+	"sh":          "bash",
+	"zsh":         "bash",
+	"shell":       "bash",
+	"node":        "javascript",
+	"nodejs":      "javascript",
+	"js":          "javascript",
+	"ts":          "typescript",
+	"ts-node":     "typescript",
+	"deno":        "typescript",
+	"python2":     "python",
+	"python3":     "python",
+	"pypy":        "python",
+	"rscript":     "r",
+	"c++":         "cpp",
+	"cs":          "csharp",
+	"golang":      "go",
+	"yml":         "yaml",
+	"kts":         "kotlin",
+	"htm":         "html",
+	"scss":        "css",
+	"jsx":         "javascript",
+	"tsx":         "typescript",
+	"mjs":         "javascript",
+	"cjs":         "javascript",
+	"cc":          "cpp",
+	"cxx":         "cpp",
+	"hh":          "cpp",
+	"pm":          "perl",
+	"jsonc":       "json",
+	"bashrc":      "bash",
+	"zshrc":       "bash",
+	"profile":     "bash",
+	"gemfile":     "ruby",
+	"rakefile":    "ruby",
+	"vagrantfile": "ruby",
+}
+
+func fromFilename(filename string) string {
+	if filename == "" {
+		return ""
+	}
+	base := strings.ToLower(path.Base(strings.ReplaceAll(filename, "\\", "/")))
+	if lang, ok := aliases[strings.TrimPrefix(base, ".")]; ok {
+		return lang
+	}
+	ext := strings.TrimPrefix(path.Ext(base), ".")
+	if ext == "" {
+		return ""
+	}
+	if lang := normalize(ext); lang != "" && lang != "plaintext" {
+		return lang
+	}
+	return ""
+}
+
+var (
+	vimModeline   = regexp.MustCompile(`\b(?:vim?|ex):.*?\b(?:ft|filetype|syntax)=([\w+#-]+)`)
+	emacsModeline = regexp.MustCompile(`-\*-\s*(?:.*?\bmode:\s*([\w+#-]+)|([\w+#-]+))\s*;?.*?-\*-`)
+)
+
+// fromModeline looks for vim or emacs modelines in the first and last lines
+func fromModeline(content string) string {
+	lines := strings.Split(content, "\n")
+	candidates := lines
+	if len(lines) > 10 {
+		candidates = append(append([]string{}, lines[:5]...), lines[len(lines)-5:]...)
+	}
+	for _, line := range candidates {
+		if m := vimModeline.FindStringSubmatch(line); m != nil {
+			if lang := normalize(m[1]); lang != "" {
+				return lang
+			}
+		}
+		if m := emacsModeline.FindStringSubmatch(line); m != nil {
+			name := m[1]
+			if name == "" {
+				name = m[2]
+			}
+			if lang := normalize(strings.TrimSuffix(name, "-mode")); lang != "" {
+				return lang
+			}
+		}
+	}
+	return ""
+}
+
+var versionSuffix = regexp.MustCompile(`[\d.]+$`)
+
+// fromShebang maps the interpreter of a #! line to a language
+func fromShebang(content string) string {
+	if !strings.HasPrefix(content, "#!") {
+		return ""
+	}
+	line := content[2:]
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+
+	interpreter := path.Base(fields[0])
+	if interpreter == "env" {
+		interpreter = ""
+		for _, f := range fields[1:] {
+			if !strings.HasPrefix(f, "-") {
+				interpreter = f
+				break
+			}
+		}
+	}
+	interpreter = strings.ToLower(interpreter)
+	if lang := normalize(interpreter); lang != "" {
+		return lang
+	}
+	return normalize(versionSuffix.ReplaceAllString(interpreter, ""))
+}
+
+// fromStructure recognises formats with an unambiguous opening
+func fromStructure(content string) string {
+	trimmed := strings.TrimSpace(content)
+	lower := strings.ToLower(trimmed)
+
+	switch {
+	case strings.HasPrefix(trimmed, "<?php"):
+		return "php"
+	case strings.HasPrefix(trimmed, "<?xml"):
+		return "xml"
+	case strings.HasPrefix(lower, "<!doctype html") || strings.HasPrefix(lower, "<html"):
+		return "html"
+	case (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Valid([]byte(trimmed)):
+		return "json"
+	}
+	return ""
+}
+
+// rule adds weight for every match of pattern, up to a cap so a single
+// repetitive construct can't dominate
+type rule struct {
+	pattern *regexp.Regexp
+	weight  float64
+}
+
+const maxMatchesPerRule = 5
+
+func r(weight float64, pattern string) rule {
+	return rule{pattern: regexp.MustCompile("(?m)" + pattern), weight: weight}
+}
+
+var heuristics = map[string][]rule{
+	"go": {
+		r(6, `^package \w+\s*$`), r(3, `^import \($`), r(2, `\bfunc (\(\w+ \*?\w+\) )?\w+\(`),
+		r(1, `:= `), r(2, `\bfmt\.\w+\(`), r(2, `\bif err != nil\b`), r(1, `\bchan\b|\bgo func\b|\bdefer\b`),
+	},
+	"python": {
+		r(3, `^\s*def \w+\(.*\)( -> .+)?:\s*$`), r(3, `^from [\w.]+ import \w`), r(1, `^import \w+$`),
+		r(3, `^\s*elif .*:\s*$`), r(1, `\bself\.\w+`), r(5, `__name__ == ['"]__main__['"]`),
+		r(2, `^\s*class \w+(\(.*\))?:\s*$`), r(1, `\bNone\b|\bTrue\b|\bFalse\b`),
+	},
+	"javascript": {
+		r(1, `\b(const|let) \w+ = `), r(1, `\bfunction\s*\w*\s*\(`), r(1, `=> `), r(3, `\bconsole\.log\(`),
+		r(2, `\brequire\(['"]`), r(2, `\bdocument\.\w+`), r(3, `\bmodule\.exports\b`), r(1, `\bexport (default|const|function)\b`),
+		r(1, `===|!==`),
+	},
+	"typescript": {
+		r(3, `\w: (string|number|boolean|any|unknown|void)\b`), r(3, `^\s*(export )?interface \w+\s*\{`),
+		r(2, `^\s*(export )?type \w+ = `), r(2, `\bas const\b`), r(2, `\b(private|public|readonly) \w+:`),
+		r(1, `\bimport .* from ['"]`),
+	},
+	"java": {
+		r(3, `\bpublic (static )?(final )?(class|void|interface)\b`), r(5, `\bSystem\.out\.print`),
+		r(5, `^import java\.`), r(2, `@Override\b`), r(2, `\bpublic static void main\(String`),
+	},
+	"c": {
+		r(4, `^#include\s*<\w+\.h>`), r(2, `\bint main\s*\(`), r(1, `\bprintf\(`), r(2, `\b(malloc|free|sizeof)\(`),
+		r(1, `^#define \w+`), r(1, `\bstruct \w+\s*\{`),
+	},
+	"cpp": {
+		r(4, `^#include\s*<\w+>`), r(4, `\bstd::`), r(4, `\bcout\s*<<`), r(3, `\btemplate\s*<`),
+		r(2, `^using namespace \w+;`), r(1, `\bclass \w+\s*(:|\{)`),
+	},
+	"csharp": {
+		r(5, `^using System(\.\w+)*;`), r(5, `\bConsole\.Write(Line)?\(`), r(1, `^namespace [\w.]+`),
+		r(2, `\bpublic (async )?(static )?(Task|void|string|int)\b`), r(2, `\{ get; (private )?set; \}`),
+	},
+	"rust": {
+		r(2, `\bfn \w+(<.*>)?\(`), r(4, `\blet mut\b`), r(5, `\bprintln!\(`), r(4, `^use (std|crate)::`),
+		r(2, `^\s*impl\b`), r(2, `\b(pub fn|&mut|&str|Vec<|Option<|Result<)`),
+	},
+	"ruby": {
+		r(2, `^\s*def \w+[?!]?(\(.*\))?\s*$`), r(2, `^\s*end\s*$`), r(2, `\bputs\b`), r(2, `^require ['"]`),
+		r(4, `\.each do\b|\bdo \|\w+\|`), r(4, `\battr_(accessor|reader|writer)\b`),
+	},
+	"php": {
+		r(10, `<\?php`), r(1, `\$\w+\s*=`), r(4, `\bfunction \w+\(\$`), r(3, `\$this->`), r(1, `\becho\b`),
+	},
+	"bash": {
+		r(3, `^\s*(if|while) \[\[? `), r(3, `^\s*fi\s*$`), r(2, `^\s*done\s*$`), r(1, `^\s*echo `),
+		r(3, `^\s*export \w+=`), r(1, `\$\{\w+\}|\$\(`), r(2, `^\s*(sudo|apt|apt-get|cd|mkdir|curl|wget) `),
+	},
+	"sql": {
+		r(4, `(?i)\bselect\b.+\bfrom\b`), r(5, `(?i)^\s*(create|alter|drop) (table|index|view)\b`),
+		r(4, `(?i)\binsert into\b`), r(2, `(?i)\bwhere\b.+=`), r(2, `(?i)\b(inner|left|right) join\b`),
+	},
+	"html": {
+		r(2, `<(div|span|p|a|body|head|ul|li|table|form|input|script)\b[^>]*>`), r(1, `</\w+>`),
+	},
+	"css": {
+		r(1, `^\s*[.#]?[\w-]+(\s*[>,:.#][\w-]*)*\s*\{\s*$`), r(1.5, `^\s*[\w-]+\s*:\s*[^;]+;\s*$`),
+		r(3, `@media\b`), r(2, `\b\d+(px|em|rem|vh|vw)\b`),
+	},
+	"xml": {
+		r(2, `</\w+:\w+>`), r(1, `<\w+( \w+="[^"]*")+\s*/?>`),
+	},
+	"yaml": {
+		r(1, `^[\w-]+:( \S.*)?$`), r(1, `^\s+[\w-]+: \S`), r(2, `^---\s*$`), r(0.5, `^\s*- \S`),
+	},
+	"markdown": {
+		r(2, `^#{1,6} \S`), r(2, `\[[^\]]+\]\([^)]+\)`), r(3, "^```"), r(0.5, `^\s*[-*] \S`), r(1, `\*\*\w`),
+	},
+	"kotlin": {
+		r(3, `\bfun \w+\(`), r(1, `\bval \w+`), r(2, `\bdata class\b`), r(3, `^import kotlin\.`),
+		r(1, `\bwhen\s*\(`),
+	},
+	"swift": {
+		r(5, `^import (UIKit|Foundation|SwiftUI)`), r(5, `\bguard let\b`), r(2, `\bfunc \w+\(.*\) -> \w+`),
+		r(2, `\bvar \w+: \w+`), r(2, `\bif let\b`),
+	},
+	"scala": {
+		r(5, `\bcase class\b`), r(5, `^import scala\.`), r(4, `\bdef \w+(\(.*\))?: \w+.* =`), r(2, `^\s*object \w+`),
+	},
+	"r": {
+		r(2, `\w+ <- `), r(4, `\blibrary\(\w+\)`), r(2, `\bfunction\(`), r(4, `\bdata\.frame\(`), r(2, `\bc\(`),
+	},
+	"lua": {
+		r(2, `\blocal \w+ = `), r(1, `\bfunction \w+([.:]\w+)?\(`), r(1, `\bthen\b`), r(2, `~=`),
+		r(2, `\brequire\(?["']`), r(2, `\bpairs\(|\bipairs\(`),
+	},
+	"perl": {
+		r(4, `\bmy [$@%]\w+`), r(5, `^use strict;`), r(2, `\$_\b`), r(2, `=~ [sm]?/`), r(2, `^\s*sub \w+\s*\{`),
+	},
+}
+
+// fromHeuristics scores every language and picks the best one clearly
+// above the threshold
+func fromHeuristics(content string) Result {
+	type score struct {
+		lang  string
+		value float64
+	}
+	var scores []score
+	for lang, rules := range heuristics {
+		total := 0.0
+		for _, rl := range rules {
+			matches := len(rl.pattern.FindAllStringIndex(content, maxMatchesPerRule))
+			total += float64(matches) * rl.weight
+		}
+		if total > 0 {
+			scores = append(scores, score{lang, total})
+		}
+	}
+	if len(scores) == 0 {
+		return plaintext
+	}
+
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].value != scores[j].value {
+			return scores[i].value > scores[j].value
+		}
+		return scores[i].lang < scores[j].lang
+	})
+	best := scores[0]
+	if best.value < minScore {
+		return plaintext
+	}
+
+	second := 0.0
+	if len(scores) > 1 {
+		second = scores[1].value
+	}
+	return Result{
+		Language:   best.lang,
+		Confidence: best.value / (best.value + second),
+		Reason:     "heuristics",
+	}
+}
@@ -0,0 +1,53 @@
+package langdetect
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		filename string
+		language string
+		reason   string
+	}{
+		{"filename", "anything", "main.go", "go", "filename"},
+		{"filename alias", "anything", "Gemfile", "ruby", "filename"},
+		{"windows path", "anything", `C:\src\app.tsx`, "typescript", "filename"},
+		{"unknown extension", "", "notes.unknownext", "plaintext", "none"},
+		{"empty", "  \n ", "", "plaintext", "none"},
+		{"vim modeline", "x = 1\n# vim: set ft=python :\n", "", "python", "modeline"},
+		{"emacs modeline", "; -*- mode: lua -*-\nprint(1)\n", "", "lua", "modeline"},
+		{"shebang", "#!/bin/sh\nls\n", "", "bash", "shebang"},
+		{"env shebang", "#!/usr/bin/env -S python3.11 -u\nprint(1)\n", "", "python", "shebang"},
+		{"php", "<?php echo 1;", "", "php", "structure"},
+		{"html", "<!DOCTYPE html>\n<html></html>", "", "html", "structure"},
+		{"json", `{"a": [1, 2]}`, "", "json", "structure"},
+		{"broken json", `{"a": [1, 2}`, "", "plaintext", "none"},
+		{"go", "package main\n\nimport (\n\t\"fmt\"\n)\n\nfunc main() {\n\tfmt.Println(\"hi\")\n}\n", "", "go", "heuristics"},
+		{"python", "def greet(name):\n    print(name)\n\nif __name__ == '__main__':\n    greet('x')\n", "", "python", "heuristics"},
+		{"sql", "SELECT id, name FROM users WHERE id = 1;\n", "", "sql", "heuristics"},
+		{"prose", "Dear diary, today was a good day.\n", "", "plaintext", "none"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Detect(tt.content, tt.filename)
+			if got.Language != tt.language || got.Reason != tt.reason {
+				t.Errorf("Detect = %s by %s, want %s by %s", got.Language, got.Reason, tt.language, tt.reason)
+			}
+			if got.Confidence < 0 || got.Confidence > 1 {
+				t.Errorf("confidence %v out of range", got.Confidence)
+			}
+		})
+	}
+}
+
+func TestDetectScansHead(t *testing.T) {
+	// The evidence past maxScan is never seen
+	content := make([]byte, maxScan)
+	for i := range content {
+		content[i] = '\n'
+	}
+	if got := Detect(string(content)+"package main\nfunc main() {}\n", ""); got.Language != "plaintext" {
+		t.Errorf("Detect = %s, want plaintext", got.Language)
+	}
+}
@@ -1,13 +1,23 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
 	"patbin/config"
 	"patbin/database"
 	"patbin/handlers"
+	"patbin/janitor"
 	"patbin/middleware"
+	"patbin/models"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -18,9 +28,27 @@ func main() {
 	if err := database.Init(cfg.DBPath); err != nil {
 		log.Fatal("Database init failed:", err)
 	}
+	if err := database.InitStorage(cfg); err != nil {
+		log.Fatal("Storage init failed:", err)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate-storage" {
+		migrateStorage(cfg, os.Args[2:])
+		return
+	}
+	if n, err := database.BackfillSearch(context.Background(), cfg.SweepBatchSize); err != nil {
+		log.Fatal("Search index backfill failed:", err)
+	} else if n > 0 {
+		log.Printf("Indexed %d pastes for search", n)
+	}
 
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.Default()
+	// Client IPs key the rate limits, so forwarded headers only count from
+	// known proxies
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
 
 	r.SetFuncMap(template.FuncMap{
 		"timeAgo": func(t time.Time) string {
@@ -40,6 +68,8 @@ func main() {
 		},
 		"formatTime": func(t time.Time) string { return t.Format("Jan 2, 2006 at 3:04 PM") },
 		"add":        func(a, b int) int { return a + b },
+		"snippet":    handlers.SnippetHTML,
+		"pathEscape": url.PathEscape,
 		"iterate": func(n int) []int {
 			r := make([]int, n)
 			for i := range r {
@@ -51,40 +81,118 @@ func main() {
 
 	r.LoadHTMLGlob("templates/*")
 	r.Static("/static", "./static")
-	r.Use(middleware.AuthMiddleware(cfg))
+	r.Use(middleware.AuthMiddleware(cfg), middleware.CSRF(cfg))
 
 	authHandler := handlers.NewAuthHandler(cfg)
-	pasteHandler := handlers.NewPasteHandler()
+	pasteHandler := handlers.NewPasteHandler(cfg)
 	userHandler := handlers.NewUserHandler()
+	tokenHandler := handlers.NewTokenHandler()
+	collectionHandler := handlers.NewCollectionHandler()
+	orgHandler := handlers.NewOrgHandler()
+
+	// Budgets for the endpoints worth hammering
+	createLimit := middleware.RateLimit(middleware.NewRateLimiter(cfg.RateCreateAnon), middleware.NewRateLimiter(cfg.RateCreateUser))
+	loginLimiter := middleware.NewRateLimiter(cfg.RateLogin)
+	loginLimit := middleware.RateLimit(loginLimiter, loginLimiter)
+	rawLimiter := middleware.NewRateLimiter(cfg.RateRaw)
+	rawLimit := middleware.RateLimit(rawLimiter, rawLimiter)
+	diffLimiter := middleware.NewRateLimiter(cfg.RateDiff)
+	diffLimit := middleware.RateLimit(diffLimiter, diffLimiter)
 
 	r.GET("/", pasteHandler.HomePage)
+	r.POST("/", middleware.RequireScope(models.ScopePasteWrite), createLimit, pasteHandler.CreatePasteRaw)
 	r.GET("/login", authHandler.LoginPage)
 	r.GET("/register", authHandler.RegisterPage)
 
 	api := r.Group("/api")
 	{
-		api.POST("/auth/register", authHandler.Register)
-		api.POST("/auth/login", authHandler.Login)
+		api.POST("/auth/register", loginLimit, authHandler.Register)
+		api.POST("/auth/login", loginLimit, authHandler.Login)
 		api.POST("/auth/logout", authHandler.Logout)
-		api.GET("/auth/me", authHandler.GetCurrentUser)
-		api.POST("/paste", pasteHandler.CreatePaste)
-		api.GET("/paste/:id", pasteHandler.GetPaste)
-		api.PUT("/paste/:id", middleware.RequireAuth(), pasteHandler.UpdatePaste)
-		api.DELETE("/paste/:id", middleware.RequireAuth(), pasteHandler.DeletePaste)
-		api.POST("/paste/:id/fork", pasteHandler.ForkPaste)
+		api.POST("/auth/refresh", authHandler.Refresh)
+		api.GET("/sessions", middleware.RequireSession(), middleware.RequireAuth(), authHandler.ListSessions)
+		api.DELETE("/sessions", middleware.RequireSession(), middleware.RequireAuth(), authHandler.RevokeAllSessions)
+		api.DELETE("/sessions/:id", middleware.RequireSession(), middleware.RequireAuth(), authHandler.RevokeSession)
+		api.GET("/auth/me", middleware.AllowTokens(), authHandler.GetCurrentUser)
+		api.GET("/tokens", middleware.RequireSession(), middleware.RequireAuth(), tokenHandler.ListTokens)
+		api.POST("/tokens", middleware.RequireSession(), middleware.RequireAuth(), tokenHandler.CreateToken)
+		api.DELETE("/tokens/:id", middleware.RequireSession(), middleware.RequireAuth(), tokenHandler.RevokeToken)
+		api.POST("/paste", middleware.RequireScope(models.ScopePasteWrite), createLimit, pasteHandler.CreatePaste)
+		api.GET("/paste/:id", middleware.RequireScope(models.ScopePasteRead), pasteHandler.GetPaste)
+		api.PUT("/paste/:id", middleware.RequireScope(models.ScopePasteWrite), middleware.RequireAuth(), pasteHandler.UpdatePaste)
+		api.GET("/paste/:id/edit", middleware.RequireScope(models.ScopePasteWrite), middleware.RequireAuth(), pasteHandler.GetEditablePaste)
+		api.DELETE("/paste/:id", middleware.RequireScope(models.ScopePasteDelete), middleware.RequireAuth(), pasteHandler.DeletePaste)
+		api.POST("/paste/:id/fork", middleware.RequireScope(models.ScopePasteWrite), createLimit, pasteHandler.ForkPaste)
+		api.GET("/paste/:id/revisions", middleware.RequireScope(models.ScopePasteRead), pasteHandler.ListRevisions)
+		api.GET("/paste/:id/revisions/:n", middleware.RequireScope(models.ScopePasteRead), pasteHandler.GetRevision)
+		api.GET("/paste/:id/diff", middleware.RequireScope(models.ScopePasteRead), diffLimit, pasteHandler.GetDiff)
+		api.GET("/paste/:id/forks", middleware.RequireScope(models.ScopePasteRead), pasteHandler.ListForks)
+		api.GET("/paste/:id/comments", middleware.RequireScope(models.ScopePasteRead), pasteHandler.ListComments)
+		api.POST("/paste/:id/comments", middleware.RequireScope(models.ScopePasteWrite), middleware.RequireAuth(), createLimit, pasteHandler.CreateComment)
+		api.PUT("/paste/:id/comments/:cid", middleware.RequireScope(models.ScopePasteWrite), middleware.RequireAuth(), pasteHandler.ResolveComment)
+		api.DELETE("/paste/:id/comments/:cid", middleware.RequireScope(models.ScopePasteWrite), middleware.RequireAuth(), pasteHandler.DeleteComment)
+		api.POST("/paste/:id/star", middleware.RequireScope(models.ScopePasteWrite), middleware.RequireAuth(), pasteHandler.StarPaste)
+		api.DELETE("/paste/:id/star", middleware.RequireScope(models.ScopePasteWrite), middleware.RequireAuth(), pasteHandler.UnstarPaste)
 		api.GET("/pastes/recent", pasteHandler.RecentPastes)
+		api.GET("/search", middleware.RequireScope(models.ScopePasteRead), pasteHandler.Search)
+		api.POST("/highlight", pasteHandler.Highlight)
+		api.POST("/detect-language", pasteHandler.DetectLanguage)
 		api.GET("/user/:username", userHandler.GetUserProfile)
-		api.GET("/dashboard", middleware.RequireAuth(), userHandler.GetDashboard)
+		api.GET("/dashboard", middleware.RequireScope(models.ScopePasteRead), middleware.RequireAuth(), userHandler.GetDashboard)
+		api.GET("/tags", middleware.RequireScope(models.ScopePasteRead), middleware.RequireAuth(), collectionHandler.ListTags)
+		api.GET("/collections", middleware.RequireScope(models.ScopePasteRead), middleware.RequireAuth(), collectionHandler.ListCollections)
+		api.POST("/collections", middleware.RequireScope(models.ScopePasteWrite), middleware.RequireAuth(), collectionHandler.CreateCollection)
+		api.PUT("/collections/:id", middleware.RequireScope(models.ScopePasteWrite), middleware.RequireAuth(), collectionHandler.UpdateCollection)
+		api.DELETE("/collections/:id", middleware.RequireScope(models.ScopePasteWrite), middleware.RequireAuth(), collectionHandler.DeleteCollection)
+		api.GET("/orgs", middleware.RequireScope(models.ScopePasteRead), middleware.RequireAuth(), orgHandler.ListOrgs)
+		api.POST("/orgs", middleware.RequireScope(models.ScopePasteWrite), middleware.RequireAuth(), orgHandler.CreateOrg)
+		api.GET("/org/:org", middleware.RequireScope(models.ScopePasteRead), orgHandler.GetOrg)
+		api.PUT("/org/:org/members/:username", middleware.RequireScope(models.ScopePasteWrite), middleware.RequireAuth(), orgHandler.SetMember)
+		api.DELETE("/org/:org/members/:username", middleware.RequireScope(models.ScopePasteWrite), middleware.RequireAuth(), orgHandler.RemoveMember)
 	}
 
-	r.GET("/dashboard", middleware.RequireAuth(), userHandler.GetDashboardPage)
-	r.GET("/u/:username", userHandler.GetUserProfilePage)
-	r.GET("/:id/edit", middleware.RequireAuth(), pasteHandler.EditPastePage)
-	r.GET("/:id/raw", pasteHandler.GetRawPaste)
-	r.GET("/:id", pasteHandler.ViewPastePage)
+	r.GET("/dashboard", middleware.RequireScope(models.ScopePasteRead), middleware.RequireAuth(), userHandler.GetDashboardPage)
+	r.GET("/dashboard/sessions", middleware.RequireSession(), middleware.RequireAuth(), authHandler.SessionsPage)
+	r.GET("/u/:username", middleware.RequireScope(models.ScopePasteRead), userHandler.GetUserProfilePage)
+	r.GET("/u/:username/tag/:tag", middleware.RequireScope(models.ScopePasteRead), userHandler.GetUserProfilePage)
+	r.GET("/o/:org", middleware.RequireScope(models.ScopePasteRead), orgHandler.GetOrgPage)
+	r.GET("/:id/edit", middleware.RequireScope(models.ScopePasteWrite), middleware.RequireAuth(), pasteHandler.EditPastePage)
+	r.GET("/:id/raw", middleware.RequireScope(models.ScopePasteRead), rawLimit, pasteHandler.GetRawPaste)
+	r.GET("/:id/raw/:filename", middleware.RequireScope(models.ScopePasteRead), rawLimit, pasteHandler.GetRawFile)
+	r.GET("/:id/zip", middleware.RequireScope(models.ScopePasteRead), rawLimit, pasteHandler.DownloadZip)
+	r.GET("/:id/rev/:n", middleware.RequireScope(models.ScopePasteRead), pasteHandler.ViewRevisionPage)
+	r.GET("/:id/rev/:n/raw", middleware.RequireScope(models.ScopePasteRead), rawLimit, pasteHandler.GetRawRevision)
+	r.GET("/:id/diff", middleware.RequireScope(models.ScopePasteRead), diffLimit, pasteHandler.DiffPage)
+	r.GET("/:id", middleware.RequireScope(models.ScopePasteRead), pasteHandler.ViewPastePage)
+	r.POST("/:id", middleware.RequireScope(models.ScopePasteRead), middleware.RequireScope(models.ScopePasteWrite), pasteHandler.RevealPaste)
+	r.POST("/:id/unlock", middleware.RequireScope(models.ScopePasteRead), pasteHandler.UnlockPaste)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Purge expired and burned pastes in the background
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		janitor.New(database.DB, cfg.SweepInterval, cfg.SweepBatchSize).Run(ctx)
+	}()
+
+	srv := &http.Server{Addr: ":" + cfg.Port, Handler: r}
+	go func() {
+		log.Printf("🚀 Patbin running on http://localhost:%s", cfg.Port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Server failed:", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down...")
 
-	log.Printf("🚀 Patbin running on http://localhost:%s", cfg.Port)
-	if err := r.Run(":" + cfg.Port); err != nil {
-		log.Fatal("Server failed:", err)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Println("Server shutdown failed:", err)
 	}
+	wg.Wait()
 }
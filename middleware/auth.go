@@ -15,7 +15,9 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
-// AuthMiddleware validates JWT token and sets user info in context
+// AuthMiddleware validates the session access token, refreshing it from the
+// refresh cookie when needed, or the personal API token and sets user info
+// in context
 func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Try to get token from cookie first
@@ -28,26 +30,37 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 			}
 		}
 
-		if tokenString == "" {
+		// Personal API tokens rather than a session
+		if strings.HasPrefix(tokenString, TokenPrefix) {
+			if !authenticateToken(c, tokenString) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired API token"})
+				c.Abort()
+				return
+			}
 			c.Next()
 			return
 		}
 
-		// Parse and validate token
-		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(cfg.JWTSecret), nil
-		})
-
-		if err != nil || !token.Valid {
+		if tokenString != "" && authenticateSession(c, cfg, tokenString) {
 			c.Next()
 			return
 		}
 
-		// Set user info in context
-		c.Set("user_id", claims.UserID)
-		c.Set("username", claims.Username)
-		c.Set("authenticated", true)
+		// Browsers whose access token ran out renew it with their refresh
+		// cookie
+		if refresh, err := c.Cookie(cfg.RefreshCookieName); err == nil && refresh != "" {
+			tokens, err := RefreshSession(c, cfg, refresh)
+			if err != nil {
+				ClearSessionCookies(c, cfg)
+				c.Next()
+				return
+			}
+			SetSessionCookies(c, cfg, tokens)
+			c.Set("user_id", tokens.Session.UserID)
+			c.Set("username", tokens.Session.User.Username)
+			c.Set("authenticated", true)
+			c.Set("session_id", tokens.Session.ID)
+		}
 
 		c.Next()
 	}
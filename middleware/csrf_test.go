@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"patbin/config"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var csrfToken = strings.Repeat("ab", 32)
+
+func TestCSRF(t *testing.T) {
+	cfg := &config.Config{CookieName: "patbin_token", RefreshCookieName: "patbin_refresh", SessionTTL: time.Hour}
+	session := &http.Cookie{Name: cfg.CookieName, Value: "jwt"}
+	csrf := &http.Cookie{Name: CSRFCookieName, Value: csrfToken}
+
+	tests := []struct {
+		name    string
+		method  string
+		cookies []*http.Cookie
+		headers map[string]string
+		form    string
+		status  int
+	}{
+		{"safe method", http.MethodGet, []*http.Cookie{session}, nil, "", http.StatusOK},
+		{"no session cookie", http.MethodPost, nil, nil, "", http.StatusOK},
+		{"bearer token", http.MethodPost, []*http.Cookie{session}, map[string]string{"Authorization": "Bearer pbt_x"}, "", http.StatusOK},
+		{"missing token", http.MethodPost, []*http.Cookie{session, csrf}, nil, "", http.StatusForbidden},
+		{"wrong token", http.MethodPost, []*http.Cookie{session, csrf}, map[string]string{"X-CSRF-Token": strings.Repeat("cd", 32)}, "", http.StatusForbidden},
+		{"header token", http.MethodPost, []*http.Cookie{session, csrf}, map[string]string{"X-CSRF-Token": csrfToken}, "", http.StatusOK},
+		{"form token", http.MethodPost, []*http.Cookie{session, csrf}, map[string]string{"Content-Type": "application/x-www-form-urlencoded"}, "_csrf=" + csrfToken, http.StatusOK},
+		{"refresh cookie only", http.MethodDelete, []*http.Cookie{{Name: cfg.RefreshCookieName, Value: "r"}, csrf}, nil, "", http.StatusForbidden},
+		{"same origin", http.MethodPost, []*http.Cookie{session, csrf}, map[string]string{"X-CSRF-Token": csrfToken, "Origin": "http://example.com"}, "", http.StatusOK},
+		{"cross origin", http.MethodPost, []*http.Cookie{session, csrf}, map[string]string{"X-CSRF-Token": csrfToken, "Origin": "http://evil.test"}, "", http.StatusForbidden},
+		{"cross-site referer", http.MethodPost, []*http.Cookie{session, csrf}, map[string]string{"X-CSRF-Token": csrfToken, "Referer": "http://evil.test/page"}, "", http.StatusForbidden},
+		// A fresh token is issued, so the one sent can't match
+		{"no csrf cookie", http.MethodPost, []*http.Cookie{session}, map[string]string{"X-CSRF-Token": csrfToken}, "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(CSRF(cfg))
+			r.Handle(tt.method, "/api/paste", func(c *gin.Context) { c.String(http.StatusOK, CSRFToken(c)) })
+
+			req := httptest.NewRequest(tt.method, "http://example.com/api/paste", strings.NewReader(tt.form))
+			for _, cookie := range tt.cookies {
+				req.AddCookie(cookie)
+			}
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
+
+func TestCSRFIssuesToken(t *testing.T) {
+	r := gin.New()
+	r.Use(CSRF(&config.Config{SessionTTL: time.Hour}))
+	r.GET("/", func(c *gin.Context) { c.String(http.StatusOK, CSRFToken(c)) })
+
+	w := serve(r, "/")
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != CSRFCookieName || len(cookies[0].Value) != 64 {
+		t.Fatalf("cookies = %v, want a new %s", cookies, CSRFCookieName)
+	}
+	if w.Body.String() != cookies[0].Value {
+		t.Error("CSRFToken should return the issued token")
+	}
+
+	// An existing token is kept
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: CSRFCookieName, Value: csrfToken})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if len(w.Result().Cookies()) != 0 || w.Body.String() != csrfToken {
+		t.Error("a valid token shouldn't be replaced")
+	}
+}
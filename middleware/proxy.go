@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FromTrustedProxy reports whether the request was made by one of proxies,
+// addresses or CIDRs as in config.TrustedProxies, so that the forwarded
+// headers it sets can be believed
+func FromTrustedProxy(c *gin.Context, proxies []string) bool {
+	remote := net.ParseIP(c.RemoteIP())
+	if remote == nil {
+		return false
+	}
+	for _, p := range proxies {
+		if strings.Contains(p, "/") {
+			if _, cidr, err := net.ParseCIDR(p); err == nil && cidr.Contains(remote) {
+				return true
+			}
+		} else if ip := net.ParseIP(p); ip != nil && ip.Equal(remote) {
+			return true
+		}
+	}
+	return false
+}
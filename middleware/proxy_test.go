@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestFromTrustedProxy(t *testing.T) {
+	proxies := []string{"10.0.0.1", "192.168.0.0/16", "::1"}
+	tests := []struct {
+		remote string
+		want   bool
+	}{
+		{"10.0.0.1:4000", true},
+		{"10.0.0.2:4000", false},
+		{"192.168.4.2:4000", true},
+		{"[::1]:4000", true},
+		{"203.0.113.7:4000", false},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		c.Request.RemoteAddr = tt.remote
+		if got := FromTrustedProxy(c, proxies); got != tt.want {
+			t.Errorf("FromTrustedProxy(%s) = %v, want %v", tt.remote, got, tt.want)
+		}
+		if FromTrustedProxy(c, nil) {
+			t.Errorf("%s trusted without any proxies", tt.remote)
+		}
+	}
+}
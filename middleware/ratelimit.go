@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"patbin/config"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimiter hands out requests from a token bucket per key
+type RateLimiter struct {
+	rate config.Rate
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a limiter for rate, or nil when rate doesn't limit
+func NewRateLimiter(rate config.Rate) *RateLimiter {
+	if rate.Requests <= 0 || rate.Per <= 0 {
+		return nil
+	}
+	return &RateLimiter{rate: rate, buckets: make(map[string]*bucket)}
+}
+
+// perToken is how long the bucket takes to regain one request
+func (l *RateLimiter) perToken() time.Duration {
+	return l.rate.Per / time.Duration(l.rate.Requests)
+}
+
+// take claims a request for key. It returns the requests left, how long
+// until the bucket is full again and, when the request may not go ahead,
+// how long until it could.
+func (l *RateLimiter) take(key string, now time.Time) (remaining int, reset, retry time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	capacity := float64(l.rate.Requests)
+	refill := func(b *bucket) float64 {
+		return math.Min(capacity, b.tokens+float64(now.Sub(b.last))/float64(l.perToken()))
+	}
+
+	// Forget buckets that have filled up again once the map gets big
+	if len(l.buckets) > 4096 {
+		for k, b := range l.buckets {
+			if refill(b) >= capacity {
+				delete(l.buckets, k)
+			}
+		}
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = refill(b)
+	b.last = now
+
+	if b.tokens < 1 {
+		retry = time.Duration((1 - b.tokens) * float64(l.perToken()))
+	} else {
+		b.tokens--
+	}
+	return int(b.tokens), time.Duration((capacity - b.tokens) * float64(l.perToken())), retry
+}
+
+// seconds rounds d up to whole seconds for a header
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// RateLimit limits anonymous requests per IP with anon and logged-in ones
+// per user with user. A nil limiter lets its requests through.
+func RateLimit(anon, user *RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limiter, key := anon, "ip:"+c.ClientIP()
+		if userID, ok := GetUserID(c); ok {
+			limiter, key = user, "user:"+strconv.FormatUint(uint64(userID), 10)
+		}
+		if limiter == nil {
+			c.Next()
+			return
+		}
+
+		remaining, reset, retry := limiter.take(key, time.Now())
+		c.Header("X-RateLimit-Limit", strconv.Itoa(limiter.rate.Requests))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		c.Header("X-RateLimit-Reset", seconds(reset))
+		if retry == 0 {
+			c.Next()
+			return
+		}
+
+		c.Header("Retry-After", seconds(retry))
+		message := "Too many requests, try again in " + seconds(retry) + "s"
+		if strings.HasPrefix(c.Request.URL.Path, "/api/") {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": message})
+		} else {
+			c.String(http.StatusTooManyRequests, message+"\n")
+		}
+		c.Abort()
+	}
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"patbin/config"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTake(t *testing.T) {
+	l := NewRateLimiter(config.Rate{Requests: 2, Per: time.Second})
+	now := time.Unix(1700000000, 0)
+
+	for i, want := range []int{1, 0} {
+		remaining, _, retry := l.take("k", now)
+		if retry != 0 || remaining != want {
+			t.Fatalf("request %d: remaining %d, retry %v; want %d, 0", i+1, remaining, retry, want)
+		}
+	}
+	if _, _, retry := l.take("k", now); retry != 500*time.Millisecond {
+		t.Fatalf("empty bucket: retry %v, want 500ms", retry)
+	}
+	if _, _, retry := l.take("other", now); retry != 0 {
+		t.Fatal("keys should have their own buckets")
+	}
+
+	// Half a second refills one request
+	if _, _, retry := l.take("k", now.Add(500*time.Millisecond)); retry != 0 {
+		t.Fatalf("refilled bucket: retry %v, want 0", retry)
+	}
+	if _, reset, _ := l.take("k", now.Add(time.Hour)); reset != 500*time.Millisecond {
+		t.Errorf("reset %v, want 500ms", reset)
+	}
+}
+
+func TestNewRateLimiterOff(t *testing.T) {
+	if NewRateLimiter(config.Rate{}) != nil {
+		t.Error("a zero rate should not limit")
+	}
+}
+
+// limited serves a route behind RateLimit allowing two requests a minute
+func limited(proxies []string, auth gin.HandlerFunc) *gin.Engine {
+	r := gin.New()
+	if err := r.SetTrustedProxies(proxies); err != nil {
+		panic(err)
+	}
+	rate := config.Rate{Requests: 2, Per: time.Minute}
+	r.POST("/api/paste", auth, RateLimit(NewRateLimiter(rate), NewRateLimiter(rate)), func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+	return r
+}
+
+func post(r *gin.Engine, remote, forwardedFor string) int {
+	req := httptest.NewRequest(http.MethodPost, "/api/paste", nil)
+	req.RemoteAddr = remote
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	r := limited(nil, func(c *gin.Context) {})
+	codes := make([]int, 3)
+	for i := range codes {
+		codes[i] = post(r, "203.0.113.7:4000", "198.51.100."+strconv.Itoa(i))
+	}
+	if codes[0] != http.StatusCreated || codes[1] != http.StatusCreated || codes[2] != http.StatusTooManyRequests {
+		t.Errorf("codes %v, want the third request limited", codes)
+	}
+}
+
+func TestRateLimitTrustedProxy(t *testing.T) {
+	r := limited([]string{"10.0.0.1"}, func(c *gin.Context) {})
+	for i := 0; i < 3; i++ {
+		if code := post(r, "10.0.0.1:4000", "198.51.100."+strconv.Itoa(i)); code != http.StatusCreated {
+			t.Fatalf("client %d behind the proxy: %d, want %d", i, code, http.StatusCreated)
+		}
+	}
+	post(r, "10.0.0.1:4000", "198.51.100.0")
+	if code := post(r, "10.0.0.1:4000", "198.51.100.0"); code != http.StatusTooManyRequests {
+		t.Errorf("third request of one client: %d, want %d", code, http.StatusTooManyRequests)
+	}
+}
+
+func TestRateLimitPerUser(t *testing.T) {
+	user := 1
+	r := limited(nil, func(c *gin.Context) { c.Set("user_id", uint(user)) })
+	post(r, "203.0.113.7:4000", "")
+	post(r, "203.0.113.7:4000", "")
+	if code := post(r, "203.0.113.7:4000", ""); code != http.StatusTooManyRequests {
+		t.Fatalf("third request of a user: %d, want %d", code, http.StatusTooManyRequests)
+	}
+	user = 2
+	if code := post(r, "203.0.113.7:4000", ""); code != http.StatusCreated {
+		t.Errorf("another user on the same IP: %d, want %d", code, http.StatusCreated)
+	}
+}
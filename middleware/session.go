@@ -0,0 +1,218 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"patbin/config"
+	"patbin/database"
+	"patbin/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// refreshGrace is how long a replaced refresh token is still accepted, for
+// requests that raced the one that replaced it. They get an access token
+// but no new refresh token.
+const refreshGrace = 30 * time.Second
+
+var (
+	ErrInvalidRefresh = errors.New("invalid or expired refresh token")
+	ErrRefreshReused  = errors.New("refresh token reused, session revoked")
+)
+
+// SessionTokens are the tokens handed out for a session
+type SessionTokens struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int    `json:"expires_in"`
+
+	Session *models.Session `json:"-"`
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// truncate keeps request metadata within its column
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// StartSession records a new session for user and returns its first tokens
+func StartSession(c *gin.Context, cfg *config.Config, user *models.User) (*SessionTokens, error) {
+	id, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		ID:          id,
+		UserID:      user.ID,
+		RefreshHash: HashToken(refresh),
+		RotatedAt:   now,
+		IP:          truncate(c.ClientIP(), 64),
+		UserAgent:   truncate(c.Request.UserAgent(), 255),
+		LastSeenAt:  now,
+		ExpiresAt:   now.Add(cfg.SessionTTL),
+		CreatedAt:   now,
+	}
+	if err := database.DB.Create(&session).Error; err != nil {
+		return nil, err
+	}
+
+	session.User = user
+	return issueTokens(cfg, &session, refresh)
+}
+
+// RefreshSession exchanges a refresh token for a new access token and a new
+// refresh token. A refresh token that was already replaced ends the session:
+// either it leaked or the client is broken.
+func RefreshSession(c *gin.Context, cfg *config.Config, refresh string) (*SessionTokens, error) {
+	hash := HashToken(refresh)
+	now := time.Now()
+
+	var session models.Session
+	err := database.DB.Preload("User").
+		Where("refresh_hash = ? OR prev_refresh_hash = ?", hash, hash).
+		First(&session).Error
+	if err != nil || session.User == nil {
+		return nil, ErrInvalidRefresh
+	}
+	if !session.ExpiresAt.After(now) {
+		database.DB.Delete(&session)
+		return nil, ErrInvalidRefresh
+	}
+
+	if session.RefreshHash != hash {
+		if now.Sub(session.RotatedAt) > refreshGrace {
+			database.DB.Delete(&session)
+			return nil, ErrRefreshReused
+		}
+		return issueTokens(cfg, &session, "")
+	}
+
+	next, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+	result := database.DB.Model(&models.Session{}).
+		Where("id = ? AND refresh_hash = ?", session.ID, hash).
+		UpdateColumns(map[string]interface{}{
+			"refresh_hash":      HashToken(next),
+			"prev_refresh_hash": hash,
+			"rotated_at":        now,
+			"ip":                truncate(c.ClientIP(), 64),
+			"user_agent":        truncate(c.Request.UserAgent(), 255),
+			"last_seen_at":      now,
+			"expires_at":        now.Add(cfg.SessionTTL),
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		// Another request rotated it first
+		next = ""
+	}
+
+	return issueTokens(cfg, &session, next)
+}
+
+// issueTokens signs an access token for session, passing refresh along.
+// session.User must be loaded.
+func issueTokens(cfg *config.Config, session *models.Session, refresh string) (*SessionTokens, error) {
+	now := time.Now()
+	claims := &Claims{
+		UserID:   session.UserID,
+		Username: session.User.Username,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        session.ID,
+			ExpiresAt: jwt.NewNumericDate(now.Add(cfg.AccessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	access, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(cfg.JWTSecret))
+	if err != nil {
+		return nil, err
+	}
+	return &SessionTokens{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresIn:    int(cfg.AccessTokenTTL / time.Second),
+		Session:      session,
+	}, nil
+}
+
+// SetSessionCookies stores the tokens of a session in the browser. The
+// refresh cookie is left alone when there's no new refresh token.
+func SetSessionCookies(c *gin.Context, cfg *config.Config, tokens *SessionTokens) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(cfg.CookieName, tokens.AccessToken, int(cfg.AccessTokenTTL/time.Second), "/", "", false, true)
+	if tokens.RefreshToken != "" {
+		c.SetCookie(cfg.RefreshCookieName, tokens.RefreshToken, int(cfg.SessionTTL/time.Second), "/", "", false, true)
+	}
+}
+
+// ClearSessionCookies logs the browser out
+func ClearSessionCookies(c *gin.Context, cfg *config.Config) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(cfg.CookieName, "", -1, "/", "", false, true)
+	c.SetCookie(cfg.RefreshCookieName, "", -1, "/", "", false, true)
+}
+
+// authenticateSession sets the user of a valid access token whose session
+// hasn't been revoked
+func authenticateSession(c *gin.Context, cfg *config.Config, tokenString string) bool {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(cfg.JWTSecret), nil
+	})
+	if err != nil || !token.Valid || claims.ID == "" {
+		return false
+	}
+
+	var session models.Session
+	err = database.DB.Select("id", "user_id", "last_seen_at", "expires_at").
+		Where("id = ? AND user_id = ?", claims.ID, claims.UserID).
+		First(&session).Error
+	now := time.Now()
+	if err != nil || !session.ExpiresAt.After(now) {
+		return false
+	}
+
+	// Recording every single request would cost a write per request
+	if now.Sub(session.LastSeenAt) > time.Minute {
+		database.DB.Model(&session).UpdateColumn("last_seen_at", now)
+	}
+
+	c.Set("user_id", claims.UserID)
+	c.Set("username", claims.Username)
+	c.Set("authenticated", true)
+	c.Set("session_id", session.ID)
+	return true
+}
+
+// GetSessionID returns the ID of the session the request was made in
+func GetSessionID(c *gin.Context) (string, bool) {
+	id, exists := c.Get("session_id")
+	if !exists {
+		return "", false
+	}
+	return id.(string), true
+}
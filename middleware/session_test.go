@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"errors"
+	"net/http/httptest"
+	"patbin/config"
+	"patbin/database"
+	"patbin/models"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSessionRefresh(t *testing.T) {
+	if err := database.Init(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{JWTSecret: "secret", AccessTokenTTL: time.Minute, SessionTTL: time.Hour}
+	user := models.User{Username: "alice", Password: "x"}
+	if err := database.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/api/auth/refresh", nil)
+
+	first, err := StartSession(c, cfg, &user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !authenticateSession(c, cfg, first.AccessToken) {
+		t.Fatal("a fresh access token should authenticate")
+	}
+
+	second, err := RefreshSession(c, cfg, first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.RefreshToken == "" || second.RefreshToken == first.RefreshToken {
+		t.Fatal("refreshing should rotate the refresh token")
+	}
+
+	// A request that raced the rotation still gets in, without a new token
+	raced, err := RefreshSession(c, cfg, first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raced.RefreshToken != "" || raced.AccessToken == "" {
+		t.Errorf("raced refresh = %+v, want an access token only", raced)
+	}
+
+	// Past the grace period the old token gives the session away
+	database.DB.Model(&models.Session{}).Where("id = ?", second.Session.ID).
+		UpdateColumn("rotated_at", time.Now().Add(-2*refreshGrace))
+	if _, err := RefreshSession(c, cfg, first.RefreshToken); !errors.Is(err, ErrRefreshReused) {
+		t.Fatalf("reused refresh token: %v, want ErrRefreshReused", err)
+	}
+	if _, err := RefreshSession(c, cfg, second.RefreshToken); !errors.Is(err, ErrInvalidRefresh) {
+		t.Errorf("refresh after revocation: %v, want ErrInvalidRefresh", err)
+	}
+	if authenticateSession(c, cfg, second.AccessToken) {
+		t.Error("access tokens of a revoked session should be refused")
+	}
+
+	if _, err := RefreshSession(c, cfg, "nonsense"); !errors.Is(err, ErrInvalidRefresh) {
+		t.Errorf("unknown refresh token: %v, want ErrInvalidRefresh", err)
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	if err := database.Init(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{JWTSecret: "secret", AccessTokenTTL: time.Minute, SessionTTL: time.Hour}
+	user := models.User{Username: "bob", Password: "x"}
+	database.DB.Create(&user)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/", nil)
+
+	tokens, err := StartSession(c, cfg, &user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A token signed with another secret is refused outright
+	other := *cfg
+	other.JWTSecret = "other"
+	if authenticateSession(c, &other, tokens.AccessToken) {
+		t.Error("a token with a bad signature should not authenticate")
+	}
+
+	database.DB.Model(&models.Session{}).Where("id = ?", tokens.Session.ID).
+		UpdateColumn("expires_at", time.Now().Add(-time.Second))
+
+	if authenticateSession(c, cfg, tokens.AccessToken) {
+		t.Error("an expired session should not authenticate")
+	}
+	if _, err := RefreshSession(c, cfg, tokens.RefreshToken); !errors.Is(err, ErrInvalidRefresh) {
+		t.Errorf("refresh of an expired session: %v, want ErrInvalidRefresh", err)
+	}
+}
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"patbin/database"
+	"patbin/models"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TokenPrefix starts every personal API token, which makes them easy to
+// tell from session JWTs and to spot in logs and secret scanners
+const TokenPrefix = "pbt_"
+
+// HashToken returns the hash a personal API token is stored and looked up by
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// authenticateToken checks a personal API token and keeps it in the context
+// for the route to let in. A token that is unknown, revoked or expired fails
+// the request rather than quietly turning it into an anonymous one.
+func authenticateToken(c *gin.Context, token string) bool {
+	var t models.APIToken
+	if err := database.DB.Preload("User").Where("hash = ?", HashToken(token)).First(&t).Error; err != nil || t.User == nil {
+		return false
+	}
+	now := time.Now()
+	if t.ExpiresAt != nil && !t.ExpiresAt.After(now) {
+		return false
+	}
+
+	// Recording every single use would cost a write per request
+	if t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) > time.Minute {
+		database.DB.Model(&t).UpdateColumn("last_used_at", now)
+	}
+
+	c.Set("token_user", t.User)
+	c.Set("token_scopes", strings.Fields(t.Scopes))
+	return true
+}
+
+// grantToken makes the user of the request's API token its user. Tokens
+// only count on routes that let them in with RequireScope or AllowTokens;
+// everywhere else their requests are anonymous.
+func grantToken(c *gin.Context) {
+	user, ok := c.Get("token_user")
+	if !ok {
+		return
+	}
+	c.Set("user_id", user.(*models.User).ID)
+	c.Set("username", user.(*models.User).Username)
+	c.Set("authenticated", true)
+}
+
+// HasScope reports whether the request may act with scope. Logged-in
+// sessions can do anything, API tokens only what they were granted.
+func HasScope(c *gin.Context, scope string) bool {
+	scopes, ok := c.Get("token_scopes")
+	if !ok {
+		return true
+	}
+	return slices.Contains(scopes.([]string), scope)
+}
+
+// RequireScope rejects requests made with an API token that lacks scope,
+// and lets in those with it. Anonymous requests pass; routes that need a
+// user add RequireAuth after it.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasScope(c, scope) {
+			message := "API token lacks the " + scope + " scope"
+			if strings.HasPrefix(c.Request.URL.Path, "/api/") {
+				c.JSON(http.StatusForbidden, gin.H{"error": message})
+			} else {
+				c.HTML(http.StatusForbidden, "error.html", gin.H{
+					"title":   "Forbidden - Patbin",
+					"message": message,
+					"code":    http.StatusForbidden,
+				})
+			}
+			c.Abort()
+			return
+		}
+		grantToken(c)
+		c.Next()
+	}
+}
+
+// AllowTokens lets in API tokens of any scope, for routes that only tell
+// who is calling
+func AllowTokens() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		grantToken(c)
+		c.Next()
+	}
+}
+
+// RequireSession rejects requests authenticated with an API token, for
+// routes such as token management that need a real login
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("token_scopes"); ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API tokens can't be used here"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"patbin/models"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// withToken stands in for authenticateToken, holding a token of user 7
+// with scopes
+func withToken(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("token_user", &models.User{ID: 7, Username: "alice"})
+		c.Set("token_scopes", scopes)
+	}
+}
+
+// whoami answers with the user the request ended up with, 0 for anonymous
+func whoami(c *gin.Context) {
+	userID, _ := GetUserID(c)
+	c.String(http.StatusOK, strconv.FormatUint(uint64(userID), 10))
+}
+
+func serve(r *gin.Engine, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestRequireScope(t *testing.T) {
+	tests := []struct {
+		name   string
+		auth   gin.HandlerFunc
+		route  []gin.HandlerFunc
+		status int
+		body   string
+	}{
+		{"session", func(c *gin.Context) { c.Set("user_id", uint(3)) }, []gin.HandlerFunc{RequireScope(models.ScopePasteRead)}, http.StatusOK, "3"},
+		{"anonymous", func(c *gin.Context) {}, []gin.HandlerFunc{RequireScope(models.ScopePasteRead)}, http.StatusOK, "0"},
+		{"token with scope", withToken(models.ScopePasteRead), []gin.HandlerFunc{RequireScope(models.ScopePasteRead)}, http.StatusOK, "7"},
+		{"token lacking scope", withToken(models.ScopePasteDelete), []gin.HandlerFunc{RequireScope(models.ScopePasteRead)}, http.StatusForbidden, ""},
+		{"token on every scope", withToken(models.ScopePasteRead), []gin.HandlerFunc{RequireScope(models.ScopePasteRead), RequireScope(models.ScopePasteWrite)}, http.StatusForbidden, ""},
+		{"token without scoped route", withToken(models.TokenScopes...), nil, http.StatusOK, "0"},
+		{"token allowed in", withToken(), []gin.HandlerFunc{AllowTokens()}, http.StatusOK, "7"},
+		{"token needing auth", withToken(models.ScopePasteDelete), []gin.HandlerFunc{RequireAuth()}, http.StatusUnauthorized, ""},
+		{"token refused session route", withToken(models.TokenScopes...), []gin.HandlerFunc{RequireSession(), RequireAuth()}, http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(tt.auth)
+			r.GET("/api/x", append(tt.route, whoami)...)
+
+			w := serve(r, "/api/x")
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.body != "" && w.Body.String() != tt.body {
+				t.Errorf("user = %s, want %s", w.Body.String(), tt.body)
+			}
+		})
+	}
+}
+
+func TestRequireScopePage(t *testing.T) {
+	r := gin.New()
+	r.SetHTMLTemplate(template.Must(template.New("error.html").Parse("{{.message}}")))
+	r.Use(withToken(models.ScopePasteDelete))
+	r.GET("/:id", RequireScope(models.ScopePasteRead), whoami)
+
+	w := serve(r, "/abc123")
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if want := "API token lacks the paste:read scope"; w.Body.String() != want {
+		t.Errorf("body = %q, want %q", w.Body.String(), want)
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	if !HasScope(c, models.ScopePasteDelete) {
+		t.Error("sessions should have every scope")
+	}
+	c.Set("token_scopes", []string{models.ScopePasteRead, models.ScopePasteWrite})
+	if !HasScope(c, models.ScopePasteWrite) {
+		t.Error("token should have paste:write")
+	}
+	if HasScope(c, models.ScopePasteDelete) {
+		t.Error("token shouldn't have paste:delete")
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"patbin/config"
+	"patbin/database"
+	"syscall"
+)
+
+// migrateStorage moves paste content between storage backends, storing
+// content from before blobs as blobs on the way:
+//
+//	patbin migrate-storage -from inline -to fs
+func migrateStorage(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("migrate-storage", flag.ExitOnError)
+	from := fs.String("from", "inline", "backend to move content out of (inline, db, fs, s3)")
+	to := fs.String("to", cfg.StorageBackend, "backend to move content into (inline, db, fs, s3)")
+	batch := fs.Int("batch", 100, "rows to load per batch")
+	fs.Parse(args)
+	if *batch < 1 {
+		log.Fatal("-batch must be at least 1")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("Moving paste content from %s to %s...", *from, *to)
+	moved, err := database.MigrateContent(ctx, *from, *to, *batch)
+	if err != nil {
+		log.Fatalf("Migration stopped after %d items: %v", moved, err)
+	}
+	log.Printf("Moved %d items", moved)
+	if *to != cfg.StorageBackend {
+		log.Printf("Set STORAGE_BACKEND=%s so new pastes are stored there too", *to)
+	}
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// Blob is a paste body stored once per distinct content, compressed, and
+// shared by every paste, revision and file with that content. RefCount
+// counts those rows; blobs nobody refers to any more are purged. A new
+// blob starts out inline, with Pending naming the backend it is copied to
+// once the transaction that created it has committed.
+type Blob struct {
+	Hash        string `gorm:"primaryKey;size:64"` // hex SHA-256 of the uncompressed content
+	Backend     string `gorm:"size:16;not null"`
+	Data        []byte // the stored bytes when Backend is inline
+	Compression string `gorm:"size:8;not null;default:''"`
+	Size        int    `gorm:"not null"`
+	StoredSize  int    `gorm:"not null"`
+	RefCount    int    `gorm:"not null;default:0;index"`
+	Pending     string `gorm:"size:16;not null;default:'';index"`
+	CreatedAt   time.Time
+}
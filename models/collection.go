@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// Collection is a named folder of pastes owned by a user. A paste is in at
+// most one collection, and always one of its owner's.
+type Collection struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UserID      uint      `gorm:"uniqueIndex:idx_user_collection;not null" json:"-"`
+	User        *User     `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	Name        string    `gorm:"size:100;uniqueIndex:idx_user_collection;not null" json:"name"`
+	Description string    `gorm:"size:500;not null;default:''" json:"description,omitempty"`
+	PasteCount  int64     `gorm:"-" json:"paste_count,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
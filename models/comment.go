@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// Comment is a remark on a range of lines in one revision of a paste. A
+// top-level comment starts a thread, which can be resolved; replies carry
+// the anchor of their thread.
+type Comment struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	PasteID   string    `gorm:"size:12;index;not null" json:"paste_id"`
+	ParentID  *uint     `gorm:"index" json:"parent_id,omitempty"`
+	Revision  int       `gorm:"not null" json:"revision"`
+	StartLine int       `gorm:"not null" json:"start_line"`
+	EndLine   int       `gorm:"not null" json:"end_line"`
+	UserID    uint      `gorm:"index;not null" json:"user_id"`
+	User      *User     `gorm:"constraint:OnDelete:CASCADE" json:"user,omitempty"`
+	Body      string    `gorm:"type:text;not null" json:"body"`
+	Resolved  bool      `gorm:"not null;default:false" json:"resolved"`
+	Replies   []Comment `gorm:"foreignKey:ParentID" json:"replies,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// PasteFile is one file of a multi-file paste. The file at position 0 is
+// mirrored in the paste's own Content and Language.
+type PasteFile struct {
+	ID          uint      `gorm:"primaryKey" json:"-"`
+	PasteID     string    `gorm:"size:12;uniqueIndex:idx_paste_file;not null" json:"-"`
+	Filename    string    `gorm:"size:255;uniqueIndex:idx_paste_file;not null" json:"filename"`
+	Language    string    `gorm:"size:50" json:"language"`
+	Content     string    `gorm:"type:text;not null" json:"content"`
+	ContentHash string    `gorm:"size:64;not null;default:'';index" json:"-"`
+	Position    int       `gorm:"not null" json:"position"`
+	CreatedAt   time.Time `json:"-"`
+	UpdatedAt   time.Time `json:"-"`
+}
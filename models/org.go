@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+)
+
+// Roles of organization members: owners manage the members, editors edit
+// the organization's pastes, and viewers read its private ones
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+var OrgRoles = []string{RoleOwner, RoleEditor, RoleViewer}
+
+// Org is an organization. The pastes it owns stay with it when the member
+// who created them leaves.
+type Org struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"uniqueIndex;size:50;not null" json:"name"`
+	Description string    `gorm:"size:500;not null;default:''" json:"description,omitempty"`
+	Role        string    `gorm:"-" json:"role,omitempty"` // of the current user, in their listing
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// OrgMember gives a user a role in an organization
+type OrgMember struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	OrgID     uint      `gorm:"uniqueIndex:idx_org_member;not null" json:"-"`
+	Org       *Org      `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	UserID    uint      `gorm:"uniqueIndex:idx_org_member;index;not null" json:"-"`
+	User      *User     `gorm:"constraint:OnDelete:CASCADE" json:"user,omitempty"`
+	Role      string    `gorm:"size:16;not null" json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -4,19 +4,45 @@ import (
 	"time"
 )
 
+// Who can see a paste: public pastes are listed and searchable, unlisted
+// ones only reachable by their link, and private ones only by their owner,
+// or the members of the organization owning them
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
+)
+
+var Visibilities = []string{VisibilityPublic, VisibilityUnlisted, VisibilityPrivate}
+
 type Paste struct {
-	ID            string     `gorm:"primaryKey;size:12" json:"id"`
-	Title         string     `gorm:"size:255" json:"title"`
-	Content       string     `gorm:"type:text;not null" json:"content"`
-	Language      string     `gorm:"size:50" json:"language"`
-	IsPublic      bool       `gorm:"default:true" json:"is_public"`
-	Views         int        `gorm:"default:0" json:"views"`
-	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
-	BurnAfterRead bool       `gorm:"default:false" json:"burn_after_read"`
-	UserID        *uint      `gorm:"index" json:"user_id,omitempty"`
-	User          *User      `gorm:"constraint:OnDelete:SET NULL" json:"user,omitempty"`
-	CreatedAt     time.Time  `json:"created_at"`
-	UpdatedAt     time.Time  `json:"updated_at"`
+	ID             string      `gorm:"primaryKey;size:12" json:"id"`
+	Title          string      `gorm:"size:255" json:"title"`
+	Content        string      `gorm:"type:text;not null" json:"content"`
+	ContentHash    string      `gorm:"size:64;not null;default:'';index" json:"-"` // blob holding the content
+	ContentBackend string      `gorm:"size:16;not null;default:''" json:"-"`       // legacy per-paste storage object
+	ContentKey     string      `gorm:"size:255;not null;default:''" json:"-"`
+	Language       string      `gorm:"size:50" json:"language"`
+	Encryption     string      `gorm:"size:32;not null;default:''" json:"encryption,omitempty"` // client-side cipher; Content is then ciphertext
+	Visibility     string      `gorm:"size:16;not null;default:'public';index" json:"visibility"`
+	Password       string      `gorm:"size:255;not null;default:''" json:"-"` // bcrypt hash, empty for no password
+	Views          int         `gorm:"default:0" json:"views"`
+	Stars          int         `gorm:"not null;default:0;index" json:"stars"`
+	ExpiresAt      *time.Time  `json:"expires_at,omitempty"`
+	BurnAfterRead  bool        `gorm:"default:false" json:"burn_after_read"`
+	Revision       int         `gorm:"default:1" json:"revision"`
+	ForkedFromID   *string     `gorm:"size:12;index" json:"forked_from_id,omitempty"`
+	ForkedFromRev  int         `json:"forked_from_rev,omitempty"`
+	UserID         *uint       `gorm:"index" json:"user_id,omitempty"`
+	User           *User       `gorm:"constraint:OnDelete:SET NULL" json:"user,omitempty"`
+	Files          []PasteFile `gorm:"foreignKey:PasteID" json:"files,omitempty"`
+	Tags           []Tag       `gorm:"many2many:paste_tags" json:"tags,omitempty"`
+	CollectionID   *uint       `gorm:"index" json:"collection_id,omitempty"`
+	Collection     *Collection `gorm:"constraint:OnDelete:SET NULL" json:"collection,omitempty"`
+	OrgID          *uint       `gorm:"index" json:"org_id,omitempty"` // owner instead of the user, who is then just the author
+	Org            *Org        `gorm:"constraint:OnDelete:SET NULL" json:"org,omitempty"`
+	CreatedAt      time.Time   `json:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at"`
 }
 
 // Language extension mappings
@@ -67,3 +93,17 @@ func GetLanguageFromExtension(ext string) string {
 	}
 	return "plaintext"
 }
+
+// GetExtensionFromLanguage returns the shortest extension for a language
+func GetExtensionFromLanguage(lang string) string {
+	best := ""
+	for ext, l := range LanguageExtensions {
+		if l == lang && (best == "" || len(ext) < len(best) || (len(ext) == len(best) && ext < best)) {
+			best = ext
+		}
+	}
+	if best == "" {
+		return "txt"
+	}
+	return best
+}
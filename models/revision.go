@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+)
+
+// PasteRevision is an immutable snapshot of a paste taken on every edit
+type PasteRevision struct {
+	ID          uint           `gorm:"primaryKey" json:"-"`
+	PasteID     string         `gorm:"size:12;uniqueIndex:idx_paste_revision;not null" json:"paste_id"`
+	Number      int            `gorm:"uniqueIndex:idx_paste_revision;not null" json:"number"`
+	Title       string         `gorm:"size:255" json:"title"`
+	Content     string         `gorm:"type:text;not null" json:"content,omitempty"`
+	ContentHash string         `gorm:"size:64;not null;default:'';index" json:"-"`
+	Language    string         `gorm:"size:50" json:"language"`
+	UserID      *uint          `json:"user_id,omitempty"`
+	Files       []RevisionFile `gorm:"foreignKey:RevisionID" json:"files,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+// RevisionFile is one file of a multi-file paste as it was in a revision.
+// Its content is always kept in a blob.
+type RevisionFile struct {
+	ID          uint   `gorm:"primaryKey" json:"-"`
+	RevisionID  uint   `gorm:"uniqueIndex:idx_revision_file;not null" json:"-"`
+	Filename    string `gorm:"size:255;uniqueIndex:idx_revision_file;not null" json:"filename"`
+	Language    string `gorm:"size:50" json:"language"`
+	Content     string `gorm:"-" json:"content,omitempty"`
+	ContentHash string `gorm:"size:64;not null;index" json:"-"`
+	Position    int    `gorm:"not null" json:"position"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// Session is a login. Its ID is the jti of the access tokens issued for it,
+// so deleting the row revokes them. The refresh token is stored hashed and
+// replaced on every refresh; the previous hash is kept to spot a refresh
+// token that is used again.
+type Session struct {
+	ID              string    `gorm:"primaryKey;size:32" json:"id"`
+	UserID          uint      `gorm:"index;not null" json:"-"`
+	User            *User     `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	RefreshHash     string    `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	PrevRefreshHash string    `gorm:"size:64;index;not null;default:''" json:"-"`
+	RotatedAt       time.Time `json:"-"`
+	IP              string    `gorm:"size:64" json:"ip"`
+	UserAgent       string    `gorm:"size:255" json:"user_agent"`
+	LastSeenAt      time.Time `json:"last_seen_at"`
+	ExpiresAt       time.Time `gorm:"index" json:"expires_at"`
+	CreatedAt       time.Time `json:"created_at"`
+}
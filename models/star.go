@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// Star bookmarks a paste for a user. The number of stars of a paste is
+// kept on it too, so listings can be sorted by it.
+type Star struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	UserID    uint      `gorm:"uniqueIndex:idx_user_star;not null" json:"-"`
+	PasteID   string    `gorm:"size:12;uniqueIndex:idx_user_star;index;not null" json:"paste_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
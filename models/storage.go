@@ -0,0 +1,13 @@
+package models
+
+import (
+	"time"
+)
+
+// StorageObject holds paste content for the "db" storage backend
+type StorageObject struct {
+	Key       string `gorm:"primaryKey;size:255"`
+	Data      []byte `gorm:"not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Tag labels pastes. Tags are shared by everyone; a name is lowercase and
+// made of letters, digits and "-", "_", ".", "+" or "#".
+type Tag struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	Name      string    `gorm:"size:32;uniqueIndex;not null" json:"name"`
+	CreatedAt time.Time `json:"-"`
+}
+
+// MaxPasteTags is how many tags a paste can have
+const MaxPasteTags = 10
+
+// MarshalJSON writes a tag as its name, the way clients send tags
+func (t Tag) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Name)
+}
+
+func (t *Tag) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &t.Name)
+}
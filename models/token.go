@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// Scopes a personal API token can be given
+const (
+	ScopePasteRead   = "paste:read"
+	ScopePasteWrite  = "paste:write"
+	ScopePasteDelete = "paste:delete"
+)
+
+var TokenScopes = []string{ScopePasteRead, ScopePasteWrite, ScopePasteDelete}
+
+// APIToken is a long-lived personal access token. Only a SHA-256 hash of
+// the token is kept; Prefix is enough of it to tell tokens apart.
+type APIToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index;not null" json:"-"`
+	User       *User      `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	Name       string     `gorm:"size:100;not null" json:"name"`
+	Prefix     string     `gorm:"size:16;not null" json:"prefix"`
+	Hash       string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	Scopes     string     `gorm:"size:255;not null" json:"scopes"` // space-separated
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
@@ -32,18 +32,24 @@ async function copyToClipboard(text, btn) {
 }
 
 function toggleWrap() {
-    const body = document.querySelector('.code-body');
+    const bodies = document.querySelectorAll('.code-body');
     const btn = document.getElementById('wrap-toggle');
-    if (!body) return;
-    body.classList.toggle('wrap-text');
-    const isWrapped = body.classList.contains('wrap-text');
+    if (!bodies.length) return;
+    const isWrapped = !bodies[0].classList.contains('wrap-text');
+    bodies.forEach(b => b.classList.toggle('wrap-text', isWrapped));
     localStorage.setItem('wrapText', isWrapped);
     if (btn) btn.classList.toggle('btn-primary', isWrapped);
 }
 
+// Echoed back on every API call so cookie-authenticated requests pass the CSRF check
+function csrfToken() {
+    const m = document.cookie.match(/(?:^|; )patbin_csrf=([^;]*)/);
+    return m ? m[1] : '';
+}
+
 const API = {
     async request(url, opts = {}) {
-        const r = await fetch(url, { headers: { 'Content-Type': 'application/json' }, credentials: 'same-origin', ...opts });
+        const r = await fetch(url, { headers: { 'Content-Type': 'application/json', 'X-CSRF-Token': csrfToken() }, credentials: 'same-origin', ...opts });
         const d = await r.json();
         if (!r.ok) throw new Error(d.error || 'Error');
         return d;
@@ -52,11 +58,62 @@ const API = {
     updatePaste: (id, d) => API.request(`/api/paste/${id}`, { method: 'PUT', body: JSON.stringify(d) }),
     deletePaste: (id) => API.request(`/api/paste/${id}`, { method: 'DELETE' }),
     forkPaste: (id) => API.request(`/api/paste/${id}/fork`, { method: 'POST' }),
+    starPaste: (id, starred) => API.request(`/api/paste/${id}/star`, { method: starred ? 'POST' : 'DELETE' }),
+    createComment: (id, d) => API.request(`/api/paste/${id}/comments`, { method: 'POST', body: JSON.stringify(d) }),
+    resolveComment: (id, cid, resolved) => API.request(`/api/paste/${id}/comments/${cid}`, { method: 'PUT', body: JSON.stringify({ resolved }) }),
+    deleteComment: (id, cid) => API.request(`/api/paste/${id}/comments/${cid}`, { method: 'DELETE' }),
+    search: (q, params = {}) => API.request('/api/search?' + new URLSearchParams({ q, ...params })),
+    detectLanguage: (content, filename) => API.request('/api/detect-language', { method: 'POST', body: JSON.stringify({ content, filename }) }),
+    highlight: (content, language) => API.request('/api/highlight', { method: 'POST', body: JSON.stringify({ content, language }) }),
     login: (u, p) => API.request('/api/auth/login', { method: 'POST', body: JSON.stringify({ username: u, password: p }) }),
     register: (u, p) => API.request('/api/auth/register', { method: 'POST', body: JSON.stringify({ username: u, password: p }) }),
-    logout: () => API.request('/api/auth/logout', { method: 'POST' })
+    logout: () => API.request('/api/auth/logout', { method: 'POST' }),
+    createToken: (d) => API.request('/api/tokens', { method: 'POST', body: JSON.stringify(d) }),
+    revokeToken: (id) => API.request(`/api/tokens/${id}`, { method: 'DELETE' }),
+    createCollection: (d) => API.request('/api/collections', { method: 'POST', body: JSON.stringify(d) }),
+    deleteCollection: (id) => API.request(`/api/collections/${id}`, { method: 'DELETE' }),
+    createOrg: (d) => API.request('/api/orgs', { method: 'POST', body: JSON.stringify(d) }),
+    setMember: (org, username, role) => API.request(`/api/org/${org}/members/${encodeURIComponent(username)}`, { method: 'PUT', body: JSON.stringify({ role }) }),
+    removeMember: (org, username) => API.request(`/api/org/${org}/members/${encodeURIComponent(username)}`, { method: 'DELETE' }),
+    revokeSession: (id) => API.request(`/api/sessions/${id}`, { method: 'DELETE' }),
+    revokeAllSessions: () => API.request('/api/sessions', { method: 'DELETE' })
+};
+
+// Client-side encryption: AES-256-GCM with the key in the URL fragment,
+// which browsers never send to the server. Ciphertext is base64 of the
+// 12-byte IV followed by the sealed content.
+const Encryption = {
+    cipher: 'aes-256-gcm',
+    available: () => !!(window.crypto && crypto.subtle),
+    toBase64(bytes) {
+        let s = '';
+        for (let i = 0; i < bytes.length; i += 0x8000) s += String.fromCharCode(...bytes.subarray(i, i + 0x8000));
+        return btoa(s);
+    },
+    fromBase64: (s) => Uint8Array.from(atob(s.replace(/-/g, '+').replace(/_/g, '/')), c => c.charCodeAt(0)),
+    async newKey() {
+        const key = await crypto.subtle.generateKey({ name: 'AES-GCM', length: 256 }, true, ['encrypt', 'decrypt']);
+        const raw = new Uint8Array(await crypto.subtle.exportKey('raw', key));
+        return { key, fragment: Encryption.toBase64(raw).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '') };
+    },
+    importKey: (fragment) => crypto.subtle.importKey('raw', Encryption.fromBase64(fragment), 'AES-GCM', false, ['encrypt', 'decrypt']),
+    async encrypt(key, text) {
+        const iv = crypto.getRandomValues(new Uint8Array(12));
+        const sealed = new Uint8Array(await crypto.subtle.encrypt({ name: 'AES-GCM', iv }, key, new TextEncoder().encode(text)));
+        const out = new Uint8Array(iv.length + sealed.length);
+        out.set(iv); out.set(sealed, iv.length);
+        return Encryption.toBase64(out);
+    },
+    async decrypt(key, data) {
+        const bytes = Encryption.fromBase64(data);
+        return new TextDecoder().decode(await crypto.subtle.decrypt({ name: 'AES-GCM', iv: bytes.subarray(0, 12) }, key, bytes.subarray(12)));
+    },
+    keyFromURL: () => location.hash.slice(1)
 };
 
+// Tags are typed as one comma- or space-separated list
+const splitTags = (s) => (s || '').split(/[\s,]+/).filter(Boolean);
+
 function setupPasteForm() {
     const f = document.getElementById('paste-form');
     if (!f) return;
@@ -65,11 +122,23 @@ function setupPasteForm() {
         const btn = f.querySelector('button[type="submit"]');
         try {
             btn.disabled = true; btn.textContent = 'Creating...';
-            const paste = await API.createPaste({
+            const data = {
                 title: f.title.value || 'Untitled', content: f.content.value, language: f.language.value,
-                is_public: f.is_public.checked, expires_in: f.expires_in?.value || 'never', burn_after_read: f.burn_after_read?.checked || false
-            });
-            window.location.href = `/${paste.id}`;
+                visibility: f.visibility.value, expires_in: f.expires_in?.value || 'never', burn_after_read: f.burn_after_read?.checked || false,
+                password: f.password?.value || '', tags: splitTags(f.tags?.value)
+            };
+            if (f.org?.value) data.org = f.org.value;
+            else if (f.collection?.value) data.collection_id = Number(f.collection.value);
+            let fragment = '';
+            if (f.encrypt?.value === 'true') {
+                if (!Encryption.available()) throw new Error('Encryption needs a secure (HTTPS) connection');
+                const { key, fragment: k } = await Encryption.newKey();
+                data.content = await Encryption.encrypt(key, data.content);
+                data.encryption = Encryption.cipher;
+                fragment = '#' + k;
+            }
+            const paste = await API.createPaste(data);
+            window.location.href = `/${paste.id}${fragment}`;
         } catch (err) { Toast.show(err.message, 'error'); btn.disabled = false; btn.textContent = 'Create Paste'; }
     });
 }
@@ -77,13 +146,37 @@ function setupPasteForm() {
 function setupEditForm() {
     const f = document.getElementById('edit-form');
     if (!f) return;
+    // Encrypted content is decrypted into the editor and encrypted again on save
+    let key = null;
+    if (f.dataset.encryption) {
+        const btn = f.querySelector('button[type="submit"]');
+        btn.disabled = true;
+        (async () => {
+            try {
+                key = await Encryption.importKey(Encryption.keyFromURL());
+                f.content.value = await Encryption.decrypt(key, f.content.value);
+                btn.disabled = false;
+            } catch { f.content.value = ''; Toast.show('This paste is encrypted and the link is missing its key', 'error'); }
+        })();
+    }
     f.addEventListener('submit', async e => {
         e.preventDefault();
         const btn = f.querySelector('button[type="submit"]');
+        if (btn.disabled) return;
         try {
             btn.disabled = true; btn.textContent = 'Saving...';
-            await API.updatePaste(f.dataset.pasteId, { title: f.title.value, content: f.content.value, language: f.language.value, is_public: f.is_public.checked });
-            Toast.show('Saved!'); setTimeout(() => window.location.href = `/${f.dataset.pasteId}`, 800);
+            const files = [...f.querySelectorAll('.file-editor')].map(el => ({ filename: el.querySelector('[name="filename"]').value, content: el.querySelector('textarea').value, language: el.dataset.language }));
+            const content = key ? await Encryption.encrypt(key, f.content.value) : f.content?.value;
+            const data = files.length
+                ? { title: f.title.value, files, visibility: f.visibility.value }
+                : { title: f.title.value, content, language: f.language.value, visibility: f.visibility.value };
+            data.tags = splitTags(f.tags.value);
+            if (f.org?.value) data.org = f.org.value;
+            else if (f.collection) data.collection_id = Number(f.collection.value);
+            if (f.remove_password?.checked) data.password = '';
+            else if (f.password.value) data.password = f.password.value;
+            await API.updatePaste(f.dataset.pasteId, data);
+            Toast.show('Saved!'); setTimeout(() => window.location.href = `/${f.dataset.pasteId}${location.hash}`, 800);
         } catch (err) { Toast.show(err.message, 'error'); btn.disabled = false; btn.textContent = 'Save'; }
     });
 }
@@ -119,7 +212,178 @@ function setupForkButton() {
     const btn = document.getElementById('fork-paste');
     if (!btn) return;
     btn.addEventListener('click', async () => {
-        try { const f = await API.forkPaste(btn.dataset.pasteId); Toast.show('Forked!'); setTimeout(() => window.location.href = `/${f.id}`, 800); }
+        try { const f = await API.forkPaste(btn.dataset.pasteId); Toast.show('Forked!'); setTimeout(() => window.location.href = `/${f.id}${location.hash}`, 800); }
+        catch (err) { Toast.show(err.message, 'error'); }
+    });
+}
+
+function setupStarButton() {
+    const btn = document.getElementById('star-paste');
+    if (!btn) return;
+    btn.addEventListener('click', async () => {
+        try {
+            const s = await API.starPaste(btn.dataset.pasteId, !btn.classList.contains('btn-primary'));
+            btn.classList.toggle('btn-primary', s.starred);
+            btn.querySelector('span').textContent = s.starred ? 'Starred' : 'Star';
+            document.getElementById('star-count').textContent = `${s.stars} star${s.stars === 1 ? '' : 's'}`;
+        } catch (err) { Toast.show(err.message, 'error'); }
+    });
+}
+
+function setupFileTabs() {
+    const tabs = document.querySelectorAll('.file-tab');
+    tabs.forEach(tab => tab.addEventListener('click', () => {
+        tabs.forEach(t => t.classList.toggle('active', t === tab));
+        document.querySelectorAll('.file-pane').forEach(p => p.hidden = p.dataset.file !== tab.dataset.file);
+        const raw = document.getElementById('file-raw');
+        if (raw) raw.href = tab.dataset.raw;
+    }));
+}
+
+async function setupEncryptedPanes() {
+    const panes = document.querySelectorAll('[data-ciphertext]');
+    if (!panes.length) return;
+    let key = null;
+    try { key = await Encryption.importKey(Encryption.keyFromURL()); } catch { }
+    for (const pane of panes) {
+        const code = pane.querySelector('code');
+        try {
+            if (!key) throw new Error('This paste is encrypted and the link is missing its key');
+            code.textContent = await Encryption.decrypt(key, pane.dataset.ciphertext);
+        } catch (err) {
+            code.textContent = key ? 'Could not decrypt this paste: the key in the link is wrong' : err.message;
+            continue;
+        }
+        const lines = code.textContent.split('\n').length;
+        pane.querySelector('.line-numbers').innerHTML = Array.from({ length: lines }, (_, i) => `<span>${i + 1}</span>`).join('');
+    }
+}
+
+// Links and forms leading to other views of a paste carry its key along
+function keepKey() {
+    if (!location.hash) return;
+    document.querySelectorAll('a.keep-key').forEach(a => a.href += location.hash);
+    document.querySelectorAll('form.keep-key').forEach(f => f.action += location.hash);
+}
+
+function setupComments() {
+    const box = document.getElementById('comments');
+    if (!box) return;
+    const id = box.dataset.pasteId;
+    const f = document.getElementById('comment-form');
+    if (f) {
+        f.addEventListener('submit', async e => {
+            e.preventDefault();
+            try {
+                await API.createComment(id, { body: f.body.value, revision: Number(f.dataset.revision), start_line: Number(f.start_line.value), end_line: Number(f.end_line.value) || 0 });
+                location.reload();
+            } catch (err) { Toast.show(err.message, 'error'); }
+        });
+        // Comments are on the first file; its line numbers pick the lines
+        const gutter = document.querySelector('.file-pane[data-file="0"] .line-numbers');
+        if (gutter) gutter.addEventListener('click', e => {
+            const el = e.target.closest('.line-numbers > *');
+            if (!el) return;
+            const n = [...gutter.children].indexOf(el) + 1;
+            const start = Number(f.start_line.value);
+            if (e.shiftKey && start) { f.start_line.value = Math.min(start, n); f.end_line.value = Math.max(start, n); }
+            else { f.start_line.value = n; f.end_line.value = ''; }
+            if (el.tagName !== 'A') f.body.focus();
+        });
+    }
+    box.querySelectorAll('.reply-form').forEach(r => r.addEventListener('submit', async e => {
+        e.preventDefault();
+        try { await API.createComment(id, { body: r.body.value, parent_id: Number(r.dataset.parentId) }); location.reload(); }
+        catch (err) { Toast.show(err.message, 'error'); }
+    }));
+    box.querySelectorAll('.resolve-comment').forEach(btn => btn.addEventListener('click', async () => {
+        try { await API.resolveComment(id, btn.dataset.commentId, btn.dataset.resolved !== 'true'); location.reload(); }
+        catch (err) { Toast.show(err.message, 'error'); }
+    }));
+    box.querySelectorAll('.delete-comment').forEach(btn => btn.addEventListener('click', async () => {
+        if (!confirm(btn.dataset.thread ? 'Delete this thread and its replies?' : 'Delete this comment?')) return;
+        try { await API.deleteComment(id, btn.dataset.commentId); location.reload(); }
+        catch (err) { Toast.show(err.message, 'error'); }
+    }));
+}
+
+function setupTokens() {
+    const f = document.getElementById('token-form');
+    if (f) f.addEventListener('submit', async e => {
+        e.preventDefault();
+        const scopes = [...f.querySelectorAll('input[name="scopes"]:checked')].map(i => i.value);
+        try {
+            const t = await API.createToken({ name: f.name.value, scopes, expires_in: f.expires_in.value });
+            document.getElementById('new-token-value').textContent = t.token;
+            document.getElementById('new-token').classList.remove('hidden');
+            f.reset();
+        } catch (err) { Toast.show(err.message, 'error'); }
+    });
+    document.querySelectorAll('.revoke-token').forEach(btn => btn.addEventListener('click', async () => {
+        if (!confirm('Revoke this token? Anything using it will stop working.')) return;
+        try { await API.revokeToken(btn.dataset.tokenId); document.getElementById(`token-${btn.dataset.tokenId}`).remove(); Toast.show('Revoked!'); }
+        catch (err) { Toast.show(err.message, 'error'); }
+    }));
+}
+
+function setupCollections() {
+    const f = document.getElementById('collection-form');
+    if (f) f.addEventListener('submit', async e => {
+        e.preventDefault();
+        try {
+            await API.createCollection({ name: f.name.value });
+            location.reload();
+        } catch (err) { Toast.show(err.message, 'error'); }
+    });
+    document.querySelectorAll('.delete-collection').forEach(btn => btn.addEventListener('click', async () => {
+        if (!confirm('Delete this collection? Its pastes are kept.')) return;
+        try { await API.deleteCollection(btn.dataset.collectionId); location.href = '/dashboard'; }
+        catch (err) { Toast.show(err.message, 'error'); }
+    }));
+}
+
+function setupOrgs() {
+    const f = document.getElementById('org-form');
+    if (f) f.addEventListener('submit', async e => {
+        e.preventDefault();
+        try {
+            const org = await API.createOrg({ name: f.name.value });
+            location.href = `/o/${org.name}`;
+        } catch (err) { Toast.show(err.message, 'error'); }
+    });
+    const m = document.getElementById('member-form');
+    if (m) m.addEventListener('submit', async e => {
+        e.preventDefault();
+        try { await API.setMember(m.dataset.org, m.username.value.trim(), m.role.value); location.reload(); }
+        catch (err) { Toast.show(err.message, 'error'); }
+    });
+    document.querySelectorAll('.member-role').forEach(sel => sel.addEventListener('change', async () => {
+        try { await API.setMember(sel.dataset.org, sel.dataset.username, sel.value); Toast.show('Saved!'); }
+        catch (err) { Toast.show(err.message, 'error'); location.reload(); }
+    }));
+    document.querySelectorAll('.remove-member').forEach(btn => btn.addEventListener('click', async () => {
+        const leaving = btn.dataset.self === 'true';
+        if (!confirm(leaving ? 'Leave this organization? Pastes you created stay with it.' : 'Remove this member? Pastes they created stay with the organization.')) return;
+        try { await API.removeMember(btn.dataset.org, btn.dataset.username); leaving ? location.href = '/dashboard' : location.reload(); }
+        catch (err) { Toast.show(err.message, 'error'); }
+    }));
+}
+
+function setupSessions() {
+    document.querySelectorAll('.revoke-session').forEach(btn => btn.addEventListener('click', async () => {
+        const current = btn.dataset.current === 'true';
+        if (current && !confirm('This logs you out here. Continue?')) return;
+        try {
+            await API.revokeSession(btn.dataset.sessionId);
+            if (current) { window.location.href = '/login'; return; }
+            document.getElementById(`session-${btn.dataset.sessionId}`).remove();
+            Toast.show('Revoked!');
+        } catch (err) { Toast.show(err.message, 'error'); }
+    }));
+    const all = document.getElementById('revoke-all-sessions');
+    if (all) all.addEventListener('click', async () => {
+        if (!confirm('Log out of every session, this one included?')) return;
+        try { await API.revokeAllSessions(); window.location.href = '/login'; }
         catch (err) { Toast.show(err.message, 'error'); }
     });
 }
@@ -145,9 +409,8 @@ function setupKeyboardShortcuts() {
 
 function restoreWrapState() {
     if (localStorage.getItem('wrapText') === 'true') {
-        const body = document.querySelector('.code-body');
         const btn = document.getElementById('wrap-toggle');
-        if (body) body.classList.add('wrap-text');
+        document.querySelectorAll('.code-body').forEach(b => b.classList.add('wrap-text'));
         if (btn) btn.classList.add('btn-primary');
     }
 }
@@ -160,6 +423,15 @@ document.addEventListener('DOMContentLoaded', () => {
     setupAuthForms();
     setupDeleteButton();
     setupForkButton();
+    setupStarButton();
+    setupFileTabs();
+    setupEncryptedPanes();
+    keepKey();
+    setupComments();
+    setupTokens();
+    setupCollections();
+    setupOrgs();
+    setupSessions();
     setupLogout();
     setupKeyboardShortcuts();
     restoreWrapState();
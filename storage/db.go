@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"patbin/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// dbStore keeps objects in the storage_objects table, next to the pastes
+// but out of the rows that listings scan
+type dbStore struct {
+	db *gorm.DB
+}
+
+func NewDB(db *gorm.DB) (Store, error) {
+	if db == nil {
+		return nil, errors.New("storage: db backend needs a database")
+	}
+	return &dbStore{db: db}, nil
+}
+
+func (s *dbStore) Get(ctx context.Context, key string) ([]byte, error) {
+	var obj models.StorageObject
+	err := s.db.WithContext(ctx).First(&obj, "key = ?", key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	return obj.Data, err
+}
+
+func (s *dbStore) Put(ctx context.Context, key string, data []byte) error {
+	return s.db.WithContext(ctx).
+		Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(&models.StorageObject{Key: key, Data: data}).Error
+}
+
+func (s *dbStore) Delete(ctx context.Context, key string) error {
+	return s.db.WithContext(ctx).Delete(&models.StorageObject{}, "key = ?", key).Error
+}
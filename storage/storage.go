@@ -0,0 +1,52 @@
+// Package storage keeps paste content outside the pastes table, in the
+// database, on the local filesystem or in an S3-compatible bucket.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"patbin/config"
+
+	"gorm.io/gorm"
+)
+
+// Backend names as used in configuration and recorded on each paste.
+// Inline is the original layout: content in the pastes table itself.
+const (
+	Inline = "inline"
+	DB     = "db"
+	FS     = "fs"
+	S3     = "s3"
+)
+
+// ErrNotFound is returned by Get for keys that hold no object
+var ErrNotFound = errors.New("storage: object not found")
+
+// Store is a flat key-value object store
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Put(ctx context.Context, key string, data []byte) error
+	Delete(ctx context.Context, key string) error
+}
+
+// Open creates the store for a backend name, configured from cfg
+func Open(name string, cfg *config.Config, db *gorm.DB) (Store, error) {
+	switch name {
+	case DB:
+		return NewDB(db)
+	case FS:
+		return NewFS(cfg.StorageDir)
+	case S3:
+		return NewS3(S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			PathStyle: cfg.S3PathStyle,
+		})
+	}
+	return nil, fmt.Errorf("storage: unknown backend %q", name)
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"patbin/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testRoundTrip puts, reads, overwrites and deletes objects in s
+func testRoundTrip(t *testing.T, s Store) {
+	t.Helper()
+	ctx := context.Background()
+	keys := []string{"blobs/ab/abcdef", "test$file name+1.txt"}
+
+	for _, key := range keys {
+		if _, err := s.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Get(%q) before Put: %v, want ErrNotFound", key, err)
+		}
+		for _, data := range [][]byte{[]byte("hello\x00world"), []byte("replaced")} {
+			if err := s.Put(ctx, key, data); err != nil {
+				t.Fatalf("Put(%q): %v", key, err)
+			}
+			got, err := s.Get(ctx, key)
+			if err != nil {
+				t.Fatalf("Get(%q): %v", key, err)
+			}
+			if string(got) != string(data) {
+				t.Fatalf("Get(%q) = %q, want %q", key, got, data)
+			}
+		}
+	}
+
+	for _, key := range keys {
+		if err := s.Delete(ctx, key); err != nil {
+			t.Fatalf("Delete(%q): %v", key, err)
+		}
+		if _, err := s.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Get(%q) after Delete: %v, want ErrNotFound", key, err)
+		}
+		// Deleting twice is fine
+		if err := s.Delete(ctx, key); err != nil {
+			t.Fatalf("second Delete(%q): %v", key, err)
+		}
+	}
+}
+
+func TestFS(t *testing.T) {
+	s, err := NewFS(filepath.Join(t.TempDir(), "objects"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testRoundTrip(t, s)
+}
+
+func TestFSKeys(t *testing.T) {
+	root := t.TempDir()
+	s, err := NewFS(filepath.Join(root, "objects"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for _, key := range []string{"", "/", "../escape", "blobs/../../escape"} {
+		if err := s.Put(ctx, key, []byte("x")); err == nil {
+			t.Errorf("Put(%q) should fail", key)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "escape")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("a key escaped the root")
+	}
+
+	// No temporary files are left next to the objects
+	if err := s.Put(ctx, "blobs/ab/abc", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(filepath.Join(root, "objects", "blobs", "ab"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "abc" {
+		t.Errorf("directory holds %v, want only abc", entries)
+	}
+}
+
+func TestDB(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.StorageObject{}); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testRoundTrip(t, s)
+}